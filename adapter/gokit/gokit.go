@@ -0,0 +1,217 @@
+// Package gokitadapter converts between log.Logger and go-kit's log.Logger,
+// so frameworks built on go-kit (or Kratos-style keyvals loggers) can use
+// the mmap syncer and vice versa.
+package gokitadapter
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Reb1113/mmap_write_syncer"
+	kitlog "github.com/go-kit/log"
+	kitlevel "github.com/go-kit/log/level"
+)
+
+var (
+	_ kitlog.Logger       = (*kitLogger)(nil)
+	_ log.Logger          = (*logger)(nil)
+	_ log.RawLogger       = (*logger)(nil)
+	_ log.LevelController = (*logger)(nil)
+)
+
+// MessageKey is the keyvals key whose value becomes the record message.
+const MessageKey = "msg"
+
+// ToKit exposes l as a go-kit logger. The level is taken from a go-kit
+// level value (see github.com/go-kit/log/level) or defaults to info, and
+// the value under MessageKey becomes the message.
+func ToKit(l log.Logger) kitlog.Logger {
+	return &kitLogger{logger: l}
+}
+
+type kitLogger struct {
+	logger log.Logger
+}
+
+func (k *kitLogger) Log(keyvals ...interface{}) error {
+	lvl := log.LevelInfo
+	msg := ""
+	rest := make([]interface{}, 0, len(keyvals))
+	for i := 0; i < len(keyvals); i += 2 {
+		key := keyvals[i]
+		var val interface{}
+		if i+1 < len(keyvals) {
+			val = keyvals[i+1]
+		}
+		if key == kitlevel.Key() {
+			if v, ok := val.(kitlevel.Value); ok {
+				lvl = fromKit(v)
+				continue
+			}
+		}
+		if key == MessageKey {
+			msg = fmt.Sprint(val)
+			continue
+		}
+		rest = append(rest, key, val)
+	}
+
+	switch lvl {
+	case log.LevelDebug:
+		k.logger.Debug(msg, rest...)
+	case log.LevelWarn:
+		k.logger.Warn(msg, rest...)
+	case log.LevelError:
+		k.logger.Error(msg, rest...)
+	default:
+		k.logger.Info(msg, rest...)
+	}
+	return nil
+}
+
+func fromKit(v kitlevel.Value) log.Level {
+	switch v {
+	case kitlevel.DebugValue():
+		return log.LevelDebug
+	case kitlevel.WarnValue():
+		return log.LevelWarn
+	case kitlevel.ErrorValue():
+		return log.LevelError
+	default:
+		return log.LevelInfo
+	}
+}
+
+// FromKit wraps a go-kit logger as a log.Logger that also implements
+// log.RawLogger and log.LevelController. Records below the level set with
+// SetLevel are dropped; Panic and Fatal log at error level before panicking
+// or exiting.
+func FromKit(k kitlog.Logger) log.Logger {
+	l := &logger{kit: k, level: new(int32)}
+	l.SetLevel(log.LevelInfo)
+	return l
+}
+
+type logger struct {
+	kit   kitlog.Logger
+	level *int32
+}
+
+func (l *logger) enabled(lvl log.Level) bool {
+	return lvl >= log.Level(atomic.LoadInt32(l.level))
+}
+
+func (l *logger) log(lvl log.Level, kv kitlevel.Value, msg string, keyvals ...interface{}) {
+	if !l.enabled(lvl) {
+		return
+	}
+	args := append([]interface{}{kitlevel.Key(), kv, MessageKey, msg}, keyvals...)
+	_ = l.kit.Log(args...)
+}
+
+func (l *logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(log.LevelDebug, kitlevel.DebugValue(), msg, keyvals...)
+}
+
+func (l *logger) Info(msg string, keyvals ...interface{}) {
+	l.log(log.LevelInfo, kitlevel.InfoValue(), msg, keyvals...)
+}
+
+func (l *logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(log.LevelWarn, kitlevel.WarnValue(), msg, keyvals...)
+}
+
+func (l *logger) Error(msg string, keyvals ...interface{}) {
+	l.log(log.LevelError, kitlevel.ErrorValue(), msg, keyvals...)
+}
+
+func (l *logger) Panic(msg string, keyvals ...interface{}) {
+	l.log(log.LevelPanic, kitlevel.ErrorValue(), msg, keyvals...)
+	panic(msg)
+}
+
+func (l *logger) Fatal(msg string, keyvals ...interface{}) {
+	l.log(log.LevelFatal, kitlevel.ErrorValue(), msg, keyvals...)
+	os.Exit(1)
+}
+
+func (l *logger) Debugf(template string, args ...interface{}) {
+	l.Debug(fmt.Sprintf(template, args...))
+}
+
+func (l *logger) Infof(template string, args ...interface{}) {
+	l.Info(fmt.Sprintf(template, args...))
+}
+
+func (l *logger) Warnf(template string, args ...interface{}) {
+	l.Warn(fmt.Sprintf(template, args...))
+}
+
+func (l *logger) Errorf(template string, args ...interface{}) {
+	l.Error(fmt.Sprintf(template, args...))
+}
+
+func (l *logger) Panicf(template string, args ...interface{}) {
+	l.Panic(fmt.Sprintf(template, args...))
+}
+
+func (l *logger) Fatalf(template string, args ...interface{}) {
+	l.Fatal(fmt.Sprintf(template, args...))
+}
+
+// Raw logs p as the message of a record at lvl, since go-kit loggers have
+// no way to accept pre-encoded bytes.
+func (l *logger) Raw(lvl log.Level, p []byte) error {
+	if !l.enabled(lvl) {
+		return nil
+	}
+	return l.kit.Log(kitlevel.Key(), toKit(lvl), MessageKey, strings.TrimSuffix(string(p), "\n"))
+}
+
+func toKit(lvl log.Level) kitlevel.Value {
+	switch lvl {
+	case log.LevelDebug:
+		return kitlevel.DebugValue()
+	case log.LevelInfo:
+		return kitlevel.InfoValue()
+	case log.LevelWarn:
+		return kitlevel.WarnValue()
+	default:
+		return kitlevel.ErrorValue()
+	}
+}
+
+// With adds args to the keyvals of every record l logs from now on and
+// returns l.
+func (l *logger) With(args ...interface{}) log.Logger {
+	l.kit = kitlog.With(l.kit, args...)
+	return l
+}
+
+// Child returns a logger adding args to the keyvals of l, leaving l
+// unchanged. It shares the level of l.
+func (l *logger) Child(args ...interface{}) log.Logger {
+	return &logger{kit: kitlog.With(l.kit, args...), level: l.level}
+}
+
+func (l *logger) SetLevel(lvl log.Level) {
+	atomic.StoreInt32(l.level, int32(lvl))
+}
+
+func (l *logger) GetLevel() log.Level {
+	return log.Level(atomic.LoadInt32(l.level))
+}
+
+// SetLevelFor sets the level for d and then restores the previous level,
+// unless the level was changed again in the meantime.
+func (l *logger) SetLevelFor(lvl log.Level, d time.Duration) {
+	prev := atomic.SwapInt32(l.level, int32(lvl))
+	time.AfterFunc(d, func() {
+		atomic.CompareAndSwapInt32(l.level, int32(lvl), prev)
+	})
+}
+
+func (l *logger) Close() {}
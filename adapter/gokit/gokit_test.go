@@ -0,0 +1,109 @@
+package gokitadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Reb1113/mmap_write_syncer"
+	kitlog "github.com/go-kit/log"
+	kitlevel "github.com/go-kit/log/level"
+)
+
+func TestToKit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "kit.log")
+	l := log.New(&log.Config{Output: log.OutputMmap, Filename: filename})
+	k := ToKit(l)
+	if err := kitlevel.Warn(k).Log(MessageKey, "disk almost full", "free", "5%"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Log(MessageKey, "no level"); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2:\n%s", len(lines), data)
+	}
+	want := []map[string]interface{}{
+		{"level": "warn", "msg": "disk almost full", "free": "5%"},
+		{"level": "info", "msg": "no level"},
+	}
+	for i, line := range lines {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range want[i] {
+			if rec[key] != value {
+				t.Errorf("record %d: %s = %v, want %v", i, key, rec[key], value)
+			}
+		}
+	}
+}
+
+func TestFromKit(t *testing.T) {
+	var buf bytes.Buffer
+	l := FromKit(kitlog.NewLogfmtLogger(&buf))
+	l.Debug("dropped below info")
+	l.Info("started", "port", 8080)
+	log.Child(l, "component", "db").Warn("slow query")
+	if err := l.(log.RawLogger).Raw(log.LevelError, []byte("raw record\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "level=info msg=started port=8080\n" +
+		"component=db level=warn msg=\"slow query\"\n" + // With prepends its keyvals
+		"level=error msg=\"raw record\"\n"
+	if buf.String() != want {
+		t.Fatalf("go-kit logger got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestFromKitWith(t *testing.T) {
+	var buf bytes.Buffer
+	l := FromKit(kitlog.NewLogfmtLogger(&buf))
+	l.With("service", "api") // the result is dropped, l carries the keyvals
+	l.Info("started")
+	child := log.Child(l, "request", 7)
+	child.Info("handled")
+	l.Info("stopped")
+
+	want := "service=api level=info msg=started\n" +
+		"service=api request=7 level=info msg=handled\n" +
+		"service=api level=info msg=stopped\n"
+	if buf.String() != want {
+		t.Fatalf("go-kit logger got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestFromKitSetLevelFor(t *testing.T) {
+	var buf bytes.Buffer
+	l := FromKit(kitlog.NewLogfmtLogger(&buf))
+	c := l.(log.LevelController)
+	c.SetLevelFor(log.LevelDebug, 50*time.Millisecond)
+	if c.GetLevel() != log.LevelDebug {
+		t.Fatalf("level = %v, want debug", c.GetLevel())
+	}
+	l.Debug("while raised")
+	deadline := time.Now().Add(5 * time.Second)
+	for c.GetLevel() != log.LevelInfo {
+		if time.Now().After(deadline) {
+			t.Fatal("level was not restored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	l.Debug("after")
+	if got := buf.String(); got != "level=debug msg=\"while raised\"\n" {
+		t.Fatalf("go-kit logger got %q", got)
+	}
+}
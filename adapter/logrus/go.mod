@@ -0,0 +1,21 @@
+module github.com/Reb1113/mmap_write_syncer/adapter/logrus
+
+go 1.21.4
+
+require (
+	github.com/Reb1113/mmap_write_syncer v0.0.0
+	github.com/sirupsen/logrus v1.9.3
+)
+
+require (
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+	go.uber.org/zap v1.21.0 // indirect
+	golang.org/x/sys v0.12.0 // indirect
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+)
+
+replace github.com/Reb1113/mmap_write_syncer => ../..
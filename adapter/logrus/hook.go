@@ -0,0 +1,93 @@
+// Package logrusadapter bridges logrus to this module, either by forwarding
+// entries into a log.Logger through a hook or by pointing logrus output at
+// an MMapLogger directly.
+package logrusadapter
+
+import (
+	log "github.com/Reb1113/mmap_write_syncer"
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	"github.com/sirupsen/logrus"
+)
+
+var _ logrus.Hook = (*Hook)(nil)
+
+// Hook is a logrus.Hook forwarding every fired entry into Logger, with the
+// entry's fields passed as keyvals.
+type Hook struct {
+	Logger    log.Logger
+	LogLevels []logrus.Level // LogLevels the hook fires for, all levels if empty.
+}
+
+// NewHook returns a Hook forwarding all levels into l.
+func NewHook(l log.Logger) *Hook {
+	return &Hook{Logger: l}
+}
+
+// Levels implements logrus.Hook.
+func (h *Hook) Levels() []logrus.Level {
+	if len(h.LogLevels) == 0 {
+		return logrus.AllLevels
+	}
+	return h.LogLevels
+}
+
+// Fire implements logrus.Hook. Panic and fatal entries are written at error
+// level, since logrus itself panics or exits once its hooks have run.
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	keyvals := make([]interface{}, 0, 2*len(entry.Data))
+	for k, v := range entry.Data {
+		keyvals = append(keyvals, k, v)
+	}
+	switch Level(entry.Level) {
+	case log.LevelDebug:
+		h.Logger.Debug(entry.Message, keyvals...)
+	case log.LevelInfo:
+		h.Logger.Info(entry.Message, keyvals...)
+	case log.LevelWarn:
+		h.Logger.Warn(entry.Message, keyvals...)
+	default:
+		h.Logger.Error(entry.Message, keyvals...)
+	}
+	return nil
+}
+
+// Level maps a logrus level onto log.Level.
+func Level(level logrus.Level) log.Level {
+	switch level {
+	case logrus.TraceLevel, logrus.DebugLevel:
+		return log.LevelDebug
+	case logrus.InfoLevel:
+		return log.LevelInfo
+	case logrus.WarnLevel:
+		return log.LevelWarn
+	case logrus.ErrorLevel:
+		return log.LevelError
+	case logrus.PanicLevel:
+		return log.LevelPanic
+	case logrus.FatalLevel:
+		return log.LevelFatal
+	default:
+		return log.LevelInfo
+	}
+}
+
+// Formatter returns a JSON formatter whose keys match the records produced
+// by log.New, so files written by both stacks can be parsed the same way.
+func Formatter() logrus.Formatter {
+	return &logrus.JSONFormatter{
+		// Same layout as zapcore.ISO8601TimeEncoder.
+		TimestampFormat: "2006-01-02T15:04:05.000Z0700",
+		FieldMap: logrus.FieldMap{
+			logrus.FieldKeyTime:  "time",
+			logrus.FieldKeyLevel: "level",
+			logrus.FieldKeyMsg:   "msg",
+			logrus.FieldKeyFunc:  "caller",
+		},
+	}
+}
+
+// UseMmap points l's output at mmapLogger and installs Formatter.
+func UseMmap(l *logrus.Logger, mmapLogger *logger.MMapLogger) {
+	l.SetOutput(mmapLogger)
+	l.SetFormatter(Formatter())
+}
@@ -0,0 +1,95 @@
+package logrusadapter
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/Reb1113/mmap_write_syncer"
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHook(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hook.log")
+	l := log.New(&log.Config{Output: log.OutputMmap, Filename: filename})
+	lr := logrus.New()
+	lr.SetOutput(io.Discard)
+	lr.SetLevel(logrus.DebugLevel)
+	lr.AddHook(NewHook(l))
+	lr.WithField("user", "alice").Warn("login")
+	lr.Debug("details")
+	l.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2:\n%s", len(lines), data)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["level"] != "warn" || rec["msg"] != "login" || rec["user"] != "alice" {
+		t.Fatalf("record = %v, want the warn entry with its field", rec)
+	}
+}
+
+func TestHookLevels(t *testing.T) {
+	h := NewHook(nil)
+	if len(h.Levels()) != len(logrus.AllLevels) {
+		t.Fatalf("Levels() = %v, want all levels", h.Levels())
+	}
+	h.LogLevels = []logrus.Level{logrus.ErrorLevel}
+	if got := h.Levels(); len(got) != 1 || got[0] != logrus.ErrorLevel {
+		t.Fatalf("Levels() = %v, want LogLevels", got)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := map[logrus.Level]log.Level{
+		logrus.TraceLevel: log.LevelDebug,
+		logrus.DebugLevel: log.LevelDebug,
+		logrus.InfoLevel:  log.LevelInfo,
+		logrus.WarnLevel:  log.LevelWarn,
+		logrus.ErrorLevel: log.LevelError,
+		logrus.PanicLevel: log.LevelPanic,
+		logrus.FatalLevel: log.LevelFatal,
+	}
+	for in, want := range tests {
+		if got := Level(in); got != want {
+			t.Errorf("Level(%v) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestUseMmap(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "logrus.log")
+	mmapLogger := &logger.MMapLogger{Filename: filename}
+	lr := logrus.New()
+	UseMmap(lr, mmapLogger)
+	lr.WithField("user", "alice").Info("login")
+	if err := mmapLogger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatalf("%v: %s", err, data)
+	}
+	for _, key := range []string{"time", "level", "msg", "user"} {
+		if _, ok := rec[key]; !ok {
+			t.Errorf("record lacks %q: %s", key, data)
+		}
+	}
+}
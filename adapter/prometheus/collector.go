@@ -0,0 +1,122 @@
+// Package prometheus exports the runtime Stats of MMapLoggers as a
+// prometheus.Collector, so they can be scraped alongside the application's
+// metrics:
+//
+//	c := prometheus.NewCollector("")
+//	c.Register("app", mmapLogger)
+//	client.MustRegister(c)
+//
+// It is a module of its own, so the logger itself doesn't depend on the
+// Prometheus client library.
+package prometheus
+
+import (
+	"sort"
+	"sync"
+
+	mmaplogger "github.com/Reb1113/mmap_write_syncer/logger"
+	client "github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultNamespace prefixes the metric names when NewCollector is given an
+// empty namespace.
+const DefaultNamespace = "mmap_logger"
+
+// Source is implemented by *mmaplogger.MMapLogger.
+type Source interface {
+	Stats() mmaplogger.Stats
+}
+
+// Collector exports the Stats of the registered loggers, one time series
+// per logger distinguished by the "logger" label. It is safe for
+// concurrent use.
+type Collector struct {
+	metrics []metric
+
+	mu      sync.Mutex
+	sources map[string]Source
+}
+
+var _ client.Collector = (*Collector)(nil)
+
+// metric describes one exported metric and how to read it from Stats.
+type metric struct {
+	desc  *client.Desc
+	typ   client.ValueType
+	value func(s mmaplogger.Stats) float64
+}
+
+// NewCollector returns a Collector naming its metrics <namespace>_<metric>.
+func NewCollector(namespace string) *Collector {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	newMetric := func(name string, typ client.ValueType, help string, value func(s mmaplogger.Stats) float64) metric {
+		desc := client.NewDesc(client.BuildFQName(namespace, "", name), help, []string{"logger"}, nil)
+		return metric{desc: desc, typ: typ, value: value}
+	}
+	counter, gauge := client.CounterValue, client.GaugeValue
+	return &Collector{
+		metrics: []metric{
+			newMetric("bytes_written_total", counter, "Record bytes written.", func(s mmaplogger.Stats) float64 { return float64(s.BytesWritten) }),
+			newMetric("file_size_bytes", gauge, "Bytes written to the current file, excluding mapping padding.", func(s mmaplogger.Stats) float64 { return float64(s.FileSize) }),
+			newMetric("rotations_total", counter, "Log file rotations.", func(s mmaplogger.Stats) float64 { return float64(s.Rotations) }),
+			newMetric("remaps_total", counter, "Times the file was mapped again.", func(s mmaplogger.Stats) float64 { return float64(s.Remaps) }),
+			newMetric("fallbacks_total", counter, "Times writing fell back to buffered writes for lack of mapping budget.", func(s mmaplogger.Stats) float64 { return float64(s.Fallbacks) }),
+			newMetric("compress_failures_total", counter, "Failed compressions and recompressions of backups.", func(s mmaplogger.Stats) float64 { return float64(s.CompressFailures) }),
+			newMetric("mill_runs_total", counter, "Runs of the cleanup and compression task.", func(s mmaplogger.Stats) float64 { return float64(s.MillRuns) }),
+			newMetric("mill_errors_total", counter, "Runs of the cleanup and compression task that failed.", func(s mmaplogger.Stats) float64 { return float64(s.MillErrors) }),
+			newMetric("errors_total", counter, "Errors reported to OnError.", func(s mmaplogger.Stats) float64 { return float64(s.Errors) }),
+			newMetric("dropped_records_total", counter, "Records dropped on purpose, e.g. for being too long.", func(s mmaplogger.Stats) float64 { return float64(s.DroppedRecords) }),
+			newMetric("dropped_bytes_total", counter, "Bytes dropped because the async buffer was full.", func(s mmaplogger.Stats) float64 { return float64(s.DroppedBytes) }),
+			newMetric("failed_writes_total", counter, "Writes that failed.", func(s mmaplogger.Stats) float64 { return float64(s.FailedWrites) }),
+		},
+		sources: make(map[string]Source),
+	}
+}
+
+// Register exports the stats of s under the label logger=name, replacing a
+// source registered earlier under the same name.
+func (c *Collector) Register(name string, s Source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sources[name] = s
+}
+
+// Unregister stops exporting the source registered under name, e.g. after
+// its logger is closed.
+func (c *Collector) Unregister(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sources, name)
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *client.Desc) {
+	for _, m := range c.metrics {
+		ch <- m.desc
+	}
+}
+
+// Collect implements prometheus.Collector. The stats are read outside the
+// lock, so a slow source doesn't hold up Register.
+func (c *Collector) Collect(ch chan<- client.Metric) {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.sources))
+	for name := range c.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sources := make([]Source, len(names))
+	for i, name := range names {
+		sources[i] = c.sources[name]
+	}
+	c.mu.Unlock()
+
+	for i, s := range sources {
+		stats := s.Stats()
+		for _, m := range c.metrics {
+			ch <- client.MustNewConstMetric(m.desc, m.typ, m.value(stats), names[i])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package prometheus
+
+import (
+	"strings"
+	"testing"
+
+	mmaplogger "github.com/Reb1113/mmap_write_syncer/logger"
+	client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fixedStats mmaplogger.Stats
+
+func (s fixedStats) Stats() mmaplogger.Stats { return mmaplogger.Stats(s) }
+
+func TestCollector(t *testing.T) {
+	c := NewCollector("")
+	c.Register("app", fixedStats{BytesWritten: 42, FileSize: 4096, Rotations: 3})
+	c.Register("audit", fixedStats{BytesWritten: 7})
+
+	reg := client.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	want := `
+# HELP mmap_logger_bytes_written_total Record bytes written.
+# TYPE mmap_logger_bytes_written_total counter
+mmap_logger_bytes_written_total{logger="app"} 42
+mmap_logger_bytes_written_total{logger="audit"} 7
+# HELP mmap_logger_file_size_bytes Bytes written to the current file, excluding mapping padding.
+# TYPE mmap_logger_file_size_bytes gauge
+mmap_logger_file_size_bytes{logger="app"} 4096
+mmap_logger_file_size_bytes{logger="audit"} 0
+# HELP mmap_logger_rotations_total Log file rotations.
+# TYPE mmap_logger_rotations_total counter
+mmap_logger_rotations_total{logger="app"} 3
+mmap_logger_rotations_total{logger="audit"} 0
+`
+	names := []string{"mmap_logger_bytes_written_total", "mmap_logger_file_size_bytes", "mmap_logger_rotations_total"}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), names...); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Unregister("audit")
+	if n := testutil.CollectAndCount(c, "mmap_logger_rotations_total"); n != 1 {
+		t.Fatalf("%d rotation series after Unregister, want 1", n)
+	}
+}
+
+func TestCollectorFromLogger(t *testing.T) {
+	l := &mmaplogger.MMapLogger{Filename: t.TempDir() + "/app.log"}
+	defer l.Close()
+	if _, err := l.Write([]byte("record\n")); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCollector("app")
+	c.Register("main", l)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP app_bytes_written_total Record bytes written.
+# TYPE app_bytes_written_total counter
+app_bytes_written_total{logger="main"} 7
+`), "app_bytes_written_total"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+// Package zerologadapter lets zerolog loggers write into the rotated mmap
+// backend without going through zap.
+package zerologadapter
+
+import (
+	"io"
+
+	log "github.com/Reb1113/mmap_write_syncer"
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	"github.com/rs/zerolog"
+)
+
+var _ zerolog.LevelWriter = (*Writer)(nil)
+
+// Writer is a zerolog.LevelWriter that forwards encoded zerolog records to
+// an underlying io.Writer, dropping records below Level.
+type Writer struct {
+	Out   io.Writer // Out receives the encoded records, usually a *logger.MMapLogger.
+	Level log.Level // Level is the minimum enabled logging level.
+}
+
+// New returns a Writer that writes every record to out.
+func New(out io.Writer) *Writer {
+	return &Writer{Out: out, Level: log.LevelDebug}
+}
+
+// NewMmap returns a Writer backed by a rotated mmap log file.
+func NewMmap(mmapLogger *logger.MMapLogger) *Writer {
+	return New(mmapLogger)
+}
+
+// Write implements io.Writer. Records written without a level are always kept.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.Out.Write(p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *Writer) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if lvl, ok := Level(level); ok && lvl < w.Level {
+		return len(p), nil
+	}
+	return w.Out.Write(p)
+}
+
+// Close closes Out if it implements io.Closer.
+func (w *Writer) Close() error {
+	if c, ok := w.Out.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Level maps a zerolog level onto log.Level. It reports false for levels
+// without an equivalent, such as zerolog.NoLevel and zerolog.Disabled.
+func Level(level zerolog.Level) (log.Level, bool) {
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return log.LevelDebug, true
+	case zerolog.InfoLevel:
+		return log.LevelInfo, true
+	case zerolog.WarnLevel:
+		return log.LevelWarn, true
+	case zerolog.ErrorLevel:
+		return log.LevelError, true
+	case zerolog.PanicLevel:
+		return log.LevelPanic, true
+	case zerolog.FatalLevel:
+		return log.LevelFatal, true
+	default:
+		return 0, false
+	}
+}
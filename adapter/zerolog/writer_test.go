@@ -0,0 +1,74 @@
+package zerologadapter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/Reb1113/mmap_write_syncer"
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	"github.com/rs/zerolog"
+)
+
+func TestWriterLevel(t *testing.T) {
+	var buf bytes.Buffer
+	w := New(&buf)
+	w.Level = log.LevelWarn
+	z := zerolog.New(w)
+	z.Info().Msg("dropped")
+	z.Warn().Msg("kept warn")
+	z.Error().Msg("kept error")
+	z.Log().Msg("kept without level")
+
+	out := buf.String()
+	if strings.Contains(out, "dropped") {
+		t.Errorf("record below Level was written: %s", out)
+	}
+	for _, want := range []string{"kept warn", "kept error", "kept without level"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is missing: %s", want, out)
+		}
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		in   zerolog.Level
+		want log.Level
+		ok   bool
+	}{
+		{zerolog.TraceLevel, log.LevelDebug, true},
+		{zerolog.DebugLevel, log.LevelDebug, true},
+		{zerolog.InfoLevel, log.LevelInfo, true},
+		{zerolog.WarnLevel, log.LevelWarn, true},
+		{zerolog.ErrorLevel, log.LevelError, true},
+		{zerolog.FatalLevel, log.LevelFatal, true},
+		{zerolog.PanicLevel, log.LevelPanic, true},
+		{zerolog.NoLevel, 0, false},
+		{zerolog.Disabled, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := Level(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("Level(%v) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewMmap(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "zerolog.log")
+	w := NewMmap(&logger.MMapLogger{Filename: filename})
+	z := zerolog.New(w)
+	z.Info().Str("user", "alice").Msg("login")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"level":"info","user":"alice","message":"login"}` + "\n"; string(data) != want {
+		t.Fatalf("file holds %q, want %q", data, want)
+	}
+}
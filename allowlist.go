@@ -0,0 +1,87 @@
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces the value of every field listed in Config.RedactKeys.
+const Redacted = "[REDACTED]"
+
+// allowlistCore drops every structured field whose key is not in keys and
+// replaces the value of every remaining field whose key is in redact with
+// Redacted, both for fields added with With and for fields of a single
+// record. A nil keys allows every key. Fields the logger adds itself, such as
+// "seq", are added by inner cores and kept.
+type allowlistCore struct {
+	zapcore.Core
+	keys   map[string]struct{}
+	redact map[string]struct{}
+}
+
+func newAllowlistCore(core zapcore.Core, keys, redact []string) *allowlistCore {
+	c := &allowlistCore{Core: core}
+	if keys != nil {
+		c.keys = make(map[string]struct{}, len(keys))
+		for _, k := range keys {
+			c.keys[k] = struct{}{}
+		}
+	}
+	if len(redact) > 0 {
+		c.redact = make(map[string]struct{}, len(redact))
+		for _, k := range redact {
+			c.redact[k] = struct{}{}
+		}
+	}
+	return c
+}
+
+func (c *allowlistCore) With(fields []zapcore.Field) zapcore.Core {
+	return &allowlistCore{Core: c.Core.With(c.filter(fields)), keys: c.keys, redact: c.redact}
+}
+
+func (c *allowlistCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *allowlistCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, c.filter(fields))
+}
+
+// filter returns the allowed fields with redacted values, reusing fields
+// when nothing changes.
+func (c *allowlistCore) filter(fields []zapcore.Field) []zapcore.Field {
+	for i, f := range fields {
+		if c.allowed(f.Key) && !c.redacted(f.Key) {
+			continue
+		}
+		filtered := append(make([]zapcore.Field, 0, len(fields)), fields[:i]...)
+		for _, f := range fields[i:] {
+			switch {
+			case !c.allowed(f.Key):
+			case c.redacted(f.Key):
+				filtered = append(filtered, zap.String(f.Key, Redacted))
+			default:
+				filtered = append(filtered, f)
+			}
+		}
+		return filtered
+	}
+	return fields
+}
+
+func (c *allowlistCore) allowed(key string) bool {
+	if c.keys == nil {
+		return true
+	}
+	_, ok := c.keys[key]
+	return ok
+}
+
+func (c *allowlistCore) redacted(key string) bool {
+	_, ok := c.redact[key]
+	return ok
+}
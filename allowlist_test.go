@@ -0,0 +1,82 @@
+package log
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// decodeRecords decodes the JSON records of filename.
+func decodeRecords(t *testing.T, filename string) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(readRecords(t, filename)), "\n") {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestFieldAllowlist(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, FieldAllowlist: []string{"user", "port"}, Sequence: true})
+	l.With("user", "alice", "password", "hunter2").Info("login", "port", 22, "token", "abc")
+	l.Close()
+
+	rec := decodeRecords(t, filename)[0]
+	if rec["user"] != "alice" || rec["port"] != float64(22) {
+		t.Errorf("allowed fields missing: %v", rec)
+	}
+	for _, key := range []string{"password", "token"} {
+		if _, ok := rec[key]; ok {
+			t.Errorf("unlisted field %q was written: %v", key, rec)
+		}
+	}
+	if _, ok := rec["seq"]; !ok {
+		t.Errorf("field added by the logger was dropped: %v", rec)
+	}
+}
+
+func TestFieldAllowlistRedact(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{
+		Output:         OutputMmap,
+		Filename:       filename,
+		FieldAllowlist: []string{"user", "card"},
+		RedactKeys:     []string{"card", "password"},
+	})
+	l.With("card", "4111111111111111").Info("payment", "user", "alice", "password", "hunter2", "amount", 10)
+	l.Close()
+
+	rec := decodeRecords(t, filename)[0]
+	if rec["user"] != "alice" {
+		t.Errorf("allowed field missing: %v", rec)
+	}
+	if rec["card"] != Redacted {
+		t.Errorf("allowed and redacted field card = %v, want %q", rec["card"], Redacted)
+	}
+	for _, key := range []string{"password", "amount"} { // redacting doesn't allow a key
+		if _, ok := rec[key]; ok {
+			t.Errorf("unlisted field %q was written: %v", key, rec)
+		}
+	}
+}
+
+func TestRedactKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, RedactKeys: []string{"password"}})
+	l.Info("login", "user", "alice", "password", "hunter2")
+	l.Close()
+
+	rec := decodeRecords(t, filename)[0]
+	if rec["user"] != "alice" || rec["password"] != Redacted {
+		t.Fatalf("record = %v, want every field with password redacted", rec)
+	}
+	if strings.Contains(readRecords(t, filename), "hunter2") {
+		t.Fatal("redacted value reached the file")
+	}
+}
@@ -0,0 +1,104 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideBaseDir is returned for a path that escapes Config.BaseDir.
+var ErrOutsideBaseDir = errors.New("path is outside the base directory")
+
+// ContainPath returns name as a clean absolute path inside baseDir, or
+// ErrOutsideBaseDir if it escapes it, e.g. through ".." or a symlinked
+// directory. A relative name is taken relative to baseDir.
+func ContainPath(baseDir, name string) (string, error) {
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return "", err
+	}
+	base = resolveExisting(base)
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(base, name)
+	}
+	name = filepath.Clean(name)
+	path := filepath.Join(resolveExisting(filepath.Dir(name)), filepath.Base(name))
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s not in %s", ErrOutsideBaseDir, name, base)
+	}
+	return path, nil
+}
+
+// resolveExisting resolves the symlinks of the longest existing prefix of
+// path, leaving the components that do not exist yet as they are.
+func resolveExisting(path string) string {
+	var rest []string
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, rest...)...)
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// containPaths confines every file the config writes to BaseDir,
+// replacing the paths with their normalized form.
+func (c *Config) containPaths() error {
+	if c.BaseDir == "" {
+		return nil
+	}
+	filename, err := ContainPath(c.BaseDir, c.Filename)
+	if err != nil {
+		return err
+	}
+	c.Filename = filename
+	if c.SequenceFile != "" {
+		if c.SequenceFile, err = ContainPath(c.BaseDir, c.SequenceFile); err != nil {
+			return err
+		}
+	}
+	if c.QuotaFile != "" {
+		if c.QuotaFile, err = ContainPath(c.BaseDir, c.QuotaFile); err != nil {
+			return err
+		}
+	}
+	if c.StderrFile != "" {
+		if c.StderrFile, err = ContainPath(c.BaseDir, c.StderrFile); err != nil {
+			return err
+		}
+	}
+	if c.LargeFieldFile != "" {
+		if c.LargeFieldFile, err = ContainPath(c.BaseDir, c.LargeFieldFile); err != nil {
+			return err
+		}
+	}
+	if c.RouteFilename != "" {
+		// Field values cannot contain separators, so checking the template
+		// with a plain value covers every routed file.
+		sample := strings.ReplaceAll(c.RouteFilename, "{"+c.RouteField+"}", "x")
+		if _, err := ContainPath(c.BaseDir, sample); err != nil {
+			return err
+		}
+		if !filepath.IsAbs(c.RouteFilename) {
+			c.RouteFilename = filepath.Join(c.BaseDir, c.RouteFilename)
+		}
+	}
+	return nil
+}
+
+// reportError passes err to config.OnError, or prints it to stderr.
+func reportError(config *Config, err error) {
+	if config.OnError != nil {
+		config.OnError(err)
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
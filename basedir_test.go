@@ -0,0 +1,63 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContainPath(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(base, "escape")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	tests := []struct {
+		name string
+		want string // empty for ErrOutsideBaseDir
+	}{
+		{"app.log", filepath.Join(base, "app.log")},
+		{"tenant/./a/../app.log", filepath.Join(base, "tenant", "app.log")},
+		{filepath.Join(base, "app.log"), filepath.Join(base, "app.log")},
+		{"../app.log", ""},
+		{"tenant/../../app.log", ""},
+		{"/etc/passwd", ""},
+		{"escape/app.log", ""}, // through a symlinked directory
+	}
+	for _, tt := range tests {
+		got, err := ContainPath(base, tt.name)
+		if tt.want == "" {
+			if !errors.Is(err, ErrOutsideBaseDir) {
+				t.Errorf("ContainPath(%q) = %q, %v, want ErrOutsideBaseDir", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ContainPath(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestBaseDirFallsBackToConsole(t *testing.T) {
+	base := t.TempDir()
+	var reported []error
+	out := captureStdout(t, func() {
+		l := New(&Config{Output: OutputMmap, BaseDir: base, Filename: "../escaped.log", OnError: func(err error) { reported = append(reported, err) }})
+		l.Info("to the console")
+		l.Close()
+	})
+	if !strings.Contains(out, "to the console") {
+		t.Errorf("stdout %q, want the record on the console", out)
+	}
+	if len(reported) == 0 || !errors.Is(reported[0], ErrOutsideBaseDir) {
+		t.Fatalf("reported %v, want ErrOutsideBaseDir", reported)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(base), "escaped.log")); !os.IsNotExist(err) {
+		t.Fatalf("log file outside BaseDir was created: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// FieldTransformer rewrites a structured field before it is encoded, e.g. to
+// compress a large value or to replace it with a reference to where it is
+// stored. It is called for the fields of every record and of every With.
+type FieldTransformer func(f zapcore.Field) zapcore.Field
+
+// fieldCore applies a FieldTransformer to every structured field before
+// handing it to the wrapped core.
+type fieldCore struct {
+	zapcore.Core
+	transform FieldTransformer
+}
+
+func (c *fieldCore) With(fields []zapcore.Field) zapcore.Core {
+	return &fieldCore{Core: c.Core.With(c.apply(fields)), transform: c.transform}
+}
+
+func (c *fieldCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *fieldCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, c.apply(fields))
+}
+
+// apply returns the transformed fields in a new slice, as fields may be
+// shared with other cores.
+func (c *fieldCore) apply(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		out[i] = c.transform(f)
+	}
+	return out
+}
+
+// chainFieldTransformers returns a FieldTransformer applying first, then
+// second.
+func chainFieldTransformers(first, second FieldTransformer) FieldTransformer {
+	return func(f zapcore.Field) zapcore.Field {
+		return second(first(f))
+	}
+}
+
+// blobFile externalizes large string and []byte field values: they are
+// appended to a sidecar file and the field is replaced by a reference to
+// them, keeping the log file small and fast to grep. The sidecar is written
+// in segments named after path with the time they were started, e.g.
+// app.log-2006-01-02T15-04-05.000.blobs, so references stay valid: a new
+// segment is started once the current one reaches maxSize, and only the
+// newest maxBackups old segments are kept.
+type blobFile struct {
+	config     *Config
+	path       string
+	threshold  int
+	maxSize    int64 // maxSize is 0 for UnlimitedSize
+	maxBackups int
+	clock      zapcore.Clock
+
+	mu     sync.Mutex
+	file   *os.File
+	name   string // name is the path of the current segment
+	offset int64
+}
+
+func newBlobFile(config *Config) *blobFile {
+	b := &blobFile{
+		config:     config,
+		path:       config.LargeFieldFile,
+		threshold:  config.LargeFieldSize,
+		maxBackups: config.MaxBackups,
+		clock:      zapcore.DefaultClock,
+	}
+	if config.MaxSize != UnlimitedSize {
+		b.maxSize = int64(config.MaxSize) << 20
+	}
+	if config.Clock != nil {
+		b.clock = config.Clock
+	}
+	return b
+}
+
+// blobTimeFormat is the time format of segment names, as of backups.
+const blobTimeFormat = "2006-01-02T15-04-05.000"
+
+// blobRef is the reference a large field value is replaced by.
+type blobRef struct {
+	file   string
+	offset int64
+	size   int
+}
+
+func (r blobRef) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("blob", r.file)
+	enc.AddInt64("offset", r.offset)
+	enc.AddInt("size", r.size)
+	return nil
+}
+
+// transform is the FieldTransformer of the blob file. Fields it cannot
+// store are left as they are.
+func (b *blobFile) transform(f zapcore.Field) zapcore.Field {
+	var value []byte
+	switch f.Type {
+	case zapcore.StringType:
+		if len(f.String) <= b.threshold {
+			return f
+		}
+		value = []byte(f.String)
+	case zapcore.ByteStringType, zapcore.BinaryType:
+		v, _ := f.Interface.([]byte)
+		if len(v) <= b.threshold {
+			return f
+		}
+		value = v
+	default:
+		return f
+	}
+	ref, err := b.store(value)
+	if err != nil {
+		reportError(b.config, fmt.Errorf("store large field %q: %v", f.Key, err))
+		return f
+	}
+	return zapcore.Field{Key: f.Key, Type: zapcore.ObjectMarshalerType, Interface: ref}
+}
+
+// store appends value to the current segment, opening one on first use and
+// starting a new one when value would take it past maxSize. A value larger
+// than maxSize gets a segment of its own.
+func (b *blobFile) store(value []byte) (blobRef, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file != nil && b.maxSize > 0 && b.offset > 0 && b.offset+int64(len(value)) > b.maxSize {
+		err := b.file.Close()
+		b.file = nil
+		if err != nil {
+			return blobRef{}, err
+		}
+	}
+	if b.file == nil {
+		if err := b.open(); err != nil {
+			return blobRef{}, err
+		}
+	}
+	if _, err := b.file.Write(value); err != nil {
+		return blobRef{}, err
+	}
+	ref := blobRef{file: filepath.Base(b.name), offset: b.offset, size: len(value)}
+	b.offset += int64(len(value))
+	return ref, nil
+}
+
+// open opens the segment to append to: on first use the newest one if it
+// has room left, otherwise a new one. It then removes the segments beyond
+// maxBackups.
+func (b *blobFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+	segments := b.segments()
+	name := ""
+	if b.name == "" && len(segments) > 0 {
+		last := segments[len(segments)-1]
+		if info, err := os.Stat(last); err == nil && (b.maxSize == 0 || info.Size() < b.maxSize) {
+			name = last
+		}
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if name == "" {
+		name = b.segmentName(segments)
+		segments = append(segments, name)
+		flag |= os.O_EXCL
+	}
+	f, err := os.OpenFile(name, flag, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	b.file, b.name, b.offset = f, name, info.Size()
+
+	if b.maxBackups > 0 && len(segments) > b.maxBackups+1 {
+		for _, old := range segments[:len(segments)-b.maxBackups-1] {
+			if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+				reportError(b.config, fmt.Errorf("remove large field file: %v", err))
+			}
+		}
+	}
+	return nil
+}
+
+// segments returns the segments of path, oldest first.
+func (b *blobFile) segments() []string {
+	ext := filepath.Ext(b.path)
+	matches, _ := filepath.Glob(strings.TrimSuffix(b.path, ext) + "-*" + ext)
+	sort.Strings(matches)
+	return matches
+}
+
+// segmentName returns the name of a new segment started now, later than
+// those of segments.
+func (b *blobFile) segmentName(segments []string) string {
+	ext := filepath.Ext(b.path)
+	prefix := strings.TrimSuffix(b.path, ext) + "-"
+	t := b.clock.Now().Truncate(time.Millisecond)
+	if len(segments) > 0 {
+		last := strings.TrimSuffix(strings.TrimPrefix(segments[len(segments)-1], prefix), ext)
+		if prev, err := time.ParseInLocation(blobTimeFormat, last, t.Location()); err == nil && !t.After(prev) {
+			t = prev.Add(time.Millisecond)
+		}
+	}
+	return prefix + t.Format(blobTimeFormat) + ext
+}
+
+func (b *blobFile) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
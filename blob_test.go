@@ -0,0 +1,93 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// blobRefs returns the references of the "body" fields in the records of
+// filename.
+func blobRefs(t *testing.T, filename string) []map[string]interface{} {
+	t.Helper()
+	var refs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(readRecords(t, filename)), "\n") {
+		var rec struct {
+			Body map[string]interface{} `json:"body"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, rec.Body)
+	}
+	return refs
+}
+
+// readBlob returns the value ref points to in dir.
+func readBlob(t *testing.T, dir string, ref map[string]interface{}) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, ref["blob"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, size := int(ref["offset"].(float64)), int(ref["size"].(float64))
+	if offset+size > len(data) {
+		t.Fatalf("%v points past the %d bytes of the file", ref, len(data))
+	}
+	return data[offset : offset+size]
+}
+
+func TestLargeFieldSegments(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	l := New(&Config{Output: OutputFile, Filename: filename, LargeFieldSize: 1024, MaxSize: 1, MaxBackups: 1})
+	for i := 0; i < 5; i++ {
+		l.Info("upload", "body", strings.Repeat(string(rune('a'+i)), 600<<10))
+	}
+	l.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "app.log-*.blobs"))
+	if len(segments) != 2 {
+		t.Fatalf("segments = %v, want the current one and MaxBackups old one", segments)
+	}
+	for _, name := range segments {
+		if info, err := os.Stat(name); err != nil || info.Size() > 1<<20 {
+			t.Fatalf("%s: %v, %v, want at most MaxSize", name, info.Size(), err)
+		}
+	}
+	refs := blobRefs(t, filename)
+	if len(refs) != 5 {
+		t.Fatalf("%d records, want 5", len(refs))
+	}
+	for i, ref := range refs[3:] {
+		want := bytes.Repeat([]byte{byte('d' + i)}, 600<<10)
+		if !bytes.Equal(readBlob(t, dir, ref), want) {
+			t.Fatalf("record %d: %v does not point to its value", 3+i, ref)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, refs[0]["blob"].(string))); !os.IsNotExist(err) {
+		t.Fatalf("segment of the first record was kept: %v", err)
+	}
+}
+
+func TestLargeFieldSegmentReused(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	for i := 0; i < 2; i++ {
+		l := New(&Config{Output: OutputFile, Filename: filename, LargeFieldSize: 16})
+		l.Info("upload", "body", strings.Repeat(string(rune('a'+i)), 100))
+		l.Close()
+	}
+	refs := blobRefs(t, filename)
+	if len(refs) != 2 || refs[0]["blob"] != refs[1]["blob"] || refs[1]["offset"].(float64) != 100 {
+		t.Fatalf("refs = %v, want the second run to append to the segment of the first", refs)
+	}
+	for i, ref := range refs {
+		if got := string(readBlob(t, dir, ref)); got != strings.Repeat(string(rune('a'+i)), 100) {
+			t.Fatalf("record %d: %v points to %q", i, ref, got)
+		}
+	}
+}
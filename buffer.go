@@ -0,0 +1,77 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// zapBufferSize is the capacity zap's internal buffer pool allocates
+// buffers with; encoded records above it grow the pooled buffer.
+const zapBufferSize = 1024
+
+// BufferStats describes encoded record sizes and buffer pool behavior.
+type BufferStats struct {
+	Records       uint64 // Records is the number of encoded records written.
+	MaxRecordSize int    // MaxRecordSize is the largest encoded record seen, in bytes.
+	Oversized     uint64 // Oversized counts records larger than zap's 1024 byte pooled buffers, each of which may have grown a buffer.
+	DroppedBytes  uint64 // DroppedBytes is the size of the records the mmap output dropped because MmapAsyncBuffer was full.
+
+	// The logger's own pool only serves Raw records that lack a trailing
+	// newline; zap encodes all other records in its own pool, whose buffer
+	// size can't be changed (see Oversized).
+	RawBufferSize int    // RawBufferSize is the initial capacity of buffers in the Raw pool, see Config.RawBufferSize.
+	RawGets       uint64 // RawGets is the number of buffers taken from the Raw pool.
+	RawMisses     uint64 // RawMisses is the number of RawGets that had to allocate a new buffer.
+	RawGrown      uint64 // RawGrown is the number of buffers returned with more capacity than RawBufferSize.
+}
+
+// RawHitRate returns the fraction of RawGets served by a pooled buffer.
+func (s BufferStats) RawHitRate() float64 {
+	if s.RawGets == 0 {
+		return 0
+	}
+	return float64(s.RawGets-s.RawMisses) / float64(s.RawGets)
+}
+
+// bufferPool is a sync.Pool of byte slices with a configurable initial
+// capacity, used by Raw to add the newline a record lacks.
+type bufferPool struct {
+	size int
+	pool sync.Pool
+
+	gets, misses, grown atomic.Uint64
+}
+
+func newBufferPool(size int) *bufferPool {
+	if size <= 0 {
+		size = zapBufferSize
+	}
+	p := &bufferPool{size: size}
+	p.pool.New = func() interface{} {
+		p.misses.Add(1)
+		b := make([]byte, 0, p.size)
+		return &b
+	}
+	return p
+}
+
+func (p *bufferPool) get() []byte {
+	p.gets.Add(1)
+	return (*p.pool.Get().(*[]byte))[:0]
+}
+
+func (p *bufferPool) put(b []byte) {
+	if cap(b) > p.size {
+		p.grown.Add(1)
+	}
+	p.pool.Put(&b)
+}
+
+func (p *bufferPool) stats() BufferStats {
+	return BufferStats{
+		RawBufferSize: p.size,
+		RawGets:       p.gets.Load(),
+		RawMisses:     p.misses.Load(),
+		RawGrown:      p.grown.Load(),
+	}
+}
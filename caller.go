@@ -0,0 +1,72 @@
+package log
+
+import (
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// callerTrimAuto makes CallerTrimPrefix derive module-relative paths from
+// the caller's package path instead of trimming a fixed prefix.
+const callerTrimAuto = "auto"
+
+// callerEncoder returns the caller encoder for prefix, see
+// Config.CallerTrimPrefix.
+func callerEncoder(prefix string) zapcore.CallerEncoder {
+	switch prefix {
+	case "":
+		return zapcore.ShortCallerEncoder
+	case callerTrimAuto:
+		module := ""
+		if info, ok := debug.ReadBuildInfo(); ok {
+			module = info.Main.Path
+		}
+		return func(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendString(moduleRelativeCaller(caller, module))
+		}
+	default:
+		return func(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+			if !caller.Defined {
+				enc.AppendString("undefined")
+				return
+			}
+			file := strings.TrimPrefix(caller.File, prefix)
+			enc.AppendString(strings.TrimPrefix(file, "/") + ":" + strconv.Itoa(caller.Line))
+		}
+	}
+}
+
+// moduleRelativeCaller formats caller as "pkg/file.go:123" where pkg is the
+// caller's package path relative to module. Callers outside the module keep
+// their full package path.
+func moduleRelativeCaller(caller zapcore.EntryCaller, module string) string {
+	if !caller.Defined {
+		return "undefined"
+	}
+	file := caller.File[strings.LastIndexByte(caller.File, '/')+1:]
+	pkg := packagePath(caller.Function)
+	if module != "" {
+		if pkg == module {
+			pkg = ""
+		} else {
+			pkg = strings.TrimPrefix(pkg, module+"/")
+		}
+	}
+	if pkg != "" {
+		file = pkg + "/" + file
+	}
+	return file + ":" + strconv.Itoa(caller.Line)
+}
+
+// packagePath extracts the import path from a function name such as
+// "github.com/a/b/pkg.(*T).Method".
+func packagePath(function string) string {
+	slash := strings.LastIndexByte(function, '/')
+	dot := strings.IndexByte(function[slash+1:], '.')
+	if dot < 0 {
+		return function
+	}
+	return function[:slash+1+dot]
+}
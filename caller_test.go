@@ -0,0 +1,54 @@
+package log
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestModuleRelativeCaller(t *testing.T) {
+	const module = "github.com/Reb1113/mmap_write_syncer"
+	tests := []struct {
+		function, file string
+		want           string
+	}{
+		{module + "/shipper.(*Shipper).Run", "/src/mmap_write_syncer/shipper/shipper.go", "shipper/shipper.go:7"},
+		{module + ".New", "/src/mmap_write_syncer/zaplogger.go", "zaplogger.go:7"},
+		{module + "/cmd/logctl.main", "/src/mmap_write_syncer/cmd/logctl/main.go", "cmd/logctl/main.go:7"},
+		{"net/http.(*conn).serve", "/usr/lib/go/src/net/http/server.go", "net/http/server.go:7"}, // outside the module
+		{"main.main", "/tmp/main.go", "main/main.go:7"},
+	}
+	for _, tt := range tests {
+		caller := zapcore.EntryCaller{Defined: true, Function: tt.function, File: tt.file, Line: 7}
+		if got := moduleRelativeCaller(caller, module); got != tt.want {
+			t.Errorf("moduleRelativeCaller(%s) = %q, want %q", tt.function, got, tt.want)
+		}
+	}
+	if got := moduleRelativeCaller(zapcore.EntryCaller{}, module); got != "undefined" {
+		t.Errorf("undefined caller = %q", got)
+	}
+}
+
+func TestCallerTrimPrefix(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"":       filepath.Base(wd) + "/caller_test.go:", // the short caller
+		wd + "/": "caller_test.go:",
+	}
+	for trim, want := range tests {
+		filename := filepath.Join(dir, "app.log")
+		l := New(&Config{Output: OutputMmap, Filename: filename, CallerTrimPrefix: trim})
+		l.Info("here")
+		l.Close()
+		records := decodeRecords(t, filename)
+		if caller, _ := records[len(records)-1]["caller"].(string); !strings.HasPrefix(caller, want) {
+			t.Errorf("CallerTrimPrefix %q: caller %q, want %q at the logging line", trim, caller, want)
+		}
+	}
+}
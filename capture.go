@@ -0,0 +1,107 @@
+package log
+
+import (
+	"bytes"
+	"os/exec"
+	"sync"
+)
+
+// defaultMaxLineSize is the default of StreamWriter.MaxLineSize.
+const defaultMaxLineSize = 64 << 10
+
+// StreamWriter is an io.Writer that logs every line written to it as a
+// separate record with a "stream" field, suitable for cmd.Stdout and
+// cmd.Stderr.
+type StreamWriter struct {
+	// MaxLineSize caps the bytes of a line held while waiting for its
+	// newline; a longer line is logged in records of MaxLineSize bytes.
+	// Defaults to 64KB.
+	MaxLineSize int
+
+	logger Logger
+	level  Level
+	stream string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewStreamWriter returns a StreamWriter logging lines to l at level, tagged
+// with stream (e.g. "stdout").
+func NewStreamWriter(l Logger, level Level, stream string) *StreamWriter {
+	return &StreamWriter{logger: l, level: level, stream: stream}
+}
+
+// Write logs each complete line in p and buffers any trailing partial line,
+// logging it once it reaches MaxLineSize.
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	max := w.MaxLineSize
+	if max <= 0 {
+		max = defaultMaxLineSize
+	}
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		switch {
+		case i >= 0 && i <= max:
+			w.emit(w.buf[:i])
+			w.buf = w.buf[i+1:]
+		case len(w.buf) > max:
+			w.emit(w.buf[:max])
+			w.buf = w.buf[max:]
+		default:
+			if cap(w.buf) > 2*max { // don't hold on to the array of a large p
+				w.buf = append([]byte(nil), w.buf...)
+			}
+			return len(p), nil
+		}
+	}
+}
+
+// Close logs any buffered partial line.
+func (w *StreamWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+	return nil
+}
+
+func (w *StreamWriter) emit(line []byte) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	logAt(w.logger, w.level, string(line), "stream", w.stream)
+}
+
+// CaptureCommand points cmd's stdout and stderr at l, logging each line at
+// level with a "stream" field of "stdout" or "stderr". It must be called
+// before cmd is started; call the returned function after cmd.Wait to log
+// any output not terminated by a newline.
+func CaptureCommand(l Logger, cmd *exec.Cmd, level Level) (flush func()) {
+	stdout := NewStreamWriter(l, level, "stdout")
+	stderr := NewStreamWriter(l, level, "stderr")
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return func() {
+		_ = stdout.Close()
+		_ = stderr.Close()
+	}
+}
+
+// logAt logs msg at lvl. Panic and fatal are logged at error level so that
+// forwarded output can never terminate the process.
+func logAt(l Logger, lvl Level, msg string, keyvals ...interface{}) {
+	switch lvl {
+	case LevelDebug:
+		l.Debug(msg, keyvals...)
+	case LevelInfo:
+		l.Info(msg, keyvals...)
+	case LevelWarn:
+		l.Warn(msg, keyvals...)
+	default:
+		l.Error(msg, keyvals...)
+	}
+}
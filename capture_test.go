@@ -0,0 +1,58 @@
+package log
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// messageLogger records the messages logged at info level.
+type messageLogger struct {
+	Logger
+	msgs []string
+}
+
+func (l *messageLogger) Info(msg string, keyvals ...interface{}) {
+	l.msgs = append(l.msgs, msg)
+}
+
+func TestStreamWriterLines(t *testing.T) {
+	l := &messageLogger{}
+	w := NewStreamWriter(l, LevelInfo, "stdout")
+	for _, p := range []string{"first\nsec", "ond\r\n", "partial"} {
+		if _, err := w.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = w.Close()
+	if want := []string{"first", "second", "partial"}; !reflect.DeepEqual(l.msgs, want) {
+		t.Fatalf("logged %q, want %q", l.msgs, want)
+	}
+}
+
+func TestStreamWriterMaxLineSize(t *testing.T) {
+	l := &messageLogger{}
+	w := NewStreamWriter(l, LevelInfo, "stdout")
+	w.MaxLineSize = 4
+	for _, p := range []string{"abcdefghij", "kl", "\n", "mnop", "\n"} {
+		if _, err := w.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+		if len(w.buf) > w.MaxLineSize {
+			t.Fatalf("%d bytes buffered after %q, want at most %d", len(w.buf), p, w.MaxLineSize)
+		}
+	}
+	_ = w.Close()
+	if want := []string{"abcd", "efgh", "ijkl", "mnop"}; !reflect.DeepEqual(l.msgs, want) {
+		t.Fatalf("logged %q, want %q", l.msgs, want)
+	}
+
+	l.msgs = nil
+	w = NewStreamWriter(l, LevelInfo, "stderr")
+	if _, err := w.Write([]byte(strings.Repeat("x", 3*defaultMaxLineSize+1))); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.msgs) != 3 || len(w.buf) != 1 {
+		t.Fatalf("%d records and %d bytes buffered, want 3 records at the default cap and 1 byte", len(l.msgs), len(w.buf))
+	}
+}
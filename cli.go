@@ -0,0 +1,86 @@
+package log
+
+import (
+	"flag"
+	"strconv"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// BindFlags registers the conventional CLI flags on fs, setting c when fs is
+// parsed: -q for Quiet and -v, -vv for Verbosity. -v may be repeated, each
+// occurrence adds one. Parse fs before passing c to New.
+func (c *Config) BindFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.Quiet, "q", c.Quiet, "only print errors to the console")
+	fs.Var(&verbosityFlag{v: &c.Verbosity, step: 1}, "v", "log more, repeat for even more")
+	fs.Var(&verbosityFlag{v: &c.Verbosity, step: 2}, "vv", "log even more, like -v -v")
+}
+
+// verbosityFlag is a boolean flag adding step to the verbosity every time it
+// is given.
+type verbosityFlag struct {
+	v    *int
+	step int
+}
+
+func (f *verbosityFlag) IsBoolFlag() bool { return true }
+
+func (f *verbosityFlag) String() string {
+	if f.v == nil {
+		return "0"
+	}
+	return strconv.Itoa(*f.v)
+}
+
+func (f *verbosityFlag) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if on {
+		*f.v += f.step
+	}
+	return nil
+}
+
+// applyVerbosity lowers config.Level by one step per Verbosity, down to
+// LevelDebug, and resets Verbosity so a Config passed to New twice isn't
+// lowered twice.
+func applyVerbosity(config *Config) {
+	if config.Verbosity <= 0 {
+		return
+	}
+	config.Level = max(LevelDebug, config.Level-Level(config.Verbosity))
+	config.Verbosity = 0
+}
+
+// quietCore drops records below Error while the output is the console, see
+// Config.Quiet. A file output still gets every enabled record. Like
+// stdoutCore it checks again in Write, which the wrapping cores call
+// directly.
+type quietCore struct {
+	zapcore.Core
+	output *outputSyncer
+}
+
+func (c *quietCore) drops(lvl zapcore.Level) bool {
+	return lvl < zapcore.ErrorLevel && !c.output.writesFiles()
+}
+
+func (c *quietCore) With(fields []zapcore.Field) zapcore.Core {
+	return &quietCore{Core: c.Core.With(fields), output: c.output}
+}
+
+func (c *quietCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) && !c.drops(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *quietCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if c.drops(ent.Level) {
+		return nil
+	}
+	return c.Core.Write(ent, fields)
+}
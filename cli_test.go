@@ -0,0 +1,85 @@
+package log
+
+import (
+	"flag"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBindFlags(t *testing.T) {
+	tests := []struct {
+		args      []string
+		quiet     bool
+		verbosity int
+	}{
+		{nil, false, 0},
+		{[]string{"-q"}, true, 0},
+		{[]string{"-v"}, false, 1},
+		{[]string{"-v", "-v"}, false, 2},
+		{[]string{"-vv", "-v"}, false, 3},
+		{[]string{"-v=false"}, false, 0},
+	}
+	for _, tt := range tests {
+		var c Config
+		fs := flag.NewFlagSet("cli", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		c.BindFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if c.Quiet != tt.quiet || c.Verbosity != tt.verbosity {
+			t.Errorf("%v: Quiet %v, Verbosity %d, want %v, %d", tt.args, c.Quiet, c.Verbosity, tt.quiet, tt.verbosity)
+		}
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	config := &Config{Output: OutputMmap, Filename: filename, Level: LevelWarn, Verbosity: 1}
+	l := New(config)
+	l.Debug("below -v")
+	l.Info("shown by -v")
+	l.Close()
+	if config.Verbosity != 0 || config.Level != LevelInfo {
+		t.Errorf("config after New: Level %v, Verbosity %d, want info and 0", config.Level, config.Verbosity)
+	}
+	out := readRecords(t, filename)
+	if strings.Contains(out, "below -v") || !strings.Contains(out, "shown by -v") {
+		t.Fatalf("file holds:\n%s", out)
+	}
+
+	config = &Config{Output: OutputMmap, Filename: filename, Level: LevelWarn, Verbosity: 5}
+	New(config).Close()
+	if config.Level != LevelDebug {
+		t.Errorf("Verbosity beyond debug gave level %v", config.Level)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	stdout := captureStdout(t, func() {
+		l := New(&Config{Output: OutputStdout, Encoding: EncodingJSON, Quiet: true})
+		l.Warn("hidden by -q")
+		l.Error("shown by -q")
+		l.Close()
+	})
+	if strings.Contains(stdout, "hidden by -q") || !strings.Contains(stdout, "shown by -q") {
+		t.Errorf("quiet console printed %q", stdout)
+	}
+
+	filename := filepath.Join(t.TempDir(), "app.log")
+	info := LevelInfo
+	stdout = captureStdout(t, func() {
+		l := New(&Config{Output: OutputMmap, Filename: filename, Quiet: true, StdoutLevel: &info})
+		l.Info("file only")
+		l.Error("both")
+		l.Close()
+	})
+	if strings.Contains(stdout, "file only") || !strings.Contains(stdout, "both") {
+		t.Errorf("quiet stdout copy printed %q", stdout)
+	}
+	if out := readRecords(t, filename); !strings.Contains(out, "file only") || !strings.Contains(out, "both") {
+		t.Errorf("quiet file output lost records:\n%s", out)
+	}
+}
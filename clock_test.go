@@ -0,0 +1,50 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fixedClock is a zapcore.Clock stopped at a single instant.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+func (c fixedClock) NewTicker(d time.Duration) *time.Ticker { return time.NewTicker(d) }
+
+func TestClock(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	config := &Config{Output: OutputMmap, Filename: filepath.Join(dir, "app.log"), MaxAge: 5, Clock: fixedClock{now}}
+
+	old := filepath.Join(dir, "app-"+now.AddDate(0, 0, -9).Format("2006-01-02T15-04-05.000")+".log")
+	recent := filepath.Join(dir, "app-"+now.AddDate(0, 0, -1).Format("2006-01-02T15-04-05.000")+".log")
+	for _, name := range []string{old, recent} {
+		if err := os.WriteFile(name, []byte("record\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plan, err := RetentionPlan(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Remove) != 1 || plan.Remove[0] != filepath.Base(old) {
+		t.Fatalf("plan removes %v, want only the backup older than MaxAge by the injected clock", plan.Remove)
+	}
+
+	l := New(config)
+	l.Info("at the injected time")
+	l.Close()
+	records := decodeRecords(t, config.Filename)
+	ts, err := time.Parse(time.RFC3339, records[0]["time"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ts.Equal(now) {
+		t.Fatalf("record time %v, want the injected %v", ts, now)
+	}
+}
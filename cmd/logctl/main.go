@@ -0,0 +1,266 @@
+// Command logctl inspects log files produced by the mmap logger.
+//
+// Usage:
+//
+//	logctl amplification <filename>
+//	logctl doctor [-fix] <config.json>
+//	logctl export <filename>
+//	logctl header <filename>
+//	logctl plan <config.json>
+//	logctl replay -tcp addr | -loki url [-labels k=v,...] <deadletter>
+//	logctl shipper [-format vector|fluent-bit|promtail] <config.json>
+//	logctl upgrade [-encoding json|console|msgpack] [-compressed] <filename>...
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	log "github.com/Reb1113/mmap_write_syncer"
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	ship "github.com/Reb1113/mmap_write_syncer/shipper"
+)
+
+const usage = `usage: logctl <command> [arguments]
+
+commands:
+  amplification <filename>   compare logged bytes with bytes on disk for filename and its backups
+  doctor <config.json>       check that the environment can hold the files of a logger config
+  export <filename>          print the msgpack records of filename as JSON lines
+  header <filename>          print the file header of filename
+  plan <config.json>         print the backups retention would remove and compress for a logger config
+  replay <deadletter>        send the records of a shipper dead-letter file to a tcp or loki sink again
+  shipper <config.json>      print a vector, fluent-bit or promtail config for the files of a logger config
+  upgrade <filename>...      rewrite files to start with a current version file header
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "amplification":
+		err = amplification(os.Args[2:])
+	case "doctor":
+		err = doctor(os.Args[2:])
+	case "export":
+		if len(os.Args) != 3 {
+			err = fmt.Errorf("expected a single filename")
+			break
+		}
+		err = log.ExportJSONL(os.Stdout, os.Args[2])
+	case "header":
+		err = header(os.Args[2:])
+	case "plan":
+		err = plan(os.Args[2:])
+	case "replay":
+		err = replay(os.Args[2:])
+	case "shipper":
+		err = shipper(os.Args[2:])
+	case "upgrade":
+		err = upgrade(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logctl %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func amplification(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a single filename")
+	}
+	r, err := logger.AnalyzeAmplification(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("logged bytes:     %d\n", r.LoggedBytes)
+	fmt.Printf("padding bytes:    %d\n", r.PaddingBytes)
+	fmt.Printf("compressed:       %d -> %d\n", r.CompressedIn, r.CompressedOut)
+	fmt.Printf("disk bytes:       %d\n", r.DiskBytes)
+	fmt.Printf("amplification:    %.2f\n", r.Ratio())
+	return nil
+}
+
+func doctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "create the log directory if it is missing and probe mappings with a temporary file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected a single config file")
+	}
+	config, err := readConfig(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	r := log.Doctor(config)
+	if *fix {
+		r = log.DoctorFix(config)
+	}
+	for _, c := range r.Checks {
+		status := "ok"
+		if !c.OK {
+			status = "FAIL"
+		}
+		fmt.Printf("%-4s %-16s %s\n", status, c.Name, c.Detail)
+	}
+	if !r.OK() {
+		return fmt.Errorf("some checks failed")
+	}
+	return nil
+}
+
+func shipper(args []string) error {
+	fs := flag.NewFlagSet("shipper", flag.ContinueOnError)
+	format := fs.String("format", log.ShipperVector, "shipper to generate a config for: vector, fluent-bit or promtail")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected a single config file")
+	}
+	config, err := readConfig(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	out, err := log.ShipperConfig(config, *format)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	return nil
+}
+
+// readConfig reads a JSON encoded log.Config.
+func readConfig(name string) (*log.Config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	config := &log.Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return config, nil
+}
+
+func header(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a single filename")
+	}
+	h, ok, err := log.ReadFileHeader(args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("no file header")
+		return nil
+	}
+	fmt.Printf("version:    %d\n", h.Version)
+	fmt.Printf("encoding:   %s\n", h.Encoding)
+	fmt.Printf("compressed: %t\n", h.Compressed)
+	return nil
+}
+
+func upgrade(args []string) error {
+	fs := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+	encoding := fs.String("encoding", log.EncodingJSON, "record encoding of files without a header: json, console or msgpack")
+	compressed := fs.Bool("compressed", false, "record that backups of the files are gzip compressed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("expected at least one filename")
+	}
+	for _, name := range fs.Args() {
+		h, ok, err := log.ReadFileHeader(name)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if !ok {
+			h = log.FileHeader{Encoding: *encoding, Compressed: *compressed}
+		}
+		h.Version = log.FileHeaderVersion
+		if err := log.UpgradeFile(name, h); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func plan(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a single config file")
+	}
+	config, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+	p, err := log.RetentionPlan(config)
+	if err != nil {
+		return err
+	}
+	for _, step := range []struct {
+		action string
+		files  []string
+	}{
+		{"remove", p.Remove},
+		{"compress", p.Compress},
+		{"recompress", p.Recompress},
+		{"keep", p.Keep},
+	} {
+		for _, name := range step.files {
+			fmt.Printf("%-10s %s\n", step.action, name)
+		}
+	}
+	return nil
+}
+
+func replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	tcp := fs.String("tcp", "", "address of a tcp sink, e.g. vector:9000")
+	loki := fs.String("loki", "", "push endpoint of a loki sink, e.g. http://loki:3100/loki/api/v1/push")
+	labels := fs.String("labels", "", "stream labels of the loki sink, e.g. job=app,env=prod")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected a single dead-letter file")
+	}
+	var sink ship.Sink
+	switch {
+	case *tcp != "" && *loki == "":
+		tcpSink := &ship.TCPSink{Addr: *tcp}
+		defer tcpSink.Close()
+		sink = tcpSink
+	case *loki != "" && *tcp == "":
+		lokiSink := &ship.LokiSink{URL: *loki, Labels: map[string]string{}}
+		for _, kv := range strings.Split(*labels, ",") {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				lokiSink.Labels[k] = v
+			} else if kv != "" {
+				return fmt.Errorf("invalid label %q, expected k=v", kv)
+			}
+		}
+		sink = lokiSink
+	default:
+		return fmt.Errorf("expected either -tcp or -loki")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	n, err := ship.ReplayDeadLetters(ctx, fs.Arg(0), sink, 0)
+	fmt.Printf("replayed %d records\n", n)
+	return err
+}
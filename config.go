@@ -1,15 +1,116 @@
 package log
 
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+)
+
 type Config struct {
 	Level             Level  // Level is the minimum enabled logging level.
-	Output            Output // Output determines where the log should be written to, value: "console" or "file"
+	Output            Output // Output determines where the log should be written to, value: "console" (stdout), "stdout", "stderr", "file" or "mmap"
 	Filename          string // Filename is the file to write logs to.
-	MaxSize           int    // MaxSize is the maximum size in megabytes of the log file before it gets rotated.
+	BaseDir           string // BaseDir if set -> Filename and every other log file must lie inside it, relative paths are taken relative to it.
+	MaxSize           int    // MaxSize is the maximum size in megabytes of the log file before it gets rotated; UnlimitedSize disables it, other negative values mean the default.
+	MaxSizeText       Size   // MaxSizeText if set -> overrides MaxSize with a size with a unit, e.g. "250MB", "1GiB" or "unlimited".
 	MaxAge            int    // MaxAge is the maximum number of days to retain old log files based on the timestamp encoded in their filename.
+	MaxAgeText        Days   // MaxAgeText if set -> overrides MaxAge with a duration with a unit, e.g. "7d", "2w" or "72h".
 	MaxBackups        int    // MaxBackups is the maximum number of old log files to retain.
 	Compress          bool   // Compress determines if the rotated log files should be compressed using gzip.
 	DevMode           bool   // DevMode if true -> print colourful log in console and files.
 	DisableStacktrace bool
+	MaxRecordSize     int      // MaxRecordSize is the maximum size in bytes of a single record written to the mmap output.
+	RecordPolicy      string   // RecordPolicy handles records over MaxRecordSize, value: "error", "truncate" or "split"
+	RedirectStderr    bool     // RedirectStderr if true -> the process's stderr (fd 2) is pointed at StderrFile with dup3, so runtime panics and C library output reach disk even when the process crashes (Linux only).
+	StderrFile        string   // StderrFile receives the redirected stderr, defaults to Filename + ".stderr". It can't be the log file itself, whose output writes at its own offset. It is rotated at MaxSize, keeping MaxBackups backups.
+	RecompressAfter   Days     // RecompressAfter recompresses gzip backups older than this at RecompressLevel, 0 disables it.
+	RecompressLevel   int      // RecompressLevel is the gzip level used for recompression, defaults to gzip.BestCompression.
+	RecompressFormat  string   // RecompressFormat is the format of recompressed backups, only "gzip" (default) is supported; "zstd" is rejected as the module has no zstd encoder.
+	CompressRateLimit int      // CompressRateLimit is the maximum rate in MB/s at which backups are read for (re)compression, 0 means unlimited.
+	CompressNice      bool     // CompressNice if true -> compression runs on a thread with nice 19 and idle IO priority (Linux only).
+	RefuseSymlink     bool     // RefuseSymlink if true -> the mmap output refuses a Filename that is a symlink instead of rotating its target.
+	DetectRotation    bool     // DetectRotation if true -> the mmap output notices external rotation (e.g. logrotate) and reopens the file.
+	QuotaFile         string   // QuotaFile if set -> the mmap output shares QuotaSize with every process using this file on the volume, removing its oldest backups when the total exceeds it.
+	QuotaSize         Size     // QuotaSize is the shared byte budget in megabytes for QuotaFile, checked on every retention run.
+	KeepPatterns      []string // KeepPatterns are globs (or "regexp:" prefixed regexes) of backups exempt from MaxAge/MaxBackups pruning.
+	RotateSchedule    string   // RotateSchedule is a cron spec for time-based rotation of the mmap output, e.g. "0 * * * *".
+	CompressSchedule  string   // CompressSchedule is a cron spec confining compression of backups to off-peak hours, e.g. "0 3 * * *".
+	RouteField        string   // RouteField routes mmap records to a separate file per value of this field, e.g. "tenant"; bind it with Child for a logger per value.
+	RouteFilename     string   // RouteFilename is the filename template for routed files, "{field}" is replaced by the field value.
+	RouteMaxOpen      int      // RouteMaxOpen if > 0 -> at most this many routed files stay open, the least recently used is closed and reopened on its next record.
+	Sequence          bool     // Sequence if true -> every record gets a monotonically increasing "seq" field, persisted across restarts.
+	SequenceFile      string   // SequenceFile stores the sequence state, defaults to Filename + ".seq".
+	Monotonic         bool     // Monotonic if true -> every record gets a "mono_ns" field with the nanoseconds since process start on the monotonic clock.
+	RawBufferSize     int      // RawBufferSize is the initial capacity in bytes of the pooled buffers Raw copies records without a trailing newline into, defaults to 1024. Zap's own encoder buffers can't be tuned.
+	CallerTrimPrefix  string   // CallerTrimPrefix is trimmed from caller file paths; "auto" emits module-relative paths such as "pkg/file.go:123".
+	StrictKeyvals     bool     // StrictKeyvals if true -> malformed key-value lists are repaired ("missing_value" for a dangling key) and reported with a DPanic record, which panics in DevMode.
+	StructuredErrors  bool     // StructuredErrors if true -> error values are encoded as objects with their cause chain and stack trace.
+	Fingerprint       bool     // Fingerprint if true -> error and more severe records get a "fingerprint" field hashing the message template and calling function, for grouping identical errors.
+	PprofLabels       []string // PprofLabels lists the runtime/pprof labels that WithPprofLabels adds as fields from a context (see pprof.Do), e.g. "request_id"; unset labels are skipped.
+	GoroutineFrames   int      // GoroutineFrames if > 0 -> error and more severe records get a "goroutines" field with this many top frames of every goroutine, at most once per GoroutineInterval.
+	SyncOnLevel       *Level   // SyncOnLevel if set -> every record at or above this level is synced to disk immediately; console outputs are not synced.
+	Doctor            bool     // Doctor if true -> New runs DoctorFix and reports failed checks through OnError.
+	Encoding          string   // Encoding is the record encoding, value: "json", "console" or "msgpack"; defaults to "console" in DevMode and "json" otherwise.
+	StdoutLevel       *Level   // StdoutLevel if set -> records at or above this level are also written to stdout as plain JSON, without "seq", "mono_ns" and structured errors.
+	StdoutFields      []string // StdoutFields if not nil -> the stdout copy keeps only the structured fields listed, the file keeps all of them.
+	Quiet             bool     // Quiet if true -> only records at or above Error reach the console, including the StdoutLevel copy; a file output still gets every record enabled by Level. See BindFlags.
+	Verbosity         int      // Verbosity lowers Level by one step per count down to debug, e.g. 1 for -v and 2 for -vv; New applies it to Level and resets it. See BindFlags.
+	SplitConsole      bool     // SplitConsole if true -> while the output is stdout, records at or above Warn go to stderr instead, so data a CLI prints on stdout isn't mixed with warnings.
+	SampleField       string   // SampleField if set -> records are sampled per value of this field (e.g. "user_id"), so one hot value can't use up the budget of the others.
+	SampleFirst       int      // SampleFirst is the number of records per level and key kept in each SampleTick, defaults to 100; negative keeps none.
+	SampleThereafter  int      // SampleThereafter keeps every n-th record after SampleFirst, defaults to 100; negative drops all of them.
+	FieldAllowlist    []string // FieldAllowlist if not nil -> structured fields whose key is not listed are dropped before encoding.
+	RedactKeys        []string // RedactKeys lists the keys of structured fields whose value is replaced by Redacted before encoding, in every output; combined with FieldAllowlist a key must be allowed to be written at all.
+	LargeFieldSize    int      // LargeFieldSize if > 0 -> string and []byte field values over this many bytes are stored in LargeFieldFile and replaced by a reference.
+	LargeFieldFile    string   // LargeFieldFile names the files storing large field values, defaults to Filename + ".blobs"; they are written in segments such as app.log-2006-01-02T15-04-05.000.blobs, a new one started at MaxSize and MaxBackups old ones kept.
+	LogConfig         bool     // LogConfig if true -> New and SetOutput write the effective configuration as a single info record.
+	Lifecycle         bool     // Lifecycle if true -> the mmap output writes "logger started/rotated/stopped" records with version, pid, session and config hash.
+	CrashMarker       bool     // CrashMarker if true -> the mmap output keeps a "<Filename>.open" marker while open and recovers the file if it finds one left by a crash.
+	LazyOpen          bool     // LazyOpen if true -> the mmap output opens and maps its file on the first record instead of in New.
+	FileHeader        bool     // FileHeader if true and Encoding is "msgpack" -> every new file of the mmap output starts with a header recording the format version, encoding and compression. JSON and console files are line-oriented and never get one.
+	MmapSyncAsync     bool     // MmapSyncAsync if true -> Sync of the mmap output only schedules write-back (MS_ASYNC) instead of waiting for it.
+	MmapSyncFile      bool     // MmapSyncFile if true -> Sync of the mmap output also fsyncs the file, so its size and other metadata are durable too.
+	MmapPreallocate   bool     // MmapPreallocate if true -> the mmap output reserves disk blocks with fallocate when growing a file (Linux only).
+	MmapReserveFile   bool     // MmapReserveFile if true -> the mmap output reserves MaxSize on disk with fallocate when it opens a file, so a full disk is reported up front (Linux only).
+	MmapChunkSize     Size     // MmapChunkSize is the size in megabytes of each mapping of the mmap output, defaults to 10; larger chunks remap less often but leave more unwritten space mapped.
+	MmapAsyncBuffer   Size     // MmapAsyncBuffer if > 0 -> writes to the mmap output only copy records into a buffer of this many megabytes, a goroutine writes them to the file, so logging never waits for remapping, rotation or compression.
+	MmapAsyncOverflow string   // MmapAsyncOverflow handles a full MmapAsyncBuffer, value: "block" (default), "drop-oldest" or "drop-newest"; dropped bytes are reported by BufferStats.
+	MmapAdvice        string   // MmapAdvice is passed to madvise for every mapping, value: "sequential", "random", "willneed", "hugepage" or "nohugepage".
+
+	RetentionInterval time.Duration // RetentionInterval runs retention and compression periodically in addition to on rotation, 0 disables it.
+	RetentionJitter   float64       // RetentionJitter randomizes RetentionInterval and RetentionDebounce by this fraction, defaults to 0.2; negative disables it.
+	RetentionDebounce time.Duration // RetentionDebounce delays rotation-triggered retention runs, merging the runs triggered meanwhile.
+	InventoryRescan   time.Duration // InventoryRescan caches the list of backups between full directory scans, 0 scans on every retention run.
+	RouteIdleTimeout  time.Duration // RouteIdleTimeout closes routed files not written to for this long, they are reopened on their next record.
+	GoroutineInterval time.Duration // GoroutineInterval is the minimum time between two goroutine dumps of GoroutineFrames, defaults to 1m.
+	SinkStopTimeout   time.Duration // SinkStopTimeout bounds how long Close waits for Sinks to deliver their pending records, defaults to 10s.
+	SampleTick        time.Duration // SampleTick is the interval after which the sampling counts are reset, defaults to 1s.
+	RotationInterval  time.Duration // RotationInterval rotates the mmap output at every multiple of this interval in local time, e.g. time.Hour on the hour; backups are named after the start of the period they cover.
+	MmapFlushInterval time.Duration // MmapFlushInterval syncs the mmap output in the background at this interval, bounding what a crash can lose; 0 syncs only on Sync and Close.
+
+	MessageTransform MessageTransformer // MessageTransform if set -> rewrites every message before encoding.
+	SampleKey        SampleKeyFunc      // SampleKey if set -> extracts the sampling key instead of SampleField, enabling sampling.
+	FieldTransform   FieldTransformer   // FieldTransform if set -> rewrites every structured field before encoding, before LargeFieldSize applies.
+	Archiver         Archiver           // Archiver if set -> PreStopFlush uploads the sealed final segment of the mmap output with it.
+	Sinks            []Sink             // Sinks are started by New and stopped by Close after the output was flushed, see Sink.
+	Clock            zapcore.Clock      // Clock is the time source for record timestamps and rotation, defaults to the system clock.
+	OnError          func(error)        // OnError is called with non-fatal errors of the mmap output, such as external truncation.
+}
+
+// Validate reports settings of c that New cannot honour: an unknown Output
+// or Encoding. New reports them through OnError and falls back to console
+// output and the default encoding.
+func (c *Config) Validate() error {
+	var err error
+	if !c.Output.valid() {
+		err = multierr.Append(err, fmt.Errorf("not support output: %v", c.Output))
+	}
+	if c.Encoding != "" && encodingOf(c) != c.Encoding {
+		err = multierr.Append(err, fmt.Errorf("not support encoding: %v", c.Encoding))
+	}
+	return err
 }
 
 var (
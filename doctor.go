@@ -0,0 +1,120 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DoctorCheck is the result of a single environment check.
+type DoctorCheck struct {
+	Name   string // Name identifies the check, e.g. "disk_space".
+	OK     bool   // OK reports whether the check passed.
+	Detail string // Detail describes what was found.
+}
+
+// DoctorReport is the result of Doctor.
+type DoctorReport struct {
+	Checks []DoctorCheck
+}
+
+// OK reports whether every check passed.
+func (r *DoctorReport) OK() bool {
+	return r.Err() == nil
+}
+
+// Err returns an error listing the failed checks, or nil.
+func (r *DoctorReport) Err() error {
+	var failed []string
+	for _, c := range r.Checks {
+		if !c.OK {
+			failed = append(failed, c.Name+": "+c.Detail)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.New("log doctor: " + strings.Join(failed, "; "))
+}
+
+func (r *DoctorReport) add(name string, ok bool, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Doctor checks that the environment can hold the log files described by
+// config: the directory is writable, there is room for a full log file, the
+// filesystem supports shared writable mappings and the file size limit
+// (ulimit -f) does not cut files short. It changes nothing: a missing
+// directory fails the check and mappings are probed by mapping an existing
+// log file read-only.
+func Doctor(config *Config) *DoctorReport {
+	return doctor(config, false)
+}
+
+// DoctorFix is Doctor, but creates the directory if it is missing and
+// probes shared writable mappings through a temporary file in it.
+func DoctorFix(config *Config) *DoctorReport {
+	return doctor(config, true)
+}
+
+func doctor(config *Config, fix bool) *DoctorReport {
+	if config == nil {
+		config = defaultConfig
+	}
+	filename := config.Filename
+	if filename == "" {
+		filename = defaultFilename
+	}
+	maxSize := config.MaxSize
+	if config.MaxSizeText != 0 {
+		maxSize = int(config.MaxSizeText)
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	need := int64(maxSize) * 1024 * 1024
+	dir := filepath.Dir(filename)
+
+	r := &DoctorReport{}
+	if !fix {
+		if info, err := os.Stat(dir); err != nil {
+			r.add("directory", false, "%v", err)
+			return r
+		} else if !info.IsDir() {
+			r.add("directory", false, "%s is not a directory", dir)
+			return r
+		}
+		if err := checkWritable(dir); err != nil {
+			r.add("directory", false, "%s is not writable: %v", dir, err)
+		} else {
+			r.add("directory", true, "%s is writable", dir)
+		}
+		checkFilesystem(r, dir, need)
+		if config.Output == OutputMmap {
+			checkMmapReadOnly(r, filename)
+		}
+		return r
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		r.add("directory", false, "can't create %s: %v", dir, err)
+		return r
+	}
+	probe, err := os.CreateTemp(dir, ".log-doctor-*")
+	if err != nil {
+		r.add("directory", false, "%s is not writable: %v", dir, err)
+		return r
+	}
+	defer os.Remove(probe.Name())
+	defer probe.Close()
+	r.add("directory", true, "%s is writable", dir)
+
+	checkFilesystem(r, dir, need)
+
+	if config.Output == OutputMmap {
+		checkMmap(r, probe, dir)
+	}
+	return r
+}
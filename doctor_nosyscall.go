@@ -0,0 +1,38 @@
+//go:build nosyscall || !(unix || windows)
+
+package log
+
+import "os"
+
+// checkFilesystem can't query free space or the file size limit without the
+// syscall package or on platforms other than Unix and Windows, so both
+// checks are reported as skipped.
+func checkFilesystem(r *DoctorReport, dir string, need int64) {
+	r.add("disk_space", true, "not checked in this build, a full log file needs %d bytes", need)
+	r.add("file_size_limit", true, "not checked in this build")
+}
+
+// checkWritable returns an error if the permission bits of dir deny
+// writing.
+func checkWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// checkMmapReadOnly reports that mappings are emulated, as checkMmap.
+func checkMmapReadOnly(r *DoctorReport, filename string) {
+	checkMmap(r, nil, "")
+}
+
+// checkMmap reports that mappings are emulated with file I/O in nosyscall
+// builds and on platforms other than Unix and Windows, so no filesystem
+// support is required.
+func checkMmap(r *DoctorReport, f *os.File, dir string) {
+	r.add("mmap", true, "mappings are emulated with file I/O in this build")
+}
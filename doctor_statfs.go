@@ -0,0 +1,15 @@
+//go:build (aix || darwin || dragonfly || freebsd || linux) && !nosyscall
+
+package log
+
+import "golang.org/x/sys/unix"
+
+// diskAvailable returns the bytes available to unprivileged users on the
+// filesystem of dir.
+func diskAvailable(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
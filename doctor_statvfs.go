@@ -0,0 +1,15 @@
+//go:build (netbsd || solaris) && !nosyscall
+
+package log
+
+import "golang.org/x/sys/unix"
+
+// diskAvailable returns the bytes available to unprivileged users on the
+// filesystem of dir. These systems only have statvfs.
+func diskAvailable(dir string) (int64, error) {
+	var st unix.Statvfs_t
+	if err := unix.Statvfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Frsize), nil
+}
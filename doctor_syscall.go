@@ -0,0 +1,94 @@
+//go:build unix && !nosyscall
+
+package log
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkWritable returns an error unless the process may create files in
+// dir.
+func checkWritable(dir string) error {
+	return unix.Access(dir, unix.W_OK)
+}
+
+// checkMmapReadOnly reports whether the filesystem of filename supports
+// shared mappings by mapping the log file read-only. A missing or empty
+// log file is not probed.
+func checkMmapReadOnly(r *DoctorReport, filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		r.add("mmap", true, "not probed, %s can't be opened: %v", filename, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		r.add("mmap", true, "not probed, %s is empty", filename)
+		return
+	}
+	data, err := unix.Mmap(int(f.Fd()), 0, int(min(info.Size(), int64(os.Getpagesize()))), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		r.add("mmap", false, "filesystem of %s doesn't support shared mappings: %v", filename, err)
+		return
+	}
+	_ = unix.Munmap(data)
+	r.add("mmap", true, "shared mapping of %s works", filename)
+}
+
+// checkFilesystem reports whether the filesystem of dir has need bytes free
+// and whether the file size limit allows files of need bytes.
+func checkFilesystem(r *DoctorReport, dir string, need int64) {
+	if avail, err := diskAvailable(dir); err != nil {
+		r.add("disk_space", false, "statfs %s: %v", dir, err)
+	} else {
+		r.add("disk_space", avail >= need, "%d bytes available, a full log file needs %d", avail, need)
+	}
+
+	var lim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_FSIZE, &lim); err != nil {
+		r.add("file_size_limit", false, "getrlimit: %v", err)
+	} else if int64(lim.Cur) < 0 { // RLIM_INFINITY
+		r.add("file_size_limit", true, "unlimited")
+	} else {
+		r.add("file_size_limit", int64(lim.Cur) >= need, "limited to %d bytes, a full log file needs %d", lim.Cur, need)
+	}
+}
+
+// checkMmap reports whether the filesystem of dir supports shared writable
+// mappings, using the probe file f.
+func checkMmap(r *DoctorReport, f *os.File, dir string) {
+	if err := probeMmap(f); err != nil {
+		r.add("mmap", false, "filesystem of %s doesn't support shared mappings: %v", dir, err)
+	} else {
+		r.add("mmap", true, "shared writable mapping works")
+	}
+}
+
+// probeMmap maps one page of f, writes through the mapping and reads it
+// back from the file.
+func probeMmap(f *os.File) error {
+	size := os.Getpagesize()
+	if err := f.Truncate(int64(size)); err != nil {
+		return err
+	}
+	data, err := unix.Mmap(int(f.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	copy(data, "doctor")
+	if err := unix.Munmap(data); err != nil {
+		return err
+	}
+	buf := make([]byte, 6)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		return err
+	}
+	if string(buf) != "doctor" {
+		return errors.New("data written through the mapping did not reach the file")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// check returns the check of r named name.
+func check(t *testing.T, r *DoctorReport, name string) DoctorCheck {
+	t.Helper()
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no %s check in %+v", name, r.Checks)
+	return DoctorCheck{}
+}
+
+func TestDoctorReadOnly(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	config := &Config{Output: OutputMmap, Filename: filepath.Join(dir, "app.log")}
+	if c := check(t, Doctor(config), "directory"); c.OK {
+		t.Fatalf("missing directory passed: %s", c.Detail)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("Doctor created the directory: %v", err)
+	}
+
+	if c := check(t, DoctorFix(config), "directory"); !c.OK {
+		t.Fatalf("DoctorFix: %s", c.Detail)
+	}
+	if err := os.WriteFile(config.Filename, []byte("record\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := Doctor(config)
+	if c := check(t, r, "directory"); !c.OK {
+		t.Fatalf("existing directory: %s", c.Detail)
+	}
+	if c := check(t, r, "mmap"); !c.OK {
+		t.Fatalf("mmap: %s", c.Detail)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("directory holds %d files after Doctor, want only the log file", len(entries))
+	}
+	if data, _ := os.ReadFile(config.Filename); string(data) != "record\n" {
+		t.Fatalf("Doctor changed the log file to %q", data)
+	}
+}
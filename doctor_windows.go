@@ -0,0 +1,85 @@
+//go:build windows && !nosyscall
+
+package log
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// checkFilesystem reports whether the volume of dir has need bytes free.
+// Windows has no file size limit like ulimit -f.
+func checkFilesystem(r *DoctorReport, dir string, need int64) {
+	var avail, total, free uint64
+	path, err := windows.UTF16PtrFromString(dir)
+	if err == nil {
+		err = windows.GetDiskFreeSpaceEx(path, &avail, &total, &free)
+	}
+	if err != nil {
+		r.add("disk_space", false, "GetDiskFreeSpaceEx %s: %v", dir, err)
+	} else {
+		r.add("disk_space", int64(avail) >= need, "%d bytes available, a full log file needs %d", avail, need)
+	}
+	r.add("file_size_limit", true, "unlimited")
+}
+
+// checkWritable returns an error if dir is read-only. Access control lists
+// are not evaluated.
+func checkWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// checkMmapReadOnly doesn't probe mappings on Windows, DoctorFix does.
+func checkMmapReadOnly(r *DoctorReport, filename string) {
+	r.add("mmap", true, "not probed without fix")
+}
+
+// checkMmap reports whether the volume of dir supports shared writable
+// mappings, using the probe file f.
+func checkMmap(r *DoctorReport, f *os.File, dir string) {
+	if err := probeMmap(f); err != nil {
+		r.add("mmap", false, "volume of %s doesn't support shared mappings: %v", dir, err)
+	} else {
+		r.add("mmap", true, "shared writable mapping works")
+	}
+}
+
+// probeMmap maps one page of f, writes through the mapping and reads it
+// back from the file.
+func probeMmap(f *os.File) error {
+	size := os.Getpagesize()
+	if err := f.Truncate(int64(size)); err != nil {
+		return err
+	}
+	mapping, err := windows.CreateFileMapping(windows.Handle(f.Fd()), nil, windows.PAGE_READWRITE, 0, uint32(size), nil)
+	if err != nil {
+		return os.NewSyscallError("CreateFileMapping", err)
+	}
+	defer windows.CloseHandle(mapping)
+	addr, err := windows.MapViewOfFile(mapping, windows.FILE_MAP_WRITE, 0, 0, uintptr(size))
+	if err != nil {
+		return os.NewSyscallError("MapViewOfFile", err)
+	}
+	copy(unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&addr))), size), "doctor")
+	if err := windows.UnmapViewOfFile(addr); err != nil {
+		return os.NewSyscallError("UnmapViewOfFile", err)
+	}
+	buf := make([]byte, 6)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		return err
+	}
+	if string(buf) != "doctor" {
+		return errors.New("data written through the mapping did not reach the file")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// EffectiveConfig returns a snapshot of the configuration the logger runs
+// with, after defaults were applied and including changes made by SetLevel
+// and SetOutput.
+func (l *zapLogger) EffectiveConfig() Config {
+	c := *l.effective.Load()
+	c.Level = l.GetLevel()
+	return c
+}
+
+// publishConfig stores a snapshot of l.config for EffectiveConfig.
+func (l *zapLogger) publishConfig() {
+	c := *l.config
+	l.effective.Store(&c)
+}
+
+// logEffectiveConfig writes the effective configuration as a single info
+// record, subject to the level and sampling like any other record.
+func (l *zapLogger) logEffectiveConfig() {
+	c := l.EffectiveConfig()
+	l.Info("effective config", zap.Object("config", &c))
+}
+
+// MarshalLogObject encodes the configuration as a structured field. Hooks
+// are reported by whether they are set.
+func (c *Config) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("level", c.Level.String())
+	enc.AddString("output", c.Output.String())
+	enc.AddString("filename", c.Filename)
+	enc.AddString("base_dir", c.BaseDir)
+	enc.AddInt("max_size_mb", c.MaxSize)
+	enc.AddInt("max_age_days", c.MaxAge)
+	enc.AddInt("max_backups", c.MaxBackups)
+	enc.AddBool("compress", c.Compress)
+	enc.AddBool("dev_mode", c.DevMode)
+	enc.AddBool("disable_stacktrace", c.DisableStacktrace)
+	enc.AddInt("max_record_size", c.MaxRecordSize)
+	enc.AddString("record_policy", c.RecordPolicy)
+	enc.AddBool("redirect_stderr", c.RedirectStderr)
+	enc.AddString("stderr_file", c.StderrFile)
+	enc.AddBool("lazy_open", c.LazyOpen)
+	enc.AddBool("lifecycle", c.Lifecycle)
+	enc.AddBool("crash_marker", c.CrashMarker)
+	enc.AddBool("mmap_sync_async", c.MmapSyncAsync)
+	enc.AddBool("mmap_sync_file", c.MmapSyncFile)
+	enc.AddDuration("mmap_flush_interval", c.MmapFlushInterval)
+	enc.AddBool("mmap_preallocate", c.MmapPreallocate)
+	enc.AddBool("mmap_reserve_file", c.MmapReserveFile)
+	enc.AddInt("mmap_chunk_size_mb", int(c.MmapChunkSize))
+	enc.AddString("mmap_advice", c.MmapAdvice)
+	enc.AddInt("mmap_async_buffer_mb", int(c.MmapAsyncBuffer))
+	enc.AddString("mmap_async_overflow", c.MmapAsyncOverflow)
+	enc.AddInt("recompress_after_days", int(c.RecompressAfter))
+	enc.AddInt("recompress_level", c.RecompressLevel)
+	enc.AddString("recompress_format", c.RecompressFormat)
+	enc.AddInt("compress_rate_limit", c.CompressRateLimit)
+	enc.AddBool("compress_nice", c.CompressNice)
+	enc.AddBool("refuse_symlink", c.RefuseSymlink)
+	enc.AddBool("detect_rotation", c.DetectRotation)
+	enc.AddDuration("retention_interval", c.RetentionInterval)
+	enc.AddFloat64("retention_jitter", c.RetentionJitter)
+	enc.AddDuration("retention_debounce", c.RetentionDebounce)
+	enc.AddDuration("inventory_rescan", c.InventoryRescan)
+	_ = enc.AddReflected("keep_patterns", c.KeepPatterns)
+	enc.AddString("quota_file", c.QuotaFile)
+	enc.AddInt("quota_size_mb", int(c.QuotaSize))
+	enc.AddString("rotate_schedule", c.RotateSchedule)
+	enc.AddDuration("rotation_interval", c.RotationInterval)
+	enc.AddString("compress_schedule", c.CompressSchedule)
+	enc.AddString("route_field", c.RouteField)
+	enc.AddString("route_filename", c.RouteFilename)
+	enc.AddInt("route_max_open", c.RouteMaxOpen)
+	enc.AddDuration("route_idle_timeout", c.RouteIdleTimeout)
+	enc.AddBool("sequence", c.Sequence)
+	enc.AddString("sequence_file", c.SequenceFile)
+	enc.AddBool("monotonic", c.Monotonic)
+	enc.AddInt("raw_buffer_size", c.RawBufferSize)
+	enc.AddString("caller_trim_prefix", c.CallerTrimPrefix)
+	enc.AddBool("structured_errors", c.StructuredErrors)
+	enc.AddBool("strict_keyvals", c.StrictKeyvals)
+	enc.AddBool("fingerprint", c.Fingerprint)
+	_ = enc.AddReflected("pprof_labels", c.PprofLabels)
+	enc.AddInt("goroutine_frames", c.GoroutineFrames)
+	enc.AddDuration("goroutine_interval", c.GoroutineInterval)
+	enc.AddDuration("sink_stop_timeout", c.SinkStopTimeout)
+	if c.SyncOnLevel != nil {
+		enc.AddString("sync_on_level", c.SyncOnLevel.String())
+	}
+	enc.AddBool("doctor", c.Doctor)
+	enc.AddString("encoding", encodingOf(c))
+	if c.StdoutLevel != nil {
+		enc.AddString("stdout_level", c.StdoutLevel.String())
+	}
+	_ = enc.AddReflected("stdout_fields", c.StdoutFields)
+	enc.AddBool("split_console", c.SplitConsole)
+	enc.AddBool("quiet", c.Quiet)
+	enc.AddString("sample_field", c.SampleField)
+	enc.AddInt("sample_first", c.SampleFirst)
+	enc.AddInt("sample_thereafter", c.SampleThereafter)
+	enc.AddDuration("sample_tick", c.SampleTick)
+	_ = enc.AddReflected("field_allowlist", c.FieldAllowlist)
+	_ = enc.AddReflected("redact_keys", c.RedactKeys)
+	enc.AddInt("large_field_size", c.LargeFieldSize)
+	enc.AddString("large_field_file", c.LargeFieldFile)
+	enc.AddBool("file_header", fileHeaderEnabled(c))
+	enc.AddBool("log_config", c.LogConfig)
+	enc.AddBool("message_transform", c.MessageTransform != nil)
+	enc.AddBool("sample_key", c.SampleKey != nil)
+	enc.AddBool("field_transform", c.FieldTransform != nil)
+	enc.AddBool("archiver", c.Archiver != nil)
+	enc.AddInt("sinks", len(c.Sinks))
+	enc.AddBool("clock", c.Clock != nil)
+	enc.AddBool("on_error", c.OnError != nil)
+	return nil
+}
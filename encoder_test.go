@@ -0,0 +1,97 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// goldenRecords is a fixed set of records covering the field types and
+// entry parts the encoders format differently.
+var goldenRecords = []struct {
+	ent    zapcore.Entry
+	fields []zapcore.Field
+}{
+	{
+		ent: zapcore.Entry{Level: zapcore.InfoLevel, Message: "request served"},
+		fields: []zapcore.Field{
+			zap.String("method", "GET"),
+			zap.Int("status", 200),
+			zap.Float64("ratio", 0.25),
+			zap.Bool("cached", false),
+			zap.Duration("latency", 1500*time.Millisecond),
+			zap.Strings("tags", []string{"a", "b"}),
+			zap.Binary("raw", []byte{0, 1, 0xff}),
+		},
+	},
+	{
+		ent: zapcore.Entry{Level: zapcore.WarnLevel, LoggerName: "db", Message: "slow query\twith \"quotes\" and ünïcode"},
+		fields: []zapcore.Field{
+			zap.Time("started", time.Date(2024, 2, 29, 23, 59, 59, 999000000, time.UTC)),
+			zap.Int64("rows", 0),
+			zap.Any("args", map[string]interface{}{"id": 7, "name": "x"}),
+		},
+	},
+	{
+		ent: zapcore.Entry{
+			Level:   zapcore.ErrorLevel,
+			Message: "write failed",
+			Stack:   "main.main\n\t/src/app/main.go:12",
+		},
+		fields: []zapcore.Field{
+			zap.Error(errors.New("disk full")),
+			zap.Uint8("zero", 0),
+		},
+	},
+}
+
+func TestEncoderGolden(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.FixedZone("", 8*3600))
+	caller := zapcore.EntryCaller{
+		Defined:  true,
+		File:     "/src/github.com/Reb1113/mmap_write_syncer/app/server.go",
+		Line:     42,
+		Function: "github.com/Reb1113/mmap_write_syncer/app.(*Server).handle",
+	}
+	for _, encoding := range []string{EncodingJSON, EncodingConsole, EncodingMsgpack} {
+		for _, devMode := range []bool{false, true} {
+			for _, trim := range []string{"", callerTrimAuto, "/src/github.com/Reb1113/"} {
+				config := &Config{Encoding: encoding, DevMode: devMode, CallerTrimPrefix: trim}
+				name := fmt.Sprintf("%s-dev=%t-trim=%s.golden", encoding, devMode, goldenName(trim))
+				t.Run(name, func(t *testing.T) {
+					enc := newEncoder(config)
+					var out []byte
+					for _, r := range goldenRecords {
+						ent := r.ent
+						ent.Time = at
+						ent.Caller = caller
+						buf, err := enc.EncodeEntry(ent, r.fields)
+						if err != nil {
+							t.Fatal(err)
+						}
+						out = append(out, buf.Bytes()...)
+						buf.Free()
+					}
+					testutil.Golden(t, name, out)
+				})
+			}
+		}
+	}
+}
+
+// goldenName names a CallerTrimPrefix in a golden file name.
+func goldenName(trim string) string {
+	switch trim {
+	case "":
+		return "short"
+	case callerTrimAuto:
+		return "auto"
+	default:
+		return "prefix"
+	}
+}
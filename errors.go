@@ -0,0 +1,174 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+
+	pkgerrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const maxErrorDepth = 16
+
+// stackTracer is implemented by errors from github.com/pkg/errors.
+type stackTracer interface {
+	StackTrace() pkgerrors.StackTrace
+}
+
+// callersError carries the program counters captured by WithStack.
+type callersError struct {
+	error
+	pcs []uintptr
+}
+
+func (e *callersError) Unwrap() error { return e.error }
+
+// WithStack annotates err with the stack of its caller so that structured
+// error encoding can emit it. It returns nil if err is nil.
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	return &callersError{error: err, pcs: pcs[:n]}
+}
+
+// errorObject encodes an error as an object holding its message and type,
+// its chain of causes and the deepest stack trace found in the chain.
+type errorObject struct {
+	err error
+}
+
+func (e errorObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	err := e.err
+	if c, ok := err.(*callersError); ok {
+		err = c.error
+	}
+	enc.AddString("msg", err.Error())
+	enc.AddString("type", fmt.Sprintf("%T", err))
+	_, joined := err.(interface{ Unwrap() []error })
+	if joined || errors.Unwrap(err) != nil {
+		if err := enc.AddArray("causes", causeArray{err}); err != nil {
+			return err
+		}
+	}
+	if stack := errorStack(e.err); len(stack) > 0 {
+		return enc.AddArray("stack", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, frame := range stack {
+				arr.AppendString(frame)
+			}
+			return nil
+		}))
+	}
+	return nil
+}
+
+// causeArray encodes the errors wrapped by err, outermost first. Errors
+// joined with errors.Join are encoded as nested objects.
+type causeArray struct {
+	err error
+}
+
+func (c causeArray) MarshalLogArray(arr zapcore.ArrayEncoder) error {
+	err := c.err
+	for depth := 0; depth < maxErrorDepth; depth++ {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				if err := arr.AppendObject(errorObject{e}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err = errors.Unwrap(err); err == nil {
+			return nil
+		}
+		if _, ok := err.(*callersError); ok {
+			continue
+		}
+		if err := arr.AppendObject(zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			enc.AddString("msg", err.Error())
+			enc.AddString("type", fmt.Sprintf("%T", err))
+			return nil
+		})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errorStack returns the frames of the deepest stack trace in err's chain,
+// as "function file:line".
+func errorStack(err error) []string {
+	var stack []string
+	for depth := 0; err != nil && depth < maxErrorDepth; depth++ {
+		switch e := err.(type) {
+		case stackTracer:
+			st := e.StackTrace()
+			pcs := make([]uintptr, len(st))
+			for i, f := range st {
+				pcs[i] = uintptr(f)
+			}
+			stack = frames(pcs)
+		case *callersError:
+			stack = frames(e.pcs)
+		}
+		err = errors.Unwrap(err)
+	}
+	return stack
+}
+
+func frames(pcs []uintptr) []string {
+	var stack []string
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		stack = append(stack, f.Function+" "+f.File+":"+strconv.Itoa(f.Line))
+		if !more {
+			return stack
+		}
+	}
+}
+
+// errorCore replaces error fields with structured error objects before
+// handing them to the wrapped core.
+type errorCore struct {
+	zapcore.Core
+}
+
+func (c *errorCore) With(fields []zapcore.Field) zapcore.Core {
+	return &errorCore{Core: c.Core.With(structuredErrors(fields))}
+}
+
+func (c *errorCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *errorCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, structuredErrors(fields))
+}
+
+func structuredErrors(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, f := range fields {
+		err, ok := f.Interface.(error)
+		if f.Type != zapcore.ErrorType || !ok {
+			continue
+		}
+		if out == nil {
+			out = append([]zapcore.Field(nil), fields...)
+		}
+		out[i] = zap.Object(f.Key, errorObject{err})
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
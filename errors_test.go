@@ -0,0 +1,51 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestStructuredErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, StructuredErrors: true})
+	l.Error("query failed", "error", fmt.Errorf("query: %w", WithStack(io.EOF)))
+	l.Error("load failed", "error", pkgerrors.Wrap(io.ErrUnexpectedEOF, "load"))
+	l.Error("both failed", "error", errors.Join(io.EOF, io.ErrClosedPipe))
+	l.Close()
+
+	records := decodeRecords(t, filename)
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+	for i, rec := range records[:2] {
+		obj, ok := rec["error"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("record %d: error = %#v, want an object", i, rec["error"])
+		}
+		causes, _ := obj["causes"].([]interface{})
+		if len(causes) == 0 {
+			t.Fatalf("record %d: error %v has no cause chain", i, obj)
+		}
+		last := causes[len(causes)-1].(map[string]interface{})
+		if last["msg"] != "EOF" && last["msg"] != "unexpected EOF" {
+			t.Errorf("record %d: innermost cause = %v, want the wrapped io error", i, last)
+		}
+		stack, _ := obj["stack"].([]interface{})
+		if len(stack) == 0 || !strings.Contains(stack[0].(string), "TestStructuredErrors") {
+			t.Errorf("record %d: stack %v doesn't start at the test", i, stack)
+		}
+	}
+	if first := records[0]["error"].(map[string]interface{}); first["msg"] != "query: EOF" {
+		t.Errorf("error msg = %v, want the full message", first["msg"])
+	}
+	joined := records[2]["error"].(map[string]interface{})
+	if causes, _ := joined["causes"].([]interface{}); len(causes) != 2 {
+		t.Errorf("joined error causes = %v, want both errors", joined["causes"])
+	}
+}
@@ -0,0 +1,42 @@
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Field is a typed key-value pair. Fields can be mixed with loose key-value
+// pairs in keyvals and are encoded without reflection or fmt.
+type Field = zapcore.Field
+
+// ObjectMarshaler is implemented by values encoding themselves as an
+// object. Such values are encoded structurally wherever they appear in
+// keyvals, without reflection.
+type ObjectMarshaler = zapcore.ObjectMarshaler
+
+// ArrayMarshaler is implemented by values encoding themselves as an array.
+type ArrayMarshaler = zapcore.ArrayMarshaler
+
+// ObjectEncoder and ArrayEncoder are the encoders handed to
+// ObjectMarshaler and ArrayMarshaler.
+type (
+	ObjectEncoder = zapcore.ObjectEncoder
+	ArrayEncoder  = zapcore.ArrayEncoder
+)
+
+// Any returns a Field for value with the cheapest encoding its type allows:
+// ObjectMarshaler and ArrayMarshaler values are encoded structurally, basic
+// types without allocation, anything else by reflection.
+func Any(key string, value interface{}) Field {
+	return zap.Any(key, value)
+}
+
+// Object returns a Field encoding value as an object.
+func Object(key string, value ObjectMarshaler) Field {
+	return zap.Object(key, value)
+}
+
+// Array returns a Field encoding value as an array.
+func Array(key string, value ArrayMarshaler) Field {
+	return zap.Array(key, value)
+}
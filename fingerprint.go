@@ -0,0 +1,65 @@
+package log
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const fingerprintKey = "fingerprint"
+
+// fingerprintCore adds a "fingerprint" field to error and more severe
+// records: a hash of the message with its numbers masked and of the calling
+// function, stable across processes and releases that don't move the call,
+// so downstream systems can group identical errors.
+type fingerprintCore struct {
+	zapcore.Core
+}
+
+func (c *fingerprintCore) With(fields []zapcore.Field) zapcore.Core {
+	return &fingerprintCore{Core: c.Core.With(fields)}
+}
+
+func (c *fingerprintCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *fingerprintCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level >= zapcore.ErrorLevel {
+		fields = append(fields[:len(fields):len(fields)], zap.String(fingerprintKey, fingerprint(ent)))
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// fingerprint hashes the message template, approximated by masking the
+// digits of the message as Errorf formats them in, and the top stack frame.
+func fingerprint(ent zapcore.Entry) string {
+	h := fnv.New64a()
+	digits := false
+	for i := 0; i < len(ent.Message); i++ {
+		b := ent.Message[i]
+		if b >= '0' && b <= '9' {
+			if !digits {
+				h.Write([]byte{'#'})
+			}
+			digits = true
+			continue
+		}
+		digits = false
+		h.Write([]byte{b})
+	}
+	h.Write([]byte{0})
+	if ent.Caller.Defined {
+		if ent.Caller.Function != "" {
+			h.Write([]byte(ent.Caller.Function))
+		} else {
+			h.Write([]byte(ent.Caller.File))
+		}
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
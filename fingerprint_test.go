@@ -0,0 +1,43 @@
+package log
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func lookupFailed(l Logger, id int) { l.Error(fmt.Sprintf("user %d not found", id)) }
+
+func otherLookupFailed(l Logger, id int) { l.Error(fmt.Sprintf("user %d not found", id)) }
+
+func TestFingerprint(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, Fingerprint: true})
+	lookupFailed(l, 42)
+	lookupFailed(l, 7)
+	otherLookupFailed(l, 42)
+	l.Error("disk full")
+	l.Warn("no fingerprint below error")
+	l.Close()
+
+	records := decodeRecords(t, filename)
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5", len(records))
+	}
+	fp := make([]string, len(records))
+	for i, rec := range records {
+		fp[i], _ = rec[fingerprintKey].(string)
+	}
+	if fp[0] == "" || fp[0] != fp[1] {
+		t.Errorf("same call with different numbers: %q and %q, want one fingerprint", fp[0], fp[1])
+	}
+	if fp[2] == fp[0] {
+		t.Errorf("another calling function got the same fingerprint %q", fp[2])
+	}
+	if fp[3] == "" || fp[3] == fp[0] {
+		t.Errorf("another message got fingerprint %q", fp[3])
+	}
+	if fp[4] != "" {
+		t.Errorf("warn record got fingerprint %q", fp[4])
+	}
+}
@@ -3,12 +3,16 @@ module github.com/Reb1113/mmap_write_syncer
 go 1.21.4
 
 require (
+	github.com/pkg/errors v0.9.1
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	go.uber.org/multierr v1.10.0
 	go.uber.org/zap v1.21.0
+	golang.org/x/sys v0.12.0
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
 
 require (
 	github.com/BurntSushi/toml v1.4.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
-	go.uber.org/multierr v1.10.0 // indirect
 )
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	goroutinesKey            = "goroutines"
+	defaultGoroutineInterval = time.Minute
+	maxGoroutineDump         = 64 << 20 // maxGoroutineDump bounds the buffer for runtime.Stack
+)
+
+// goroutineCore attaches the top frames of every goroutine to error and
+// more severe records, at most once per interval, to help debug deadlocks
+// from the logs alone. The dump stops the world briefly, hence the limit.
+type goroutineCore struct {
+	zapcore.Core
+	frames   int
+	interval time.Duration
+	last     *atomic.Int64 // last is the UnixNano time of the last dump
+}
+
+func newGoroutineCore(core zapcore.Core, config *Config) *goroutineCore {
+	interval := config.GoroutineInterval
+	if interval <= 0 {
+		interval = defaultGoroutineInterval
+	}
+	return &goroutineCore{Core: core, frames: config.GoroutineFrames, interval: interval, last: &atomic.Int64{}}
+}
+
+func (c *goroutineCore) With(fields []zapcore.Field) zapcore.Core {
+	return &goroutineCore{Core: c.Core.With(fields), frames: c.frames, interval: c.interval, last: c.last}
+}
+
+func (c *goroutineCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *goroutineCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level >= zapcore.ErrorLevel && c.due() {
+		fields = append(fields[:len(fields):len(fields)], zap.Strings(goroutinesKey, goroutineFrames(c.frames)))
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// due reports whether a dump may be taken now, claiming it if so.
+func (c *goroutineCore) due() bool {
+	now := time.Now().UnixNano()
+	last := c.last.Load()
+	if last != 0 && now-last < int64(c.interval) {
+		return false
+	}
+	return c.last.CompareAndSwap(last, now)
+}
+
+// goroutineFrames returns one line per goroutine: its header, such as
+// "goroutine 7 [chan receive, 5 minutes]", followed by its top n frames.
+func goroutineFrames(n int) []string {
+	buf := make([]byte, 64<<10)
+	for {
+		size := runtime.Stack(buf, true)
+		if size < len(buf) || len(buf) >= maxGoroutineDump {
+			buf = buf[:size]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	var dumps []string
+	for _, block := range bytes.Split(buf, []byte("\n\n")) {
+		lines := strings.Split(strings.TrimSpace(string(block)), "\n")
+		if len(lines) == 0 || lines[0] == "" {
+			continue
+		}
+		var b strings.Builder
+		b.WriteString(strings.TrimSuffix(lines[0], ":"))
+		// Frames take two lines: the function, then its file and line.
+		for i := 1; i+1 < len(lines) && i < 1+2*n; i += 2 {
+			b.WriteString(" <- ")
+			b.WriteString(lines[i])
+			b.WriteString(" ")
+			b.WriteString(strings.TrimSpace(lines[i+1]))
+		}
+		dumps = append(dumps, b.String())
+	}
+	return dumps
+}
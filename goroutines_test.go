@@ -0,0 +1,51 @@
+package log
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockedForDump blocks until release is closed, for the goroutine dump.
+func blockedForDump(release chan struct{}) {
+	<-release
+}
+
+func TestGoroutineFrames(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	go blockedForDump(release)
+	time.Sleep(10 * time.Millisecond) // let it block
+
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, GoroutineFrames: 2, GoroutineInterval: time.Hour})
+	l.Info("no dump below error")
+	l.Error("deadlock suspected")
+	l.Error("rate limited")
+	l.Close()
+
+	records := decodeRecords(t, filename)
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+	for _, i := range []int{0, 2} {
+		if _, ok := records[i][goroutinesKey]; ok {
+			t.Errorf("record %q has %s", records[i]["msg"], goroutinesKey)
+		}
+	}
+	dumps, _ := records[1][goroutinesKey].([]interface{})
+	var blocked string
+	for _, d := range dumps {
+		s, _ := d.(string)
+		if strings.Contains(s, "blockedForDump") {
+			blocked = s
+		}
+		if frames := strings.Count(s, " <- "); frames > 2 {
+			t.Errorf("dump has %d frames, want at most 2: %s", frames, s)
+		}
+	}
+	if !strings.HasPrefix(blocked, "goroutine ") || !strings.Contains(blocked, "[chan receive") {
+		t.Fatalf("no dump of the blocked goroutine in %v", dumps)
+	}
+}
@@ -0,0 +1,179 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileHeaderVersion is the version of the file header written by New.
+const FileHeaderVersion = 1
+
+// fileHeaderMagic starts every file header. Version 1 headers are the
+// magic, the version as a decimal digit, the encoding as a letter, '1' or
+// '0' for the compression flag and a newline, 8 bytes in total. The header
+// is plain text without NUL bytes, so tools stopping at the mmap padding or
+// reading line by line see it as a single line.
+const (
+	fileHeaderMagic = "MWSL"
+	fileHeaderSize  = 8
+)
+
+// headerEncodings maps the encodings to their letter in the file header.
+var headerEncodings = map[string]byte{EncodingJSON: 'j', EncodingConsole: 'c', EncodingMsgpack: 'm'}
+
+// FileHeader describes the format of the records in a log file. It is
+// written at the start of every file of the mmap output when
+// Config.FileHeader is set and the records are framed, see
+// fileHeaderEnabled.
+type FileHeader struct {
+	Version    int    // Version is the header format version.
+	Encoding   string // Encoding is the record encoding: "json", "console" or "msgpack".
+	Compressed bool   // Compressed if true -> backups of the file are gzip compressed once rotated.
+}
+
+// fileHeader returns the header describing the files written with config.
+func fileHeader(config *Config) FileHeader {
+	return FileHeader{Version: FileHeaderVersion, Encoding: encodingOf(config), Compressed: config.Compress}
+}
+
+// fileHeaderEnabled reports whether the files written with config start
+// with a header. Only msgpack records are framed, line-oriented readers of
+// JSON and console files would take the header for a record.
+func fileHeaderEnabled(config *Config) bool {
+	return config.FileHeader && encodingOf(config) == EncodingMsgpack
+}
+
+// MarshalBinary encodes h in the current header version.
+func (h FileHeader) MarshalBinary() ([]byte, error) {
+	enc, ok := headerEncodings[h.Encoding]
+	if !ok {
+		return nil, fmt.Errorf("not support encoding: %v", h.Encoding)
+	}
+	compressed := byte('0')
+	if h.Compressed {
+		compressed = '1'
+	}
+	return append([]byte(fileHeaderMagic), '0'+FileHeaderVersion, enc, compressed, '\n'), nil
+}
+
+// UnmarshalBinary decodes a header encoded by MarshalBinary.
+func (h *FileHeader) UnmarshalBinary(b []byte) error {
+	if len(b) != fileHeaderSize || string(b[:len(fileHeaderMagic)]) != fileHeaderMagic || b[fileHeaderSize-1] != '\n' {
+		return fmt.Errorf("not a file header: %q", b)
+	}
+	version := int(b[4]) - '0'
+	if version != FileHeaderVersion {
+		return fmt.Errorf("not support file header version: %q", b[4])
+	}
+	*h = FileHeader{Version: version}
+	for e, letter := range headerEncodings {
+		if letter == b[5] {
+			h.Encoding = e
+		}
+	}
+	if h.Encoding == "" {
+		return fmt.Errorf("not support encoding in file header: %q", b[5])
+	}
+	switch b[6] {
+	case '0':
+	case '1':
+		h.Compressed = true
+	default:
+		return fmt.Errorf("invalid compression flag in file header: %q", b[6])
+	}
+	return nil
+}
+
+// readFileHeader consumes the header at the start of br, if any.
+func readFileHeader(br *bufio.Reader) (FileHeader, bool, error) {
+	b, err := br.Peek(fileHeaderSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return FileHeader{}, false, err
+	}
+	if len(b) < fileHeaderSize || string(b[:len(fileHeaderMagic)]) != fileHeaderMagic {
+		return FileHeader{}, false, nil
+	}
+	var h FileHeader
+	if err := h.UnmarshalBinary(b); err != nil {
+		return h, true, err
+	}
+	_, err = br.Discard(fileHeaderSize)
+	return h, true, err
+}
+
+// ReadFileHeader returns the header of the log file name, which may be a
+// gzip compressed backup. ok is false if the file has no header.
+func ReadFileHeader(name string) (h FileHeader, ok bool, err error) {
+	f, err := openLogFile(name)
+	if err != nil {
+		return h, false, err
+	}
+	defer f.Close()
+	return readFileHeader(bufio.NewReader(f))
+}
+
+// UpgradeFile rewrites the log file name, which may be a gzip compressed
+// backup, so that it starts with h encoded in the current header version.
+// An existing header is replaced and trailing NUL padding is dropped. It
+// must not be used on a file that is still being written.
+func UpgradeFile(name string, h FileHeader) error {
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	f, err := openLogFile(name)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(f)
+	_, _, err = readFileHeader(br)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	body, err := io.ReadAll(br)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	body = bytes.TrimRight(body, "\x00")
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".upgrade-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	var w io.Writer = tmp
+	var gz *gzip.Writer
+	if strings.HasSuffix(name, ".gz") {
+		gz = gzip.NewWriter(tmp)
+		w = gz
+	}
+	_, err = w.Write(header)
+	if err == nil {
+		_, err = w.Write(body)
+	}
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = tmp.Chmod(info.Mode())
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
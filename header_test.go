@@ -0,0 +1,79 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileHeaderRoundTrip(t *testing.T) {
+	for _, encoding := range []string{EncodingJSON, EncodingConsole, EncodingMsgpack} {
+		for _, compressed := range []bool{false, true} {
+			h := FileHeader{Version: FileHeaderVersion, Encoding: encoding, Compressed: compressed}
+			b, err := h.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != fileHeaderSize || bytes.IndexByte(b, 0) >= 0 || bytes.IndexByte(b, '\n') != len(b)-1 {
+				t.Fatalf("%+v encodes to %q, want %d bytes without NUL ending in a newline", h, b, fileHeaderSize)
+			}
+			var got FileHeader
+			if err := got.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if got != h {
+				t.Fatalf("%q decodes to %+v, want %+v", b, got, h)
+			}
+		}
+	}
+	for _, bad := range []string{"MWSL1j0", "MWSL2j0\n", "MWSL1x0\n", "MWSL1j2\n", "XXXX1j0\n"} {
+		var h FileHeader
+		if err := h.UnmarshalBinary([]byte(bad)); err == nil {
+			t.Errorf("%q decoded to %+v", bad, h)
+		}
+	}
+}
+
+func TestFileHeaderOnlyForFramedRecords(t *testing.T) {
+	dir := t.TempDir()
+	for _, encoding := range []string{EncodingJSON, EncodingMsgpack} {
+		filename := filepath.Join(dir, encoding+".log")
+		l := New(&Config{Output: OutputMmap, Filename: filename, Encoding: encoding, FileHeader: true})
+		l.Info("first")
+		l.Close()
+
+		h, ok, err := ReadFileHeader(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := encoding == EncodingMsgpack; ok != want {
+			t.Fatalf("%s file has a header: %t, want %t", encoding, ok, want)
+		}
+		if ok && h.Encoding != encoding {
+			t.Fatalf("%s file header records encoding %q", encoding, h.Encoding)
+		}
+	}
+}
+
+func TestUpgradeFileAddsHeader(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "old.log")
+	if err := os.WriteFile(filename, []byte("{\"msg\":\"a\"}\n\x00\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := FileHeader{Version: FileHeaderVersion, Encoding: EncodingJSON}
+	if err := UpgradeFile(filename, want); err != nil {
+		t.Fatal(err)
+	}
+	h, ok, err := ReadFileHeader(filename)
+	if err != nil || !ok || h != want {
+		t.Fatalf("ReadFileHeader = %+v, %t, %v, want %+v", h, ok, err, want)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "MWSL1j0\n{\"msg\":\"a\"}\n" {
+		t.Fatalf("upgraded file = %q", got)
+	}
+}
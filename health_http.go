@@ -0,0 +1,36 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HealthHandler returns an http.Handler reporting the health of the sinks
+// of l, e.g. for a readiness probe. GET returns
+// {"healthy":true,"sinks":[{"name":"...","healthy":true}]}, with status 503
+// if any sink is unhealthy. A logger that does not implement Inspector
+// reports no sinks.
+func HealthHandler(l Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var sinks []SinkStatus
+		if i, ok := l.(interface{ SinkHealth() []SinkStatus }); ok {
+			sinks = i.SinkHealth()
+		}
+		healthy := true
+		for _, s := range sinks {
+			healthy = healthy && s.Healthy
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(struct {
+			Healthy bool         `json:"healthy"`
+			Sinks   []SinkStatus `json:"sinks"`
+		}{healthy, sinks})
+	})
+}
@@ -0,0 +1,71 @@
+package log
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const missingValue = "missing_value"
+
+// repairKeyvals pairs every key of keyvals with a value: a dangling last key
+// gets "missing_value" and a key that is not a string is converted with
+// fmt.Sprint. Fields built with zap are kept as they are. It returns
+// keyvals itself when it is well-formed, and describes each repair in
+// problems.
+func repairKeyvals(keyvals []interface{}) (repaired []interface{}, problems []string) {
+	for i := 0; i < len(keyvals); {
+		switch keyvals[i].(type) {
+		case zapcore.Field:
+			i++
+			continue
+		case string:
+			if i+1 < len(keyvals) {
+				i += 2
+				continue
+			}
+		}
+		return repairFrom(keyvals, i)
+	}
+	return keyvals, nil
+}
+
+// repairFrom repairs keyvals, which is well-formed before i.
+func repairFrom(keyvals []interface{}, i int) (repaired []interface{}, problems []string) {
+	repaired = append(make([]interface{}, 0, len(keyvals)+1), keyvals[:i]...)
+	for i < len(keyvals) {
+		key := keyvals[i]
+		if f, ok := key.(zapcore.Field); ok {
+			repaired = append(repaired, f)
+			i++
+			continue
+		}
+		s, ok := key.(string)
+		if !ok {
+			s = fmt.Sprint(key)
+			problems = append(problems, fmt.Sprintf("non-string key %T(%v) at position %d", key, key, i))
+		}
+		if i+1 >= len(keyvals) {
+			problems = append(problems, fmt.Sprintf("key %q without a value", s))
+			repaired = append(repaired, s, missingValue)
+			break
+		}
+		repaired = append(repaired, s, keyvals[i+1])
+		i += 2
+	}
+	return repaired, problems
+}
+
+// keyvals returns keyvals repaired under StrictKeyvals, reporting malformed
+// lists with a DPanic record, which panics in DevMode.
+func (l *zapLogger) keyvals(keyvals []interface{}) []interface{} {
+	if !l.config.StrictKeyvals {
+		return keyvals
+	}
+	repaired, problems := repairKeyvals(keyvals)
+	if len(problems) > 0 {
+		l.logger.Desugar().WithOptions(zap.AddCallerSkip(1)).Sugar().DPanicw("malformed keyvals", "problems", problems)
+	}
+	return repaired
+}
@@ -0,0 +1,168 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRepairKeyvals(t *testing.T) {
+	field := zap.Int("n", 1)
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name     string
+		keyvals  []interface{}
+		want     []interface{}
+		problems int
+	}{
+		{"empty", nil, nil, 0},
+		{"pairs", []interface{}{"a", 1, "b", "x"}, []interface{}{"a", 1, "b", "x"}, 0},
+		{"fields mixed with pairs", []interface{}{field, "a", 1}, []interface{}{field, "a", 1}, 0},
+		{"dangling key", []interface{}{"a", 1, "b"}, []interface{}{"a", 1, "b", missingValue}, 1},
+		{"value without key", []interface{}{errBoom}, []interface{}{"boom", missingValue}, 2},
+		{"non-string key", []interface{}{42, "x", "a", 1}, []interface{}{"42", "x", "a", 1}, 1},
+		{"field as value", []interface{}{"a", field}, []interface{}{"a", field}, 0},
+		{"field before dangling key", []interface{}{field, "a"}, []interface{}{field, "a", missingValue}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problems := repairKeyvals(tt.keyvals)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repairKeyvals(%v) = %v, want %v", tt.keyvals, got, tt.want)
+			}
+			if len(problems) != tt.problems {
+				t.Errorf("repairKeyvals(%v) problems = %q, want %d", tt.keyvals, problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestStrictKeyvals(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "strict.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, StrictKeyvals: true, DisableStacktrace: true})
+	l.With("tenant").Info("request", "user")
+	l.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{`"msg":"malformed keyvals"`, `"tenant":"missing_value"`, `"user":"missing_value"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output lacks %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestStrictKeyvalsPanicsInDevMode(t *testing.T) {
+	l := New(&Config{Output: OutputConsole, DevMode: true, StrictKeyvals: true})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("malformed keyvals did not panic in DevMode")
+		}
+	}()
+	l.Info("request", "user")
+}
+
+type testUser struct {
+	name  string
+	roles []string
+}
+
+func (u testUser) MarshalLogObject(enc ObjectEncoder) error {
+	enc.AddString("name", u.name)
+	return enc.AddArray("roles", testRoles(u.roles))
+}
+
+type testRoles []string
+
+func (r testRoles) MarshalLogArray(enc ArrayEncoder) error {
+	for _, role := range r {
+		enc.AppendString(role)
+	}
+	return nil
+}
+
+func TestMarshalerKeyvals(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "marshaler.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, StrictKeyvals: true})
+	u := testUser{name: "bob", roles: []string{"admin", "dev"}}
+	l.Info("loose", "user", u, "roles", testRoles(u.roles))
+	l.Info("fields", Object("user", u), Array("roles", testRoles(u.roles)), Any("any", u))
+	l.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		`"msg":"loose","user":{"name":"bob","roles":["admin","dev"]},"roles":["admin","dev"]`,
+		`"msg":"fields","user":{"name":"bob","roles":["admin","dev"]},"roles":["admin","dev"],"any":{"name":"bob","roles":["admin","dev"]}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output lacks %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestWithAndChild(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "with.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename})
+	child := Child(l, "tenant", "acme")
+	child.Info("from child")
+	l.Info("before With")
+	l.With("service", "api") // the return value is ignored on purpose
+	l.Info("after With")
+	l.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d records, want 3:\n%s", len(lines), data)
+	}
+	checks := []struct {
+		want, unwanted string
+	}{
+		{`"tenant":"acme"`, `"service"`},
+		{`"msg":"before With"`, `"tenant"`},
+		{`"service":"api"`, `"tenant"`},
+	}
+	for i, c := range checks {
+		if !strings.Contains(lines[i], c.want) || strings.Contains(lines[i], c.unwanted) {
+			t.Errorf("record %d = %s, want %s without %s", i, lines[i], c.want, c.unwanted)
+		}
+	}
+}
+
+func TestLazy(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "lazy.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, Level: LevelInfo})
+	calls := 0
+	value := Lazy(func() interface{} {
+		calls++
+		return "expensive"
+	})
+	l.Debug("disabled", "dump", value)
+	if calls != 0 {
+		t.Fatalf("closure called %d times for a record below the level", calls)
+	}
+	l.Info("enabled", "dump", value)
+	l.Close()
+	if calls != 1 {
+		t.Fatalf("closure called %d times for one enabled record, want 1", calls)
+	}
+	out := readRecords(t, filename)
+	if strings.Contains(out, "disabled") || !strings.Contains(out, `"dump":"expensive"`) {
+		t.Fatalf("log output:\n%s", out)
+	}
+}
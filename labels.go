@@ -0,0 +1,38 @@
+package log
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// WithPprofLabels returns a child of l carrying the runtime/pprof labels on
+// ctx that Config.PprofLabels lists, so code that already labels its work
+// for profiling gets correlated records, e.g. in an HTTP handler:
+//
+//	pprof.Do(r.Context(), pprof.Labels("request_id", id), func(ctx context.Context) {
+//		log.WithPprofLabels(ctx, logger).Info("handling request")
+//	})
+//
+// Labels missing on ctx are skipped. Loggers not created by New, or
+// without PprofLabels, are returned unchanged.
+func WithPprofLabels(ctx context.Context, l Logger) Logger {
+	if p, ok := l.(interface {
+		withPprofLabels(ctx context.Context) Logger
+	}); ok {
+		return p.withPprofLabels(ctx)
+	}
+	return l
+}
+
+func (l *zapLogger) withPprofLabels(ctx context.Context) Logger {
+	var keyvals []interface{}
+	for _, key := range l.config.PprofLabels {
+		if value, ok := pprof.Label(ctx, key); ok {
+			keyvals = append(keyvals, key, value)
+		}
+	}
+	if len(keyvals) == 0 {
+		return l
+	}
+	return l.Child(keyvals...)
+}
@@ -0,0 +1,48 @@
+package log
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+func TestPprofLabels(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "labels.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, PprofLabels: []string{"request_id", "handler"}})
+	WithPprofLabels(context.Background(), l).Info("unlabeled")
+	labels := pprof.Labels("request_id", "r-42", "handler", "checkout", "secret", "x")
+	pprof.Do(context.Background(), labels, func(ctx context.Context) {
+		labeled := WithPprofLabels(ctx, l)
+		labeled.Info("labeled")
+		labeled.With("child", true).Info("child")
+	})
+	l.Info("parent") // the labels stay on the child
+	l.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d records, want 4:\n%s", len(lines), data)
+	}
+	for _, i := range []int{0, 3} {
+		if strings.Contains(lines[i], "request_id") {
+			t.Errorf("unlabeled record has labels: %s", lines[i])
+		}
+	}
+	for _, line := range lines[1:3] {
+		for _, want := range []string{`"request_id":"r-42"`, `"handler":"checkout"`} {
+			if !strings.Contains(line, want) {
+				t.Errorf("record lacks %s: %s", want, line)
+			}
+		}
+		if strings.Contains(line, "secret") {
+			t.Errorf("record has an unlisted label: %s", line)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package log
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// LazyValue is a field value computed only when the record is encoded, see
+// Lazy.
+type LazyValue struct {
+	once  sync.Once
+	fn    func() interface{}
+	value interface{}
+}
+
+// Lazy returns a field value for keyvals that calls fn only when the record
+// is encoded, after it passed the level check, sampling and the field
+// allowlist, so expensive values cost nothing in suppressed records. fn is
+// called at most once even when the record goes to several outputs.
+func Lazy(fn func() interface{}) *LazyValue {
+	return &LazyValue{fn: fn}
+}
+
+// Value returns the result of fn, calling it on first use.
+func (v *LazyValue) Value() interface{} {
+	v.once.Do(func() {
+		v.value = v.fn()
+	})
+	return v.value
+}
+
+// MarshalJSON encodes the value for the JSON and console encodings.
+func (v *LazyValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value())
+}
+
+// MarshalMsgpack encodes the value for the msgpack encoding.
+func (v *LazyValue) MarshalMsgpack() ([]byte, error) {
+	return msgpack.Marshal(v.Value())
+}
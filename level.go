@@ -44,3 +44,18 @@ func (lvl *Level) UnmarshalText(text []byte) error {
 	*lvl = level
 	return nil
 }
+
+// String returns the lower-case name of the level.
+func (lvl Level) String() string {
+	for name, l := range levelMap {
+		if l == lvl {
+			return name
+		}
+	}
+	return fmt.Sprintf("Level(%d)", int(lvl))
+}
+
+// MarshalText Marshal the level to text.
+func (lvl Level) MarshalText() ([]byte, error) {
+	return []byte(lvl.String()), nil
+}
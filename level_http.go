@@ -0,0 +1,57 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// LevelHandler returns an http.Handler reporting and changing the level of
+// l. GET returns {"level":"info"}. PUT or POST with a "level" parameter sets
+// it; with an additional "duration" parameter such as "5m" the level only
+// holds for that long, as with SetLevelFor. A logger that does not
+// implement LevelController gets 501 Not Implemented.
+func LevelHandler(l Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := l.(LevelController)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var lvl Level
+			if err := lvl.UnmarshalText([]byte(r.FormValue("level"))); err != nil {
+				writeLevelError(w, err)
+				return
+			}
+			if d := r.FormValue("duration"); d != "" {
+				duration, err := time.ParseDuration(d)
+				if err != nil || duration <= 0 {
+					writeLevelError(w, errInvalidDuration(d))
+					return
+				}
+				c.SetLevelFor(lvl, duration)
+			} else {
+				l.SetLevel(lvl)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]Level{"level": c.GetLevel()})
+	})
+}
+
+type errInvalidDuration string
+
+func (e errInvalidDuration) Error() string {
+	return "invalid duration: " + string(e)
+}
+
+func writeLevelError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
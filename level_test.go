@@ -0,0 +1,93 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetLevelForConcurrentLogging(t *testing.T) {
+	config := &Config{Output: OutputConsole, Level: LevelError}
+	l := New(config).(*zapLogger)
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					l.Debug("hidden")
+					_ = l.GetLevel()
+					_ = l.EffectiveConfig()
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		l.SetLevelFor(LevelFatal, time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	l.SetLevelFor(LevelFatal, time.Hour)
+	l.SetLevelFor(LevelPanic, 10*time.Millisecond) // replaces the window, still reverts to Error
+	if got := l.GetLevel(); got != LevelPanic {
+		t.Fatalf("level in window = %v, want panic", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for l.GetLevel() != LevelError {
+		if time.Now().After(deadline) {
+			t.Fatalf("level after window = %v, want error", l.GetLevel())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if config.Level != LevelError {
+		t.Fatalf("Config.Level changed to %v", config.Level)
+	}
+	if got := l.EffectiveConfig().Level; got != LevelError {
+		t.Fatalf("effective level = %v, want error", got)
+	}
+}
+
+func TestConfigLevelChangeApplies(t *testing.T) {
+	config := &Config{Output: OutputConsole, Level: LevelError}
+	l := New(config).(*zapLogger)
+	defer l.Close()
+	l.SetLevelFor(LevelFatal, time.Hour)
+	config.Level = LevelWarn
+	l.Info("applies the change")
+	if got := l.GetLevel(); got != LevelWarn {
+		t.Fatalf("level = %v after changing Config.Level, want warn", got)
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	l := New(&Config{Output: OutputConsole, Level: LevelError})
+	defer l.Close()
+	h := LevelHandler(l)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/level?level=debug&duration=1h", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"debug"`) {
+		t.Fatalf("PUT = %d %s, want the new level", rec.Code, rec.Body)
+	}
+	if got := l.(LevelController).GetLevel(); got != LevelDebug {
+		t.Fatalf("level = %v, want debug", got)
+	}
+
+	rec = httptest.NewRecorder()
+	LevelHandler(struct{ Logger }{l}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/level", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("GET on a logger without LevelController = %d, want 501", rec.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package log
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"runtime/debug"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const lifecycleKey = "lifecycle"
+
+// lifecycleMessages are the messages of the records written for each
+// lifecycle event of an mmap log file.
+var lifecycleMessages = map[string]string{
+	logger.LifecycleOpen:    "logger started",
+	logger.LifecycleRotate:  "logger rotated",
+	logger.LifecycleClose:   "logger stopped",
+	logger.LifecycleRecover: "recovered after crash",
+}
+
+// session identifies this process in lifecycle records. Together with the
+// pid it pairs every "logger started" record with its "logger stopped"
+// record; a start without a matching stop marks an unclean shutdown.
+var session = newSession()
+
+func newSession() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// lifecycleRecorder encodes the lifecycle records of the mmap output with
+// the same encoder as regular records.
+type lifecycleRecorder struct {
+	enc    zapcore.Encoder
+	clock  zapcore.Clock
+	fields []zapcore.Field
+}
+
+func newLifecycleRecorder(config *Config) *lifecycleRecorder {
+	var clock zapcore.Clock = zapcore.DefaultClock
+	if config.Clock != nil {
+		clock = config.Clock
+	}
+	return &lifecycleRecorder{
+		enc:   newEncoder(config),
+		clock: clock,
+		fields: []zapcore.Field{
+			zap.String("version", moduleVersion()),
+			zap.Int("pid", os.Getpid()),
+			zap.String("session", session),
+			zap.String("config_hash", configHash(config)),
+		},
+	}
+}
+
+// record returns the encoded record for e.
+func (r *lifecycleRecorder) record(e logger.LifecycleEvent) []byte {
+	level := zapcore.InfoLevel
+	fields := append([]zapcore.Field{zap.String(lifecycleKey, e.Event)}, r.fields...)
+	if e.Event == logger.LifecycleRecover {
+		level = zapcore.WarnLevel
+		fields = append(fields, zap.Int64("salvaged_bytes", e.Salvaged), zap.Int64("trimmed_bytes", e.Trimmed))
+	}
+	ent := zapcore.Entry{Level: level, Time: r.clock.Now(), Message: lifecycleMessages[e.Event]}
+	buf, err := r.enc.Clone().EncodeEntry(ent, fields)
+	if err != nil {
+		return nil
+	}
+	defer buf.Free()
+	return append([]byte(nil), buf.Bytes()...)
+}
+
+// moduleVersion returns the version of this module in the running binary.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	const path = "github.com/Reb1113/mmap_write_syncer"
+	if info.Main.Path == path {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// configHash returns a short hash of the effective configuration, so files
+// written with different settings can be told apart.
+func configHash(config *Config) string {
+	enc := zapcore.NewMapObjectEncoder()
+	if err := config.MarshalLogObject(enc); err != nil {
+		return ""
+	}
+	data, err := json.Marshal(enc.Fields)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
@@ -1,5 +1,12 @@
 package log
 
+import (
+	"context"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+)
+
 // Logger is the fundamental interface for all log operations.
 type Logger interface {
 	Debug(msg string, keyvals ...interface{})
@@ -16,9 +23,100 @@ type Logger interface {
 	Panicf(template string, args ...interface{})
 	Fatalf(template string, args ...interface{})
 
+	// With adds args to the fields of every record the logger writes from
+	// now on and returns it. Use Child to leave the logger unchanged.
 	With(args ...interface{}) Logger
 
 	SetLevel(Level)
 
 	Close()
 }
+
+// The loggers New returns also implement the optional interfaces below.
+// Other Logger implementations, such as the adapters, implement those that
+// fit them. Type-assert to use one:
+//
+//	if s, ok := l.(log.Syncer); ok {
+//		err = s.Sync()
+//	}
+
+// RawLogger writes records encoded by the caller.
+type RawLogger interface {
+	// Raw writes pre-encoded bytes straight to the sink if lvl is enabled,
+	// appending a newline when p lacks one.
+	Raw(lvl Level, p []byte) error
+}
+
+// LevelController reports the level and changes it for a while.
+type LevelController interface {
+	GetLevel() Level
+	// SetLevelFor sets the level for the given duration, then reverts to
+	// the previous level. SetLevel ends the window early.
+	SetLevelFor(Level, time.Duration)
+}
+
+// OutputSwitcher switches where records are written.
+type OutputSwitcher interface {
+	// SetOutput switches where records are written without a restart,
+	// flushing and closing the previous output.
+	SetOutput(Output) error
+}
+
+// Syncer flushes written records.
+type Syncer interface {
+	// Sync flushes the records written so far to the output, e.g. before
+	// a risky operation; see Config.MmapFlushInterval for doing it
+	// periodically.
+	Sync() error
+}
+
+// Inspector reports the state of a logger and its sinks.
+type Inspector interface {
+	// DroppedCount returns the number of records the sink discarded on
+	// purpose, e.g. oversized records under the "error" policy.
+	DroppedCount() uint64
+	// FailedWrites returns the number of writes to the sink that returned
+	// an error.
+	FailedWrites() uint64
+	// BufferStats reports the sizes of encoded records and the behavior of
+	// the buffer pool Raw uses.
+	BufferStats() BufferStats
+	// EffectiveConfig returns the configuration the logger runs with,
+	// after defaults were applied.
+	EffectiveConfig() Config
+	// SinkHealth reports the health of every Sink of Config.Sinks that
+	// was started.
+	SinkHealth() []SinkStatus
+}
+
+// Maintainer exposes the retention and compression of the backups of the
+// mmap output.
+type Maintainer interface {
+	// RetentionPlan reports what the next retention run of the mmap output
+	// would remove and compress, without changing any file.
+	RetentionPlan() (*logger.RetentionPlan, error)
+	// WaitMaintenance blocks until the retention and compression of backups
+	// triggered so far have finished or ctx is done.
+	WaitMaintenance(ctx context.Context) error
+}
+
+var (
+	_ RawLogger       = (*zapLogger)(nil)
+	_ LevelController = (*zapLogger)(nil)
+	_ OutputSwitcher  = (*zapLogger)(nil)
+	_ Syncer          = (*zapLogger)(nil)
+	_ Inspector       = (*zapLogger)(nil)
+	_ Maintainer      = (*zapLogger)(nil)
+)
+
+// Child returns a logger carrying args in addition to the fields of l,
+// leaving l unchanged. Loggers without a Child method of their own get
+// l.With(args...), which may change l.
+func Child(l Logger, args ...interface{}) Logger {
+	if c, ok := l.(interface {
+		Child(args ...interface{}) Logger
+	}); ok {
+		return c.Child(args...)
+	}
+	return l.With(args...)
+}
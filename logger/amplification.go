@@ -0,0 +1,157 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// AmplificationReport 对比写入的日志字节数与实际落盘的字节数，
+// 用于在闪存等对写放大敏感的存储上调整映射大小和刷盘策略
+type AmplificationReport struct {
+	LoggedBytes   int64 // 应用写入的记录字节数
+	MappedBytes   int64 // 通过 Ftruncate 预分配并映射的字节数
+	PaddingBytes  int64 // 已映射但未写入的填充字节数（运行时为解除映射时截掉的部分，离线分析时为文件末尾的零字节）
+	DiskBytes     int64 // 落盘的字节数：运行时按写脏的页估算，离线分析时为文件实际占用的块
+	CompressedIn  int64 // 被压缩的备份的原始字节数
+	CompressedOut int64 // 压缩后的字节数，同样计入 DiskBytes
+	Remaps        int64 // 重新映射的次数
+	Fallbacks     int64 // 因映射预算不足改为缓冲写的次数
+}
+
+// Ratio 返回写放大系数，即落盘字节数与写入字节数之比
+func (r AmplificationReport) Ratio() float64 {
+	if r.LoggedBytes == 0 {
+		return 0
+	}
+	return float64(r.DiskBytes) / float64(r.LoggedBytes)
+}
+
+type writeStats struct {
+	logged, mapped, padding, disk atomic.Int64
+	compressedIn, compressedOut   atomic.Int64
+	remaps, fallbacks             atomic.Int64
+}
+
+// 解除映射时记录写脏的页和被截掉的填充。
+// 起始位置按页对齐，所以上一映射的最后一页会被再次写入，这部分也计入落盘字节
+func (s *writeStats) recordUnmap(used, mapped int64) {
+	pages := (used + int64(pageSize) - 1) / int64(pageSize)
+	s.disk.Add(pages * int64(pageSize))
+	if mapped > used {
+		s.padding.Add(mapped - used)
+	}
+}
+
+func (s *writeStats) recordCompress(in int64, dst string) {
+	s.compressedIn.Add(in)
+	if info, err := os_Stat(dst); err == nil {
+		s.compressedOut.Add(info.Size())
+		s.disk.Add(info.Size())
+	}
+}
+
+// WriteAmplification 返回自创建以来的写放大统计
+func (l *MMapLogger) WriteAmplification() AmplificationReport {
+	return AmplificationReport{
+		LoggedBytes:   l.stats.logged.Load(),
+		MappedBytes:   l.stats.mapped.Load(),
+		PaddingBytes:  l.stats.padding.Load(),
+		DiskBytes:     l.stats.disk.Load(),
+		CompressedIn:  l.stats.compressedIn.Load(),
+		CompressedOut: l.stats.compressedOut.Load(),
+		Remaps:        l.stats.remaps.Load(),
+		Fallbacks:     l.stats.fallbacks.Load(),
+	}
+}
+
+// AnalyzeAmplification 离线分析 filename 及其备份，统计日志内容与实际占用磁盘空间的差异
+func AnalyzeAmplification(filename string) (AmplificationReport, error) {
+	var r AmplificationReport
+	l := &MMapLogger{Filename: filename}
+	files := []string{filename}
+	old, err := l.oldLogFiles()
+	if err != nil {
+		return r, err
+	}
+	for _, f := range old {
+		files = append(files, filepath.Join(l.dir(), f.Name()))
+	}
+
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return r, err
+		}
+		r.DiskBytes += diskUsage(info)
+		if strings.HasSuffix(name, compressSuffix) {
+			size, err := gzipOriginalSize(name)
+			if err != nil {
+				return r, err
+			}
+			r.LoggedBytes += size
+			r.CompressedIn += size
+			r.CompressedOut += info.Size()
+			continue
+		}
+		padding, err := trailingZeros(name, info.Size())
+		if err != nil {
+			return r, err
+		}
+		r.LoggedBytes += info.Size() - padding
+		r.PaddingBytes += padding
+	}
+	return r, nil
+}
+
+// 读取 gzip 尾部记录的原始大小（对 4GB 取模）
+func gzipOriginalSize(name string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	buf := make([]byte, 4)
+	if _, err := f.Seek(-4, io.SeekEnd); err != nil {
+		return 0, err
+	}
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint32(buf)), nil
+}
+
+// 从文件末尾向前统计连续的零字节数
+func trailingZeros(name string, size int64) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var zeros int64
+	buf := make([]byte, 64*1024)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		trimmed := bytes.TrimRight(chunk, "\x00")
+		zeros += int64(len(chunk) - len(trimmed))
+		if len(trimmed) > 0 {
+			break
+		}
+		end = start
+	}
+	return zeros, nil
+}
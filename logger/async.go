@@ -0,0 +1,183 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+)
+
+// 异步缓冲区满时的策略
+const (
+	AsyncBlock      = "block"       // 等待后台写入腾出空间
+	AsyncDropOldest = "drop-oldest" // 丢弃缓冲区中最早的记录
+	AsyncDropNewest = "drop-newest" // 丢弃正在写入的记录
+)
+
+// 异步写入的双缓冲：写入方把记录追加到 buf，后台协程与 spare 交换后写入映射，
+// 写入方只在复制记录时持有 mu，不会等待重新映射、轮换或压缩
+type asyncQueue struct {
+	mu        sync.Mutex
+	cond      *sync.Cond // 后台协程取走或写完一批时通知
+	buf       []byte     // 待写入的记录，首尾相连
+	ends      []int      // 每条记录在 buf 中的结束位置
+	spare     []byte     // 后台协程正在写入的一批
+	spareEnds []int
+	busy      bool          // 后台协程是否正在写入 spare
+	running   bool          // 后台协程是否在运行
+	stop      bool          // 要求后台协程写完缓冲区后退出
+	wake      chan struct{} // 通知后台协程有待写入的记录
+	done      chan struct{} // 当前后台协程退出时关闭
+}
+
+// 返回异步缓冲区，第一次调用时创建
+func (l *MMapLogger) asyncQueue() *asyncQueue {
+	l.asyncMu.Lock()
+	defer l.asyncMu.Unlock()
+	if l.async == nil {
+		l.async = &asyncQueue{wake: make(chan struct{}, 1)}
+		l.async.cond = sync.NewCond(&l.async.mu)
+	}
+	return l.async
+}
+
+// 把 records 复制到异步缓冲区，缓冲区满时按 AsyncOverflow 处理，返回被接受的记录数
+func (l *MMapLogger) asyncWrite(records ...[]byte) int {
+	q := l.asyncQueue()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.running { // 第一次写入，或 Close 之后再次写入
+		q.running, q.stop, q.done = true, false, make(chan struct{})
+		go l.drainAsync(q, q.done)
+	}
+	accepted := 0
+	for _, p := range records {
+		if !l.makeRoom(q, len(p)) {
+			continue
+		}
+		q.buf = append(q.buf, p...)
+		q.ends = append(q.ends, len(q.buf))
+		accepted++
+	}
+	q.signal()
+	return accepted
+}
+
+// 按 AsyncOverflow 为 n 字节的记录腾出空间，返回 false 表示丢弃该记录。
+// 缓冲区为空时总能放下一条记录，超过 AsyncBuffer 的记录也不会一直等待。调用方需持有 q.mu
+func (l *MMapLogger) makeRoom(q *asyncQueue, n int) bool {
+	for len(q.buf) > 0 && len(q.buf)+n > l.AsyncBuffer {
+		switch l.AsyncOverflow {
+		case AsyncDropNewest:
+			l.dropAsync(n)
+			return false
+		case AsyncDropOldest:
+			oldest := q.ends[0]
+			q.buf = q.buf[:copy(q.buf, q.buf[oldest:])]
+			q.ends = q.ends[:copy(q.ends, q.ends[1:])]
+			for i := range q.ends {
+				q.ends[i] -= oldest
+			}
+			l.dropAsync(oldest)
+		default:
+			q.signal()
+			q.cond.Wait()
+		}
+	}
+	return true
+}
+
+// 记录一条被丢弃的 n 字节记录
+func (l *MMapLogger) dropAsync(n int) {
+	l.dropped.Add(1)
+	l.droppedBytes.Add(uint64(n))
+}
+
+// 通知后台协程，调用方需持有 q.mu
+func (q *asyncQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// 后台协程：交换缓冲区并把一批记录写入映射，直到 stopAsync 要求退出且缓冲区已写完
+func (l *MMapLogger) drainAsync(q *asyncQueue, done chan struct{}) {
+	defer close(done)
+	var records [][]byte
+	for {
+		q.mu.Lock()
+		for len(q.buf) == 0 && !q.stop {
+			q.mu.Unlock()
+			<-q.wake
+			q.mu.Lock()
+		}
+		if len(q.buf) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		q.buf, q.spare = q.spare[:0], q.buf
+		q.ends, q.spareEnds = q.spareEnds[:0], q.ends
+		q.busy = true
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		records = records[:0]
+		start := 0
+		for _, end := range q.spareEnds {
+			records = append(records, q.spare[start:end])
+			start = end
+		}
+		l.mu.Lock()
+		n, err := l.writeBatch(records)
+		l.mu.Unlock()
+		if err != nil {
+			l.reportError(fmt.Errorf("async write: %d of %d records lost: %w", len(records)-n, len(records), err))
+		}
+
+		q.mu.Lock()
+		q.busy = false
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
+
+// 等待异步缓冲区中已有的记录写入映射
+func (l *MMapLogger) flushAsync() {
+	l.asyncMu.Lock()
+	q := l.async
+	l.asyncMu.Unlock()
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.buf) > 0 || q.busy {
+		q.signal()
+		q.cond.Wait()
+	}
+}
+
+// 写完异步缓冲区中的记录并停止后台协程，之后的异步写入会重新启动它
+func (l *MMapLogger) stopAsync() {
+	l.asyncMu.Lock()
+	q := l.async
+	l.asyncMu.Unlock()
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	if !q.running {
+		q.mu.Unlock()
+		return
+	}
+	q.stop = true
+	done := q.done
+	q.signal()
+	q.mu.Unlock()
+	<-done
+}
+
+// DroppedBytes 返回异步缓冲区满时按 AsyncOverflow 丢弃的字节数，丢弃的记录同时计入 DroppedCount
+func (l *MMapLogger) DroppedBytes() uint64 {
+	return l.droppedBytes.Load()
+}
@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const bufferedWriteSize = 64 * 1024 // 超出映射预算后缓冲写使用的缓冲区大小
+
+// ErrMapBudget 表示映射预算已用完，logger 改为通过缓冲区直接写文件
+var ErrMapBudget = errors.New("mmap logger: mapping budget exhausted, falling back to buffered writes")
+
+// 进程内所有 MMapLogger 共享的映射预算
+var mapBudget struct {
+	mu          sync.Mutex
+	maxBytes    int64 // 同时映射的最大字节数，0 表示不限制
+	maxMappings int   // 同时存在的最大映射数，0 表示不限制
+	bytes       int64 // 当前映射的字节数
+	mappings    int   // 当前的映射数
+}
+
+// SetMapBudget 限制进程内所有 MMapLogger 同时映射的字节数和映射数，0 表示不限制。
+// 为每个租户创建 logger 时，可以避免耗尽 vm.max_map_count 或地址空间。
+// 超出预算的 logger 通过 OnError 报告 ErrMapBudget，并改为缓冲写，直到预算有空余或轮换时重新尝试映射。已有的映射不受影响
+func SetMapBudget(maxBytes int64, maxMappings int) {
+	mapBudget.mu.Lock()
+	defer mapBudget.mu.Unlock()
+	mapBudget.maxBytes = maxBytes
+	mapBudget.maxMappings = maxMappings
+}
+
+// MapBudgetUsage 返回当前所有 MMapLogger 映射的字节数和映射数
+func MapBudgetUsage() (bytes int64, mappings int) {
+	mapBudget.mu.Lock()
+	defer mapBudget.mu.Unlock()
+	return mapBudget.bytes, mapBudget.mappings
+}
+
+// 判断预算能否容纳一个 size 字节的映射，reserve 为 true 时同时占用预算
+func budgetFits(size int64, reserve bool) bool {
+	mapBudget.mu.Lock()
+	defer mapBudget.mu.Unlock()
+	if mapBudget.maxBytes > 0 && mapBudget.bytes+size > mapBudget.maxBytes {
+		return false
+	}
+	if mapBudget.maxMappings > 0 && mapBudget.mappings+1 > mapBudget.maxMappings {
+		return false
+	}
+	if reserve {
+		mapBudget.bytes += size
+		mapBudget.mappings++
+	}
+	return true
+}
+
+// 归还一个 size 字节的映射占用的预算
+func releaseBudget(size int64) {
+	mapBudget.mu.Lock()
+	defer mapBudget.mu.Unlock()
+	mapBudget.bytes -= size
+	mapBudget.mappings--
+}
+
+// 预算不足时改为缓冲写，从当前写入位置继续。之前映射写入的部分已在解除映射时截掉填充，
+// 所以文件中两种方式写入的内容是连续的。每次进入时报告一次 ErrMapBudget，并记录切换时的文件偏移，调用方需持有锁
+func (l *MMapLogger) startBuffered() {
+	l.stats.fallbacks.Add(1)
+	l.reportError(fmt.Errorf("%w: %s at offset %d", ErrMapBudget, l.filename(), l.writeAt))
+	l.size = l.writeAt
+	l.buffered = bufio.NewWriterSize(io.NewOffsetWriter(l.file, l.writeAt), bufferedWriteSize)
+}
+
+// 写出缓冲区并退出缓冲写，之后的写入重新尝试映射，调用方需持有锁
+func (l *MMapLogger) stopBuffered() error {
+	if l.buffered == nil {
+		return nil
+	}
+	err := l.buffered.Flush()
+	l.buffered = nil
+	l.size = l.writeAt
+	return err
+}
@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+const (
+	markerSuffix    = ".open"
+	recoverReadSize = 64 * 1024 // 从文件末尾向前查找填充时每次读取的字节数
+)
+
+func (l *MMapLogger) markerName() string {
+	return l.filename() + markerSuffix
+}
+
+// 第一次打开日志文件时检查标记文件：标记存在说明上次没有正常 Close，截掉文件末尾的映射填充并记录恢复事件，
+// 然后创建标记，Close 时删除。标记中记录了写入的进程号，但不检查该进程是否仍在运行，
+// 因此同一个文件不能被多个进程同时使用。调用方需持有锁
+func (l *MMapLogger) checkCrashMarker(name string) error {
+	if !l.CrashMarker || l.marked {
+		return nil
+	}
+	if _, err := os_Stat(l.markerName()); err == nil {
+		salvaged, trimmed, err := l.trimPadding(name)
+		if err != nil {
+			return fmt.Errorf("can't recover log file: %s", err)
+		}
+		l.queueLifecycle(LifecycleEvent{Event: LifecycleRecover, Salvaged: salvaged, Trimmed: trimmed})
+	}
+	if err := os.MkdirAll(l.dir(), 0755); err != nil {
+		return fmt.Errorf("can't create crash marker: %s", err)
+	}
+	if err := os.WriteFile(l.markerName(), []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return fmt.Errorf("can't create crash marker: %s", err)
+	}
+	l.marked = true
+	return nil
+}
+
+// 正常关闭时删除标记文件，调用方需持有锁
+func (l *MMapLogger) removeCrashMarker() error {
+	if !l.marked {
+		return nil
+	}
+	l.marked = false
+	if err := os.Remove(l.markerName()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// 截掉文件 name 末尾的 NUL 填充，返回保留和截掉的字节数。文件不存在时不做处理，KeepPadding 时只返回文件大小
+func (l *MMapLogger) trimPadding(name string) (kept, trimmed int64, err error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if l.KeepPadding {
+		return info.Size(), 0, nil
+	}
+	return trimFilePadding(f, info.Size())
+}
+
+// 从末尾向前查找文件 f 中最后一个非零字节，截掉之后的 NUL 填充，返回保留和截掉的字节数
+func trimFilePadding(f *os.File, size int64) (kept, trimmed int64, err error) {
+	end := size
+	buf := make([]byte, recoverReadSize)
+	for end > 0 {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, 0, err
+		}
+		i := len(chunk)
+		for i > 0 && chunk[i-1] == 0 {
+			i--
+		}
+		end = start + int64(i)
+		if i > 0 {
+			break
+		}
+	}
+	if end == size {
+		return size, 0, nil
+	}
+	if err := f.Truncate(end); err != nil {
+		return 0, 0, err
+	}
+	return end, size - end, f.Sync()
+}
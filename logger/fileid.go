@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+)
+
+// 压缩备份的 gzip 头部 Extra 中记录原文件设备号和 inode 的子字段标识（RFC 1952 的 SI1、SI2）
+const fileIDSubfield = "FI"
+
+// 返回记录 info 所描述文件的设备号和 inode 的 gzip Extra 字段，无法获取时返回 nil
+func fileIDExtra(info os.FileInfo) []byte {
+	dev, ino := fileID(info)
+	if dev == 0 && ino == 0 {
+		return nil
+	}
+	extra := make([]byte, 4, 4+16)
+	copy(extra, fileIDSubfield)
+	binary.LittleEndian.PutUint16(extra[2:], 16)
+	extra = binary.LittleEndian.AppendUint64(extra, dev)
+	return binary.LittleEndian.AppendUint64(extra, ino)
+}
+
+// CompressedFileID 返回压缩备份 name 在压缩前的设备号和 inode，由压缩时写入 gzip 头部。
+// 压缩后的文件是新文件，读取方（如 shipper 的游标）据此找到被轮换并压缩的原文件。
+// 不是 gzip 文件或头部没有记录时 ok 为 false
+func CompressedFileID(name string) (dev, ino uint64, ok bool) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, 0, false
+	}
+	for extra := gr.Header.Extra; len(extra) >= 4; {
+		n := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+n {
+			break
+		}
+		if string(extra[:2]) == fileIDSubfield && n == 16 {
+			return binary.LittleEndian.Uint64(extra[4:]), binary.LittleEndian.Uint64(extra[12:]), true
+		}
+		extra = extra[4+n:]
+	}
+	return 0, 0, false
+}
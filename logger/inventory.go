@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// inventory 缓存日志目录中的备份文件列表。轮换、清理和压缩时增量更新，
+// 每隔 InventoryRescan 完整扫描一次目录以发现外部的修改
+type inventory struct {
+	mu      sync.Mutex
+	files   []logInfo // 按时间从新到旧排序
+	scanned time.Time // 上一次完整扫描的时间，零值表示缓存无效
+}
+
+// 获取日志目录中的所有旧日志文件信息，设置了 InventoryRescan 时优先使用缓存
+func (l *MMapLogger) oldLogFiles() ([]logInfo, error) {
+	if l.InventoryRescan <= 0 {
+		return l.scanLogFiles()
+	}
+	inv := &l.inventory
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	now := l.now()
+	if inv.scanned.IsZero() || now.Sub(inv.scanned) >= l.InventoryRescan || now.Before(inv.scanned) {
+		files, err := l.scanLogFiles()
+		if err != nil {
+			return nil, err
+		}
+		inv.files = files
+		inv.scanned = now
+	}
+	return append([]logInfo(nil), inv.files...), nil
+}
+
+// 将新出现的备份 name（日志目录下的文件名）加入缓存
+func (l *MMapLogger) inventoryAdd(name string) {
+	if l.InventoryRescan <= 0 {
+		return
+	}
+	inv := &l.inventory
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.scanned.IsZero() {
+		return
+	}
+	info, err := os_Stat(filepath.Join(l.dir(), name))
+	if err != nil {
+		inv.scanned = time.Time{} // 状态不明，下次重新扫描
+		return
+	}
+	prefix, ext := l.prefixAndExt()
+	t, err := l.timeFromName(name, prefix, ext)
+	if err != nil {
+		if t, err = l.timeFromName(name, prefix, ext+compressSuffix); err != nil {
+			return
+		}
+	}
+	inv.files = append(inv.files, logInfo{t, info})
+	sort.Sort(byFormatTime(inv.files))
+}
+
+// 将已删除或被替换的备份 name 从缓存中移除
+func (l *MMapLogger) inventoryRemove(name string) {
+	if l.InventoryRescan <= 0 {
+		return
+	}
+	inv := &l.inventory
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	for i, f := range inv.files {
+		if f.Name() == name {
+			inv.files = append(inv.files[:i], inv.files[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package logger
+
+import "fmt"
+
+// 生命周期事件的类型
+const (
+	LifecycleOpen    = "open"    // 打开（或重新打开）日志文件
+	LifecycleRotate  = "rotate"  // 轮换后打开新文件
+	LifecycleClose   = "close"   // Close 关闭日志文件
+	LifecycleRecover = "recover" // 打开时发现上次没有正常关闭，已完成恢复
+)
+
+// LifecycleEvent 是传给 LifecycleRecord 的生命周期事件
+type LifecycleEvent struct {
+	Event    string // 事件类型，Lifecycle* 常量之一
+	Salvaged int64  // 恢复事件中保留下来的字节数
+	Trimmed  int64  // 恢复事件中截掉的映射填充字节数
+}
+
+// 记录待写入的生命周期事件。打开和轮换可能发生在分配映射空间的过程中，
+// 这时不能立即写入，由 flushLifecycle 在映射就绪后写入
+func (l *MMapLogger) queueLifecycle(e LifecycleEvent) {
+	if l.LifecycleRecord != nil {
+		l.pendingEvents = append(l.pendingEvents, e)
+	}
+}
+
+// 写入待写入的生命周期记录，失败时通过 OnError 报告，调用方需持有锁。
+// 写入本身会再次进入 flushLifecycle，所以先取出全部事件，保证按顺序写入
+func (l *MMapLogger) flushLifecycle() {
+	events := l.pendingEvents
+	l.pendingEvents = nil
+	for _, e := range events {
+		if p := l.LifecycleRecord(e); len(p) > 0 {
+			if _, err := l.write(p); err != nil {
+				l.reportError(fmt.Errorf("write %s lifecycle record: %v", e.Event, err))
+			}
+		}
+	}
+}
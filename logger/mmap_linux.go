@@ -0,0 +1,36 @@
+//go:build linux && !nosyscall
+
+package logger
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var madviseAdvice = map[string]int{
+	"sequential": unix.MADV_SEQUENTIAL,
+	"random":     unix.MADV_RANDOM,
+	"willneed":   unix.MADV_WILLNEED,
+	"hugepage":   unix.MADV_HUGEPAGE,
+	"nohugepage": unix.MADV_NOHUGEPAGE,
+}
+
+// 将文件扩大到 size，preallocate 为 true 时通过 fallocate 同时分配磁盘块
+func growFile(f *os.File, size int64, preallocate bool) error {
+	if !preallocate {
+		return f.Truncate(size)
+	}
+	if err := unix.Fallocate(int(f.Fd()), 0, 0, size); err != unix.EOPNOTSUPP {
+		return err
+	}
+	return f.Truncate(size) // 文件系统不支持 fallocate
+}
+
+// 为文件预留 size 字节的磁盘块而不改变文件大小，文件系统不支持 fallocate 时不做处理
+func reserveFile(f *os.File, size int64) error {
+	if err := unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_KEEP_SIZE, 0, size); err != unix.EOPNOTSUPP {
+		return err
+	}
+	return nil
+}
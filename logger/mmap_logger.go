@@ -1,17 +1,21 @@
 package logger
 
 import (
+	"bufio"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,94 +24,629 @@ const (
 	compressSuffix      = ".gz"
 	defaultMmapMaxSize  = 100
 	defaultMegaByteSize = 10 //每次mmap映射size
+	truncatedMarker     = "...[truncated]"
+
+	defaultRetentionJitter = 0.2 // 定期清理间隔的默认随机浮动比例
+)
+
+// UnlimitedSize 作为 MaxSize 时不按大小轮换，文件随映射持续增长，适用于只按 RotateSchedule、RotationInterval 或由外部工具轮换的场景
+const UnlimitedSize = -1
+
+// 超长记录的处理策略
+const (
+	RecordPolicyError    = "error"    // 返回错误，丢弃该记录
+	RecordPolicyTruncate = "truncate" // 截断到 MaxRecordSize 并追加截断标记
+	RecordPolicySplit    = "split"    // 拆分成多条不超过 MaxRecordSize 的记录连续写入，以换行结尾的记录拆分后每条都以换行结尾
+)
+
+// 重新压缩的格式
+const (
+	RecompressGzip = "gzip" // 以 RecompressLevel 重新压缩为 gzip
+	RecompressZstd = "zstd" // 需要 zstd 编码器，本模块没有依赖它，Validate 和重新压缩都会明确拒绝
 )
 
 var _ io.WriteCloser = (*MMapLogger)(nil)
 
 type MMapLogger struct {
 	Filename   string `json:"filename" yaml:"filename"`     // 指定日志文件的名称。如果不提供，则默认使用<processname>-mmap.log并保存在os.TempDir()目录下。
-	MaxSize    int    `json:"maxsize" yaml:"maxsize"`       // 指定日志文件的最大大小（以兆字节为单位）。当日志文件达到此大小时，将触发轮换。默认值为100兆字节。
+	MaxSize    int    `json:"maxsize" yaml:"maxsize"`       // 指定日志文件的最大大小（以兆字节为单位）。当日志文件达到此大小时，将触发轮换。默认值为100兆字节，UnlimitedSize 表示不按大小轮换，其他负数无效
 	MaxAge     int    `json:"maxage" yaml:"maxage"`         // 基于日志文件名中编码的时间戳，指定保留旧日志文件的最大天数
 	MaxBackups int    `json:"maxbackups" yaml:"maxbackups"` // 指定要保留的旧日志文件的最大数量
 	LocalTime  bool   `json:"localtime" yaml:"localtime"`   // 确定用于格式化备份文件中的时间戳的时间是否为计算机的本地时间
 	Compress   bool   `json:"compress" yaml:"compress"`     // 确定是否应使用gzip压缩旋转的日志文件。默认情况下，不执行压缩。
 
-	size      int64      // 当前日志文件的大小
-	file      *os.File   // 当前打开的日志文件
-	mu        sync.Mutex // 用于保护对当前日志文件的并发访问的互斥锁
-	millCh    chan bool  // 用于通知日志文件即将旋转的通道
-	startMill sync.Once  // 确保日志轮换监控只启动一次的单例
+	ChunkSize     int    `json:"chunksize" yaml:"chunksize"`         // 每次 mmap 映射的字节数，向上对齐到系统页大小，最小一页。为0时使用默认的 10MB。映射越大重新映射越少，但未写满的映射在磁盘上占用的空间越多
+	MaxRecordSize int    `json:"maxrecordsize" yaml:"maxrecordsize"` // 单条记录的最大字节数。为0或超过单次映射大小时使用单次映射大小
+	RecordPolicy  string `json:"recordpolicy" yaml:"recordpolicy"`   // 记录超过 MaxRecordSize 时的处理策略："error"（默认）、"truncate" 或 "split"
+
+	SyncAsync   bool   `json:"syncasync" yaml:"syncasync"`     // Sync 以 MS_ASYNC 方式只安排写回而不等待完成，默认 MS_SYNC
+	SyncFile    bool   `json:"syncfile" yaml:"syncfile"`       // Sync 在 MS_SYNC 之后再 fsync 文件，使文件大小等元数据也写到磁盘，SyncAsync 时不生效
+	Preallocate bool   `json:"preallocate" yaml:"preallocate"` // 扩大文件时通过 fallocate 预先分配磁盘块，避免磁盘满时写入映射触发 SIGBUS，仅 Linux 生效
+	Advice      string `json:"advice" yaml:"advice"`           // 对每次映射调用 madvise 的建议："sequential"、"random"、"willneed"、"hugepage" 或 "nohugepage"，默认不调用
+
+	PreallocateFile bool `json:"preallocatefile" yaml:"preallocatefile"` // 打开文件时通过 fallocate 一次预留 MaxSize 的磁盘块（不改变文件大小），磁盘空间不足在打开时就报告，而不是写到一半才失败，仅 Linux 生效
+
+	RecompressAfter int `json:"recompressafter" yaml:"recompressafter"` // 压缩备份超过该天数后以更高压缩率重新压缩，0 表示不重新压缩
+	RecompressLevel int `json:"recompresslevel" yaml:"recompresslevel"` // 重新压缩使用的 gzip 压缩级别，默认 gzip.BestCompression
+
+	RecompressFormat string `json:"recompressformat" yaml:"recompressformat"` // 重新压缩的格式，只支持 "gzip"（默认），"zstd" 不可用
+
+	CompressRateLimit int  `json:"compressratelimit" yaml:"compressratelimit"` // 压缩和重新压缩时每秒最多读取的兆字节数，0 表示不限速
+	CompressNice      bool `json:"compressnice" yaml:"compressnice"`           // 在最低 CPU 优先级（nice 19）和 idle IO 调度类的线程上压缩，仅 Linux 生效
+
+	DetectRotation bool `json:"detectrotation" yaml:"detectrotation"` // 定期检查文件是否被 logrotate 等外部工具重命名，如果是则收尾旧文件并重新打开
+
+	FlushInterval time.Duration `json:"flushinterval" yaml:"flushinterval"` // 后台协程每隔该时间调用一次 Sync，限制崩溃时丢失的内容，0 表示只在调用 Sync 时写回
+
+	AsyncBuffer   int    `json:"asyncbuffer" yaml:"asyncbuffer"`     // 大于0时 Write 和 WriteBatch 只把记录复制到该字节数的缓冲区，由后台协程写入映射，不会因重新映射、轮换或压缩阻塞
+	AsyncOverflow string `json:"asyncoverflow" yaml:"asyncoverflow"` // 异步缓冲区满时的策略："block"（默认，等待后台写入腾出空间）、"drop-oldest" 或 "drop-newest"
+
+	RetentionInterval time.Duration `json:"retentioninterval" yaml:"retentioninterval"` // 定期执行清理和压缩的间隔，0 表示只在打开和轮换文件时执行
+	RetentionJitter   float64       `json:"retentionjitter" yaml:"retentionjitter"`     // 定期清理间隔和 RetentionDebounce 的随机浮动比例，0 表示默认的 0.2，负数表示不浮动
+	RetentionDebounce time.Duration `json:"retentiondebounce" yaml:"retentiondebounce"` // 打开和轮换文件触发的清理延迟该时间后执行，期间的多次触发合并为一次
+	InventoryRescan   time.Duration `json:"inventoryrescan" yaml:"inventoryrescan"`     // 缓存备份文件列表，只在轮换、清理时增量更新，每隔该时间完整扫描一次目录。0 表示每次都扫描目录
+
+	KeepPatterns []string `json:"keeppatterns" yaml:"keeppatterns"` // 匹配这些模式的备份文件不会被 MaxAge/MaxBackups 清理，支持 glob，以 "regexp:" 开头时按正则匹配
+
+	QuotaFile string `json:"quotafile" yaml:"quotafile"` // 共享配额文件，同一卷上使用同一配额文件的多个进程共享 QuotaSize，总量超出时各自删除最旧的备份
+	QuotaSize int    `json:"quotasize" yaml:"quotasize"` // 共享配额的大小（以兆字节为单位），在每次清理时检查，建议同时设置 RetentionInterval
+
+	RotateSchedule   string `json:"rotateschedule" yaml:"rotateschedule"`     // 按 cron 表达式定时轮换，例如 "0 * * * *" 表示每小时整点
+	CompressSchedule string `json:"compressschedule" yaml:"compressschedule"` // 按 cron 表达式定时压缩备份，设置后轮换时不再立即压缩，例如 "0 3 * * *"
+
+	RotationInterval time.Duration `json:"rotationinterval" yaml:"rotationinterval"` // 在该间隔的整数倍时间点（按 LocalTime 对齐，如 time.Hour 为每小时整点）轮换，备份文件名使用其覆盖周期的开始时间
+
+	RefuseSymlink bool `json:"refusesymlink" yaml:"refusesymlink"` // 日志路径是符号链接时拒绝打开。默认解析链接，轮换链接指向的文件
+
+	OpenRetries   int           `json:"openretries" yaml:"openretries"` // 文件描述符耗尽（EMFILE/ENFILE）时打开日志文件的重试次数，0 表示默认的 3 次，负数表示不重试
+	OpenBackoff   time.Duration `json:"openbackoff" yaml:"openbackoff"` // 第一次重试前的等待时间，之后每次翻倍，默认 10ms
+	OnFDExhausted func()        `json:"-" yaml:"-"`                     // 文件描述符耗尽、重试之前的回调，可用于关闭空闲的文件
+
+	Header []byte `json:"-" yaml:"-"` // 每个新建（空）日志文件开头写入的文件头，用于标识记录格式
+
+	CrashMarker     bool                          `json:"crashmarker" yaml:"crashmarker"` // 打开期间保留 <文件名>.open 标记，启动时发现标记说明上次没有正常关闭，即使没有留下映射填充也记录恢复事件
+	KeepPadding     bool                          `json:"keeppadding" yaml:"keeppadding"` // 重新打开时不截掉上次非正常退出留下的 NUL 填充，而是在其后继续写入。用于末尾可能是 NUL 字节的二进制记录（如 msgpack），读取时需跳过填充
+	LifecycleRecord func(e LifecycleEvent) []byte `json:"-" yaml:"-"`                     // 打开、轮换和关闭日志文件时调用，返回的记录写入文件，用于按进程生命周期切分日志和发现非正常退出
+
+	Clock   Clock           `json:"-" yaml:"-"` // 时间来源，用于备份文件名、清理和定时任务，默认使用系统时间。可直接传入 zapcore.Clock
+	OnError func(err error) `json:"-" yaml:"-"` // 发生不会中断写入的异常（如文件被外部截断）时的回调，默认打印到标准错误
+
+	size      int64         // 当前日志文件的大小
+	file      *os.File      // 当前打开的日志文件
+	mu        sync.Mutex    // 用于保护对当前日志文件的并发访问的互斥锁
+	millCh    chan bool     // 用于通知日志文件即将旋转的通道
+	millDone  chan struct{} // 关闭清理协程的通道，与 millCh 一起为 nil 表示清理协程未运行
+	millMu    sync.Mutex    // 保证同一时间只有一次清理/压缩在执行
+	stopSched chan struct{} // 关闭定时任务协程的通道，为 nil 表示定时任务未运行
+	maint     maintenance   // 清理和压缩任务的 context，关闭时取消
+	inventory inventory     // 备份文件列表的缓存
+	progress  millProgress  // 清理任务的请求和完成进度
+	resolved  string        // 解析符号链接后的日志文件路径
+	period    time.Time     // 按 RotationInterval 轮换时刚结束的周期的开始时间，用作备份文件名
+
+	schedWG *sync.WaitGroup // 正在运行的定时任务协程，Close 时等待它们退出
+	millWG  *sync.WaitGroup // 正在运行的清理协程，Close 时等待它退出
+
+	pendingEvents []LifecycleEvent // 待写入的生命周期事件
+	marked        bool             // 是否已创建非正常退出的标记文件
 
 	writeStartAt int64  // 当前mmap映射write开始位置
 	writeAt      int64  // 当前映射write的位置
 	mmapSpace    []byte // 文件和内存的映射空间
+
+	buffered *bufio.Writer // 超出映射预算时的缓冲写，为 nil 表示使用映射
+
+	lastSizeCheck time.Time // 上一次检查文件是否被外部截断的时间
+
+	dropped atomic.Uint64 // 被主动丢弃的记录数
+	failed  atomic.Uint64 // 写入失败的次数
+	stats   writeStats    // 写放大相关的统计
+
+	counters runStats // 轮换、压缩失败、清理和异常的计数
+
+	asyncMu      sync.Mutex    // 保护 async
+	async        *asyncQueue   // 异步写入的缓冲区，第一次异步写入时创建
+	droppedBytes atomic.Uint64 // 异步缓冲区满时丢弃的字节数
 }
 
 var (
 	currentTime = time.Now
 	os_Stat     = os.Stat
 	megabyte    = 1024 * 1024
-	pageSize    = 4 * 1024
+	pageSize    = os.Getpagesize()
+
+	sizeCheckInterval = time.Second // 检查文件是否被外部截断的间隔
+
+	// ErrExternalTruncate 表示映射中的文件被外部进程截断
+	ErrExternalTruncate = errors.New("mmap logger: log file truncated externally")
 )
 
+// Clock 是 MMapLogger 的时间来源
+type Clock interface {
+	Now() time.Time
+}
+
+// 返回当前时间，优先使用注入的 Clock
+func (l *MMapLogger) now() time.Time {
+	if l.Clock != nil {
+		return l.Clock.Now()
+	}
+	return currentTime()
+}
+
 // 停止 MMapLogger
 func (l *MMapLogger) StopMmapLogger() {
 	if l != nil {
-		l.unMap()      // 解除内存映射
-		l.file.Close() // 关闭文件
+		_ = l.Close() // 解除内存映射并关闭文件
 	}
 }
 
 // Write 向 MMapLogger 写入数据
 func (l *MMapLogger) Write(p []byte) (n int, err error) {
-	l.mu.Lock()               // 加锁
-	defer l.mu.Unlock()       // 解锁
-	writeLen := int64(len(p)) // 写入数据长度
-	if writeLen > l.max() {   // 如果写入长度超过最大限制
-		return 0, fmt.Errorf("write length %d exceeds maximum file size %d", writeLen, l.max())
+	if l.AsyncBuffer > 0 {
+		l.asyncWrite(p)
+		return len(p), nil
 	}
-	if l.file == nil { // 如果文件未打开
-		if err = l.openExistingOrNew(); err != nil { // 尝试打开现有文件或创建新文件
+	l.mu.Lock()         // 加锁
+	defer l.mu.Unlock() // 解锁
+	return l.writeRecord(p)
+}
+
+// WriteBatch 将多条记录连续写入：为整批预留一段连续的空间后依次复制，整批最多重新映射一次，
+// 比逐条调用 Write 减少加锁和检查的开销。整批超过 MaxRecordSize 时拆成多批，超长的单条记录按 RecordPolicy 处理。
+// 返回完整写入的记录数
+func (l *MMapLogger) WriteBatch(records [][]byte) (n int, err error) {
+	if l.AsyncBuffer > 0 {
+		return l.asyncWrite(records...), nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.writeBatch(records)
+}
+
+// 写入一批记录，调用方需持有锁
+func (l *MMapLogger) writeBatch(records [][]byte) (n int, err error) {
+	limit := l.maxRecordSize()
+	for n < len(records) {
+		end, size := n, 0
+		for end < len(records) && size+len(records[end]) <= limit {
+			size += len(records[end])
+			end++
+		}
+		if end == n { // 超长的单条记录
+			if _, err := l.writeRecord(records[n]); err != nil {
+				return n, err
+			}
+			n++
+			continue
+		}
+		if err := l.writeRecords(records[n:end], size); err != nil {
+			return n, err
+		}
+		n = end
+	}
+	return n, nil
+}
+
+// Reserve 在写入位置预留 n 字节并返回这段映射空间，调用方直接把记录序列化到 buf 中，再调用 commit(used)
+// 提交前 used 字节，实现不经过中间缓冲区的零拷贝写入，used 小于等于 0 表示放弃，大于 n 时按 n 提交。从 Reserve 到 commit 期间持有锁，
+// 其他写入会等待，因此 commit 必须且只能调用一次，期间不能调用该 logger 的其他方法。
+// 直接写映射空间不受 ErrMappingFault 保护。超出映射预算改为缓冲写时，buf 是普通的内存缓冲区
+func (l *MMapLogger) Reserve(n int) (buf []byte, commit func(used int), err error) {
+	l.flushAsync()
+	l.mu.Lock()
+	if limit := l.maxRecordSize(); n > limit {
+		l.mu.Unlock()
+		return nil, nil, fmt.Errorf("reserve length %d exceeds maximum record size %d", n, limit)
+	}
+	if err := l.reserve(n); err != nil {
+		l.failed.Add(1)
+		l.mu.Unlock()
+		return nil, nil, err
+	}
+	if l.buffered != nil {
+		buf = make([]byte, n)
+		return buf, func(used int) {
+			defer l.mu.Unlock()
+			if used > n {
+				used = n
+			}
+			if used > 0 {
+				written, err := l.buffered.Write(buf[:used])
+				l.writeAt += int64(written)
+				l.size = l.writeAt
+				l.stats.logged.Add(int64(written))
+				if err != nil {
+					l.failed.Add(1)
+					l.reportError(err)
+				}
+			}
+		}, nil
+	}
+	cacheAt := l.writeAt - l.writeStartAt
+	if n+int(cacheAt) > len(l.mmapSpace) {
+		l.mu.Unlock()
+		return nil, nil, io.ErrShortWrite
+	}
+	buf = l.mmapSpace[cacheAt : cacheAt+int64(n) : cacheAt+int64(n)]
+	return buf, func(used int) {
+		defer l.mu.Unlock()
+		if used <= 0 {
+			return
+		}
+		if used > n {
+			used = n
+		}
+		if err := writeThrough(l.mmapSpace, cacheAt, cacheAt+int64(used)); err != nil {
+			l.reportError(err)
+		}
+		l.writeAt += int64(used)
+		l.stats.logged.Add(int64(used))
+	}, nil
+}
+
+// 按 RecordPolicy 写入一条记录，调用方需持有锁
+func (l *MMapLogger) writeRecord(p []byte) (n int, err error) {
+	limit := l.maxRecordSize()
+	if len(p) <= limit {
+		return l.write(p)
+	}
+	switch l.RecordPolicy {
+	case RecordPolicyTruncate:
+		if _, err := l.write(truncateRecord(p, limit)); err != nil {
 			return 0, err
 		}
+		return len(p), nil
+	case RecordPolicySplit:
+		chunks, err := splitRecord(p, limit)
+		if err != nil {
+			l.dropped.Add(1)
+			return 0, err
+		}
+		lines := p[len(p)-1] == '\n' // 每个片段多了一个换行
+		for _, chunk := range chunks {
+			if _, err := l.write(chunk); err != nil {
+				return n, err
+			}
+			n += len(chunk)
+			if lines {
+				n--
+			}
+		}
+		return len(p), nil
+	default:
+		l.dropped.Add(1)
+		return 0, fmt.Errorf("write length %d exceeds maximum record size %d", len(p), limit)
+	}
+}
+
+// Append 将 p 作为一个整体写入，并返回其在当前文件中的起始偏移。不适用 RecordPolicy，超长时直接返回错误。
+// 用于在映射文件之上实现按偏移读取的存储，此时应将 MaxSize 设为 UnlimitedSize 使偏移保持有效
+func (l *MMapLogger) Append(p []byte) (offset int64, err error) {
+	l.flushAsync()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit := l.maxRecordSize(); len(p) > limit {
+		l.dropped.Add(1)
+		return 0, fmt.Errorf("write length %d exceeds maximum record size %d", len(p), limit)
+	}
+	n, err := l.write(p)
+	if err != nil {
+		return 0, err
 	}
-	if len(p) >= int(l.size)-int(l.writeAt) { // 如果写入数据会导致文件超过最大大小
-		if err := l.allocateSpace(); err != nil { // 尝试分配更多空间
-			fmt.Printf("allocateSpace fail. error: %+v", err)
-			return len(p), err
+	return l.writeAt - int64(n), nil
+}
+
+// Truncate 丢弃文件中 size 之后的内容，之后的写入从 size 处继续。size 不能超过已写入的位置
+func (l *MMapLogger) Truncate(size int64) error {
+	l.flushAsync()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		if err := l.openExistingOrNew(); err != nil {
+			return err
 		}
 	}
+	if size < 0 || size > l.writeAt {
+		return fmt.Errorf("truncate size %d out of range [0, %d]", size, l.writeAt)
+	}
+	if err := l.stopBuffered(); err != nil {
+		return err
+	}
+	if err := l.unMap(); err != nil {
+		return err
+	}
+	if err := l.file.Truncate(size); err != nil {
+		return err
+	}
+	l.writeAt = size
+	l.size = size
+	return nil
+}
+
+// DroppedCount 返回因超长等原因被主动丢弃的记录数
+func (l *MMapLogger) DroppedCount() uint64 {
+	return l.dropped.Load()
+}
+
+// FailedWrites 返回因打开文件、分配映射或映射失效等错误而失败的写入次数
+func (l *MMapLogger) FailedWrites() uint64 {
+	return l.failed.Load()
+}
+
+// 截断超长记录并追加截断标记，保留原记录的换行结尾。结果不超过 limit 字节，limit 容不下完整的标记时截短标记
+func truncateRecord(p []byte, limit int) []byte {
+	newline := p[len(p)-1] == '\n'
+	room := limit
+	if newline {
+		room--
+	}
+	if room < 0 {
+		room = 0
+	}
+	marker := truncatedMarker
+	if len(marker) > room {
+		marker = marker[:room]
+	}
+	out := make([]byte, 0, limit)
+	out = append(out, p[:room-len(marker)]...)
+	out = append(out, marker...)
+	if newline && limit > 0 {
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// 将超长记录拆分成不超过 limit 字节的片段。以换行结尾的记录每个片段都以换行结尾，读取时每个片段是一行
+func splitRecord(p []byte, limit int) ([][]byte, error) {
+	if p[len(p)-1] != '\n' {
+		var chunks [][]byte
+		for len(p) > limit {
+			chunks = append(chunks, p[:limit])
+			p = p[limit:]
+		}
+		return append(chunks, p), nil
+	}
+	step := limit - 1
+	if step < 1 {
+		return nil, fmt.Errorf("maximum record size %d can't hold a line of a split record", limit)
+	}
+	body := p[:len(p)-1]
+	chunks := make([][]byte, 0, len(body)/step+1)
+	for len(body) > 0 {
+		n := min(step, len(body))
+		chunk := make([]byte, 0, n+1)
+		chunks = append(chunks, append(append(chunk, body[:n]...), '\n'))
+		body = body[n:]
+	}
+	return chunks, nil
+}
+
+// 返回单条记录允许的最大字节数，不超过单次映射大小（扣除页对齐的偏移）和文件最大大小
+func (l *MMapLogger) maxRecordSize() int {
+	limit := l.chunkSize() - pageSize
+	if limit < pageSize {
+		limit = pageSize
+	}
+	if l.MaxRecordSize > 0 && l.MaxRecordSize < limit {
+		limit = l.MaxRecordSize
+	}
+	return limit
+}
+
+// 将一条记录写入映射空间，调用方需持有锁
+func (l *MMapLogger) write(p []byte) (n int, err error) {
+	defer func() {
+		if err != nil {
+			l.failed.Add(1)
+		}
+	}()
+	if err := l.reserve(len(p)); err != nil {
+		return 0, err
+	}
+	if l.buffered != nil {
+		n, err = l.buffered.Write(p)
+		l.writeAt += int64(n)
+		l.size = l.writeAt
+		l.stats.logged.Add(int64(n))
+		return n, err
+	}
 	cacheAt := l.writeAt - l.writeStartAt       // 计算缓存位置
-	if len(p)+int(cacheAt) > len(l.mmapSpace) { // 如果写入数据会导致内存映射空间不足
-		return len(p), err
+	if len(p)+int(cacheAt) > len(l.mmapSpace) { // 如果写入数据会导致内存映射空间不足，不能静默丢弃
+		return 0, io.ErrShortWrite
+	}
+	n, err = safeCopy(l.mmapSpace[cacheAt:], p) // 将数据复制到内存映射空间
+	if err != nil {
+		l.dropMapping() // 映射已失效，丢弃后下次写入会重新映射
+		l.reportError(err)
+		return 0, err
+	}
+	if err := writeThrough(l.mmapSpace, cacheAt, cacheAt+int64(n)); err != nil {
+		l.reportError(err)
+	}
+	l.writeAt += int64(n) // 更新写入位置
+	l.stats.logged.Add(int64(n))
+	return n, nil
+}
+
+// 将总长为 size 的多条记录写入同一段映射空间，调用方需持有锁
+func (l *MMapLogger) writeRecords(records [][]byte, size int) (err error) {
+	defer func() {
+		if err != nil {
+			l.failed.Add(1)
+		}
+	}()
+	if err := l.reserve(size); err != nil {
+		return err
+	}
+	if l.buffered != nil {
+		for _, p := range records {
+			n, err := l.buffered.Write(p)
+			l.writeAt += int64(n)
+			l.size = l.writeAt
+			l.stats.logged.Add(int64(n))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	cacheAt := l.writeAt - l.writeStartAt
+	if size+int(cacheAt) > len(l.mmapSpace) {
+		return io.ErrShortWrite
+	}
+	start := cacheAt
+	for _, p := range records {
+		n, err := safeCopy(l.mmapSpace[cacheAt:], p)
+		if err != nil {
+			l.dropMapping()
+			l.reportError(err)
+			return err
+		}
+		cacheAt += int64(n)
+		l.writeAt += int64(n)
+		l.stats.logged.Add(int64(n))
+	}
+	if err := writeThrough(l.mmapSpace, start, cacheAt); err != nil {
+		l.reportError(err)
+	}
+	return nil
+}
+
+// 确保从当前写入位置开始有 need 字节的可写空间：按需打开文件、检查外部修改、退出缓冲写、重新映射或轮换。调用方需持有锁
+func (l *MMapLogger) reserve(need int) error {
+	if l.file == nil { // 如果文件未打开
+		if err := l.openExistingOrNew(); err != nil { // 尝试打开现有文件或创建新文件
+			return err
+		}
+	}
+	if err := l.checkFile(); err != nil {
+		return err
+	}
+	// 缓冲写时，预算有空余或需要轮换则退出缓冲写，重新尝试映射
+	if l.buffered != nil && (l.writeAt+int64(need) > l.max() || budgetFits(int64(l.chunkSize()), false)) {
+		if err := l.stopBuffered(); err != nil {
+			return err
+		}
+	}
+	if l.buffered == nil && need >= int(l.size)-int(l.writeAt) { // 如果写入数据会导致文件超过最大大小
+		if err := l.allocateSpace(need); err != nil { // 尝试分配更多空间
+			return err
+		}
+	}
+	if len(l.pendingEvents) > 0 { // 打开或轮换后先写入生命周期记录，再为这次写入重新检查空间
+		l.flushLifecycle()
+		return l.reserve(need)
+	}
+	return nil
+}
+
+// Warmup 提前完成创建目录、打开文件、调整文件大小和映射第一个窗口，避免第一次写入在调用方的协程中承担这些开销。
+// 同时预先触发写入位置所在页的缺页，第一条记录的延迟从毫秒级降到微秒级（见 BenchmarkFirstWrite）。已经打开并映射时不做任何事
+func (l *MMapLogger) Warmup() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		if err := l.openExistingOrNew(); err != nil {
+			return err
+		}
+	}
+	if len(l.mmapSpace) > 0 || l.buffered != nil {
+		return nil
+	}
+	if err := l.allocateSpace(0); err != nil {
+		return err
 	}
-	copy(l.mmapSpace[cacheAt:], p) // 将数据复制到内存映射空间
-	l.writeAt += int64(len(p))     // 更新写入位置
-	l.size += int64(n)             // 更新文件大小
-	return n, err
+	l.flushLifecycle()
+	if len(l.mmapSpace) == 0 {
+		return nil
+	}
+	// 写入写入位置所在页的原有内容，提前触发缺页
+	at := l.writeAt - l.writeStartAt
+	_, err := safeCopy(l.mmapSpace[at:at+1], []byte{l.mmapSpace[at]})
+	return err
+}
+
+// Sync 通过 msync 将映射空间中已写入的数据同步到磁盘
+func (l *MMapLogger) Sync() error {
+	l.flushAsync()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sync()
+}
+
+func (l *MMapLogger) sync() error {
+	if l.buffered != nil {
+		if err := l.buffered.Flush(); err != nil {
+			return err
+		}
+		if l.SyncAsync {
+			return nil
+		}
+		return l.file.Sync()
+	}
+	used := int(l.writeAt - l.writeStartAt)
+	if len(l.mmapSpace) == 0 || used <= 0 {
+		return nil
+	}
+	if used > len(l.mmapSpace) {
+		used = len(l.mmapSpace)
+	}
+	if err := msync(l.mmapSpace[:used], l.SyncAsync); err != nil {
+		return err
+	}
+	if l.SyncFile && !l.SyncAsync {
+		return l.file.Sync()
+	}
+	return nil
 }
 
 // 关闭 MMapLogger 实例的文件，并释放相关资源。
 func (l *MMapLogger) Close() error {
+	l.haltScheduler()
+	l.haltMill()
+	l.stopAsync()
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return l.close()
+	l.stopScheduler()
+	l.maint.stop()
+	if l.file != nil {
+		l.queueLifecycle(LifecycleEvent{Event: LifecycleClose})
+		l.flushLifecycle()
+	}
+	if err := l.close(); err != nil {
+		return err
+	}
+	return l.removeCrashMarker()
 }
 
 func (l *MMapLogger) close() error {
 	if l.file == nil {
 		return nil
 	}
+	if err := l.stopBuffered(); err != nil {
+		return err
+	}
+	if err := l.unMap(); err != nil { // 关闭前解除映射并截掉未写入的填充
+		return err
+	}
 	err := l.file.Close()
 	l.file = nil
 	return err
 }
 
-// 旋转日志文件，创建一个新的日志文件并关闭旧的日志文件
+// 旋转日志文件，创建一个新的日志文件并关闭旧的日志文件。
+// 与 Write、WriteBatch、Reserve 等使用同一把锁，重新映射和轮换都在锁内完成，
+// 并发调用时每条记录完整地落在轮换前或轮换后的文件中，写入位置不会与映射窗口错位
 func (l *MMapLogger) Rotate() error {
+	l.flushAsync()
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return l.rotate()
+	if err := l.rotate(); err != nil {
+		return err
+	}
+	l.flushLifecycle()
+	return nil
 }
 
 // 执行日志文件的旋转操作
@@ -118,12 +657,17 @@ func (l *MMapLogger) rotate() error {
 	if err := l.openNew(); err != nil {
 		return err
 	}
+	l.counters.rotations.Add(1)
+	l.queueLifecycle(LifecycleEvent{Event: LifecycleRotate})
 	l.mill()
 	return nil
 }
 
 // 创建一个新的日志文件
 func (l *MMapLogger) openNew() error {
+	if err := l.resolveFilename(); err != nil {
+		return err
+	}
 	err := os.MkdirAll(l.dir(), 0664)
 	if err != nil {
 		return fmt.Errorf("can't make directories for new logfile: %s", err)
@@ -132,38 +676,38 @@ func (l *MMapLogger) openNew() error {
 	name := l.filename()
 	info, err := os_Stat(name)
 	if err == nil {
-		newname := backupName(name, l.LocalTime)
+		newname := l.nextBackupName(name)
 		if err := os.Rename(name, newname); err != nil {
 			return fmt.Errorf("can't rename log file: %s", err)
 		}
+		l.inventoryAdd(filepath.Base(newname))
 
 		if err := chown(name, info); err != nil {
 			return err
 		}
 	}
 
-	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0664)
+	f, err := l.openFile(name)
 	if err != nil {
-		return fmt.Errorf("can't open new logfile: %s", err)
+		return fmt.Errorf("can't open new logfile: %w", err)
 	}
 	l.file = f
 	fileStat, err := l.file.Stat()
 	if err != nil {
-		fmt.Printf("获取文件信息错误：%+v\n", err)
-		return err
+		return fmt.Errorf("can't stat new logfile: %w", err)
 	}
 	l.size = fileStat.Size()
 	l.writeAt = fileStat.Size()
-	return nil
+	l.reserveFile()
+	return l.writeHeader()
 }
 
 // 生成备份文件名
-func backupName(name string, local bool) string {
+func backupName(name string, t time.Time, local bool) string {
 	dir := filepath.Dir(name)
 	filename := filepath.Base(name)
 	ext := filepath.Ext(filename)
 	prefix := filename[:len(filename)-len(ext)]
-	t := currentTime()
 	if !local {
 		t = t.UTC()
 	}
@@ -172,11 +716,40 @@ func backupName(name string, local bool) string {
 	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, timestamp, ext))
 }
 
+// 生成备份文件名，并保证其时间戳晚于已有的最新备份。
+// 时钟回拨（如 NTP 校正）时直接使用当前时间会让最新的备份排在最旧的位置而被清理，甚至覆盖已有备份
+func (l *MMapLogger) nextBackupName(name string) string {
+	newname := backupName(name, l.backupTime(), l.LocalTime)
+	files, err := l.oldLogFiles()
+	if err != nil || len(files) == 0 {
+		return newname
+	}
+	prefix, ext := l.prefixAndExt()
+	ts, err := l.timeFromName(filepath.Base(newname), prefix, ext)
+	if err != nil || ts.After(files[0].timestamp) {
+		return newname
+	}
+	ts = files[0].timestamp.Add(time.Millisecond)
+	return filepath.Join(filepath.Dir(name), prefix+ts.Format(backupTimeFormat)+ext)
+}
+
 // 打开现有的日志文件或创建一个新的日志文件
-func (l *MMapLogger) openExistingOrNew() error {
+func (l *MMapLogger) openExistingOrNew() (err error) {
+	defer func() {
+		if err == nil {
+			l.queueLifecycle(LifecycleEvent{Event: LifecycleOpen})
+		}
+	}()
+	if err := l.resolveFilename(); err != nil {
+		return err
+	}
 	l.mill()
+	l.startScheduler()
 	filename := l.filename()
-	_, err := os_Stat(filename)
+	if err := l.checkCrashMarker(filename); err != nil {
+		return err
+	}
+	_, err = os_Stat(filename)
 	if os.IsNotExist(err) {
 		return l.openNew()
 	}
@@ -184,22 +757,66 @@ func (l *MMapLogger) openExistingOrNew() error {
 		return fmt.Errorf("error getting log file info: %s", err)
 	}
 
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0664)
+	file, err := l.openFile(filename)
+	if errors.Is(err, ErrTooManyFiles) { // 不能轮换走仍然完好的文件
+		return fmt.Errorf("can't open logfile: %w", err)
+	}
 	if err != nil {
 		return l.openNew()
 	}
 	fileStat, err := file.Stat()
 	if err != nil {
-		fmt.Printf("获取文件信息错误：%+v\n", err)
-		return err
+		file.Close()
+		return fmt.Errorf("can't stat logfile: %w", err)
+	}
+	size := fileStat.Size()
+	if !l.KeepPadding {
+		// 上次没有正常关闭时文件末尾留有映射填充，截掉后从实际数据末尾继续写入
+		kept, trimmed, err := trimFilePadding(file, size)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("can't recover log file: %s", err)
+		}
+		if trimmed > 0 {
+			l.queueLifecycle(LifecycleEvent{Event: LifecycleRecover, Salvaged: kept, Trimmed: trimmed})
+		}
+		size = kept
 	}
 	l.file = file
-	l.size = fileStat.Size()
-	l.writeAt = fileStat.Size()
+	l.size = size
+	l.writeAt = size
+	l.reserveFile()
+	return l.writeHeader()
+}
+
+// 设置 PreallocateFile 时为当前文件预留 MaxSize 的磁盘块。预留失败（如磁盘空间不足）不影响写入，只报告错误
+func (l *MMapLogger) reserveFile() {
+	if !l.PreallocateFile || l.max() == math.MaxInt64 {
+		return
+	}
+	if err := reserveFile(l.file, l.max()); err != nil {
+		l.reportError(fmt.Errorf("can't reserve %d bytes for log file: %w", l.max(), err))
+	}
+}
+
+// 文件为空时写入文件头，之后的映射从文件头之后开始写入
+func (l *MMapLogger) writeHeader() error {
+	if len(l.Header) == 0 || l.writeAt != 0 {
+		return nil
+	}
+	n, err := l.file.WriteAt(l.Header, 0)
+	if err != nil {
+		return fmt.Errorf("can't write log file header: %s", err)
+	}
+	l.size = int64(n)
+	l.writeAt = int64(n)
 	return nil
 }
 
 func (l *MMapLogger) filename() string {
+	if l.resolved != "" {
+		return l.resolved
+	}
 	if l.Filename != "" {
 		return l.Filename
 	}
@@ -207,41 +824,140 @@ func (l *MMapLogger) filename() string {
 	return filepath.Join(os.TempDir(), name)
 }
 
-// 启动日志文件轮换的协程
+// 启动日志文件轮换的协程。调用方需持有锁
 func (l *MMapLogger) mill() {
-	l.startMill.Do(func() {
-		l.millCh = make(chan bool, 1)
-		go l.millRun()
-	})
+	if l.millCh == nil {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		l.millCh, l.millDone, l.millWG = make(chan bool, 1), make(chan struct{}), wg
+		go func(ch <-chan bool, done <-chan struct{}) {
+			defer wg.Done()
+			l.millRun(ch, done)
+		}(l.millCh, l.millDone)
+	}
+	l.progress.request()
 	select {
 	case l.millCh <- true:
 	default:
 	}
 }
 
-// 运行日志文件轮换的协程
-func (l *MMapLogger) millRun() {
-	for _ = range l.millCh {
-		_ = l.millRunOnce()
+// 停止清理协程并等待它退出，正在执行的清理会被取消，之后打开或轮换文件时重新启动。调用方不能持有锁
+func (l *MMapLogger) haltMill() {
+	l.mu.Lock()
+	wg := l.millWG
+	if l.millDone != nil {
+		close(l.millDone)
+	}
+	l.millCh, l.millDone, l.millWG = nil, nil, nil
+	l.mu.Unlock()
+	l.maint.stop()
+	if wg != nil {
+		wg.Wait()
+	}
+}
+
+// 运行日志文件轮换的协程。轮换触发的清理在 RetentionDebounce 内合并为一次，
+// 设置了 RetentionInterval 时另外定期执行。done 被关闭后退出
+func (l *MMapLogger) millRun(ch <-chan bool, done <-chan struct{}) {
+	defer l.progress.abandon()
+	var periodic <-chan time.Time
+	var timer *time.Timer
+	if l.RetentionInterval > 0 {
+		timer = time.NewTimer(l.jitter(l.RetentionInterval))
+		defer timer.Stop()
+		periodic = timer.C
+	}
+	for {
+		select {
+		case <-ch:
+			if l.RetentionDebounce > 0 {
+				debounce := time.NewTimer(l.jitter(l.RetentionDebounce))
+				select {
+				case <-debounce.C:
+				case <-done:
+					debounce.Stop()
+					return
+				}
+				select {
+				case <-ch: // 等待期间的触发合并到这一次
+				default:
+				}
+			}
+		case <-periodic:
+			timer.Reset(l.jitter(l.RetentionInterval))
+		case <-done:
+			return
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+		gen := l.progress.start()
+		err := l.millRunOnce(l.maint.context(), l.CompressSchedule == "")
+		l.counters.recordMill(err)
+		l.progress.complete(gen, err)
 	}
 }
 
-// 执行一次日志文件轮换操作
-func (l *MMapLogger) millRunOnce() error {
+// 在 d 的基础上随机浮动 RetentionJitter 比例，避免同时重启的大量实例同时扫描目录
+func (l *MMapLogger) jitter(d time.Duration) time.Duration {
+	j := l.RetentionJitter
+	if j == 0 {
+		j = defaultRetentionJitter
+	}
+	if j < 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + j*(2*rand.Float64()-1)))
+}
+
+// 执行一次日志文件轮换操作，compressNow 为 false 时只清理不压缩。ctx 取消后尽快停止，已开始的压缩会被放弃
+func (l *MMapLogger) millRunOnce(ctx context.Context, compressNow bool) error {
+	l.millMu.Lock()
+	defer l.millMu.Unlock()
 	if l.MaxBackups == 0 && l.MaxAge == 0 && !l.Compress {
-		return nil
+		return l.enforceQuota()
 	}
 
 	files, err := l.oldLogFiles()
 	if err != nil {
 		return err
 	}
+	remove, compress, files, kept := l.planRetention(files, compressNow)
+
+	for _, f := range remove {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		errRemove := os.Remove(filepath.Join(l.dir(), f.Name()))
+		if err == nil && errRemove != nil {
+			err = errRemove
+		}
+		if errRemove == nil {
+			l.inventoryRemove(f.Name())
+		}
+	}
+	errCompress := l.runCompress(func() error {
+		return l.compressAll(ctx, compress, compressNow, append(files, kept...))
+	})
+	if err == nil {
+		err = errCompress
+	}
+	if errQuota := l.enforceQuota(); err == nil {
+		err = errQuota
+	}
+	return err
+}
 
-	var compress, remove []logInfo
+// 按 MaxBackups、MaxAge、Compress 计算需要删除和压缩的备份，返回剩余的和被保留的备份
+func (l *MMapLogger) planRetention(files []logInfo, compressNow bool) (remove, compress, remaining, kept []logInfo) {
+	files, kept = l.splitExempt(files) // 被保留的备份不参与数量和时间的清理
 
 	if l.MaxBackups > 0 && l.MaxBackups < len(files) {
 		preserved := make(map[string]bool)
-		var remaining []logInfo
+		var rest []logInfo
 		for _, f := range files {
 			fn := f.Name()
 			if strings.HasSuffix(fn, compressSuffix) {
@@ -252,53 +968,68 @@ func (l *MMapLogger) millRunOnce() error {
 			if len(preserved) > l.MaxBackups {
 				remove = append(remove, f)
 			} else {
-				remaining = append(remaining, f)
+				rest = append(rest, f)
 			}
 		}
-		files = remaining
+		files = rest
 	}
 	if l.MaxAge > 0 {
 		diff := time.Duration(int64(24*time.Hour) * int64(l.MaxAge))
-		cutoff := currentTime().Add(-1 * diff)
+		cutoff := l.now().Add(-1 * diff)
 
-		var remaining []logInfo
+		var rest []logInfo
 		for _, f := range files {
 			if f.timestamp.Before(cutoff) {
 				remove = append(remove, f)
 			} else {
-				remaining = append(remaining, f)
+				rest = append(rest, f)
 			}
 		}
-		files = remaining
+		files = rest
 	}
 
-	if l.Compress {
-		for _, f := range files {
+	if l.Compress && compressNow {
+		for _, f := range append(files, kept...) {
 			if !strings.HasSuffix(f.Name(), compressSuffix) {
 				compress = append(compress, f)
 			}
 		}
 	}
 
-	for _, f := range remove {
-		errRemove := os.Remove(filepath.Join(l.dir(), f.Name()))
-		if err == nil && errRemove != nil {
-			err = errRemove
-		}
-	}
+	return remove, compress, files, kept
+}
+
+// 压缩 compress 中的备份，并重新压缩 files 中过期的压缩备份
+func (l *MMapLogger) compressAll(ctx context.Context, compress []logInfo, compressNow bool, files []logInfo) (err error) {
 	for _, f := range compress {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		fn := filepath.Join(l.dir(), f.Name())
-		errCompress := compressLogFile(fn, fn+compressSuffix)
-		if err == nil && errCompress != nil {
-			err = errCompress
+		errCompress := compressLogFile(ctx, fn, fn+compressSuffix, l.CompressRateLimit)
+		if errCompress != nil {
+			l.counters.recordCompressFailure(ctx)
+			if err == nil {
+				err = errCompress
+			}
+		}
+		if errCompress == nil {
+			l.stats.recordCompress(f.Size(), fn+compressSuffix)
+			l.inventoryRemove(f.Name())
+			l.inventoryAdd(f.Name() + compressSuffix)
+		}
+	}
+	if l.Compress && compressNow && l.RecompressAfter > 0 {
+		errRecompress := l.recompressOld(ctx, files)
+		if err == nil && errRecompress != nil {
+			err = errRecompress
 		}
 	}
-
 	return err
 }
 
 // 压缩指定的日志文件，并将其重命名为指定的目标文件名
-func compressLogFile(src, dst string) (err error) {
+func compressLogFile(ctx context.Context, src, dst string, rate int) (err error) {
 	f, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %v", err)
@@ -314,13 +1045,15 @@ func compressLogFile(src, dst string) (err error) {
 		return fmt.Errorf("failed to chown compressed log file: %v", err)
 	}
 
-	gzf, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, 0664)
+	gzf, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0664)
 	if err != nil {
 		return fmt.Errorf("failed to open compressed log file: %v", err)
 	}
 	defer gzf.Close()
 
 	gz := gzip.NewWriter(gzf)
+	gz.Header.Name = filepath.Base(src)
+	gz.Header.Extra = fileIDExtra(fi) // 读取方据此找到压缩前的文件，见 CompressedFileID
 
 	defer func() {
 		if err != nil {
@@ -329,15 +1062,23 @@ func compressLogFile(src, dst string) (err error) {
 		}
 	}()
 
-	if _, err := io.Copy(gz, f); err != nil {
+	sum := newChecksum()
+	if _, err := copyThrottled(ctx, gz, io.TeeReader(f, sum), rate); err != nil {
 		return err
 	}
 	if err := gz.Close(); err != nil {
 		return err
 	}
+	if err := gzf.Sync(); err != nil {
+		return err
+	}
 	if err := gzf.Close(); err != nil {
 		return err
 	}
+	// 删除源文件前重新读取压缩文件进行校验，部分写入的副本不能替代唯一的原始日志
+	if err := sum.verifyGzip(dst); err != nil {
+		return err
+	}
 
 	if err := f.Close(); err != nil {
 		return err
@@ -349,8 +1090,8 @@ func compressLogFile(src, dst string) (err error) {
 	return nil
 }
 
-// 获取日志文件目录中的所有旧日志文件信息
-func (l *MMapLogger) oldLogFiles() ([]logInfo, error) {
+// 扫描日志目录，获取所有旧日志文件信息
+func (l *MMapLogger) scanLogFiles() ([]logInfo, error) {
 	files, err := ioutil.ReadDir(l.dir())
 	if err != nil {
 		return nil, fmt.Errorf("can't read log file directory: %s", err)
@@ -392,12 +1133,39 @@ func (l *MMapLogger) timeFromName(filename, prefix, ext string) (time.Time, erro
 
 // 返回最大文件大小。
 func (l *MMapLogger) max() int64 {
-	if l.MaxSize == 0 {
+	if l.MaxSize == UnlimitedSize {
+		return math.MaxInt64
+	}
+	if l.MaxSize <= 0 { // Validate 拒绝其他负数，未校验时按默认值处理
 		return int64(defaultMmapMaxSize * megabyte)
 	}
 	return int64(l.MaxSize) * int64(megabyte)
 }
 
+// 返回每次映射的大小。默认 10MB，设置了 ChunkSize 时按页向上对齐，但不超过文件最大大小的一半（按页对齐），
+// 否则 MaxSize 小于映射大小时每次重新映射都会触发一次轮换
+func (l *MMapLogger) chunkSize() int {
+	chunk := defaultMegaByteSize * megabyte
+	if l.ChunkSize > 0 {
+		chunk = (l.ChunkSize + pageSize - 1) / pageSize * pageSize
+	}
+	if half := int(l.max() / 2); half < chunk {
+		chunk = half - half%pageSize
+	}
+	if chunk < pageSize {
+		chunk = pageSize
+	}
+	return chunk
+}
+
+// 返回不小于 chunk、能容纳从映射起点偏移 offset 处开始写入 need 字节的映射大小（按页对齐）
+func fitChunk(chunk int, offset int64, need int) int {
+	if end := int(offset) + need; end > chunk {
+		chunk = (end + pageSize - 1) / pageSize * pageSize
+	}
+	return chunk
+}
+
 // 返回文件所在目录
 func (l *MMapLogger) dir() string {
 	return filepath.Dir(l.filename())
@@ -419,7 +1187,10 @@ type logInfo struct {
 type byFormatTime []logInfo
 
 func (b byFormatTime) Less(i, j int) bool {
-	return b[i].timestamp.After(b[j].timestamp)
+	if !b[i].timestamp.Equal(b[j].timestamp) {
+		return b[i].timestamp.After(b[j].timestamp)
+	}
+	return b[i].ModTime().After(b[j].ModTime()) // 时间戳相同时以修改时间区分新旧
 }
 
 func (b byFormatTime) Swap(i, j int) {
@@ -439,8 +1210,11 @@ func chown(name string, info os.FileInfo) error {
 		return err
 	}
 	f.Close()
-	stat := info.Sys().(*syscall.Stat_t)
-	return os_Chown(name, int(stat.Uid), int(stat.Gid))
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return nil
+	}
+	return os_Chown(name, uid, gid)
 }
 
 // 解析内存映射文件
@@ -449,60 +1223,152 @@ func (l *MMapLogger) unMap() error {
 	if len(l.mmapSpace) == 0 {
 		return nil
 	}
-	// 使用 syscall.Munmap 函数解映射内存映射空间
-	if err := syscall.Munmap(l.mmapSpace); err != nil {
+	// 解映射内存映射空间
+	if err := munmap(l.mmapSpace); err != nil {
 		return err
 	}
-	// 使用 syscall.Ftruncate 函数调整文件大小至写入位置
-	if err := syscall.Ftruncate(int(l.file.Fd()), l.writeAt); err != nil {
-		// 如果调整文件大小失败，则打印错误信息
-		fmt.Printf("unMap Ftruncate file fail. error: %v", err)
+	releaseBudget(int64(len(l.mmapSpace)))
+	l.stats.recordUnmap(l.writeAt-l.writeStartAt, int64(len(l.mmapSpace)))
+	l.mmapSpace = nil
+	// 调整文件大小至写入位置
+	if err := l.file.Truncate(l.writeAt); err != nil {
+		// 截断失败不影响已写入的数据，只是文件末尾留有填充，报告后继续
+		l.reportError(fmt.Errorf("can't truncate logfile to %d bytes: %w", l.writeAt, err))
 	}
 	// 返回 nil 表示解映射和调整文件大小成功
 	return nil
 }
 
-// 分配内存映射空间
-func (l *MMapLogger) allocateSpace() error {
+// 定期检查日志文件是否被外部轮换或截断
+func (l *MMapLogger) checkFile() error {
+	now := l.now()
+	if now.Sub(l.lastSizeCheck) < sizeCheckInterval {
+		return nil
+	}
+	l.lastSizeCheck = now
+	if l.DetectRotation {
+		if rotated, err := l.checkRotated(); rotated || err != nil {
+			return err
+		}
+	}
+	l.checkTruncated()
+	return nil
+}
+
+// 检查文件名指向的文件是否仍是当前打开的文件。logrotate 等外部工具重命名文件后，
+// 先解除映射并截掉旧文件末尾的填充，再重新打开文件名对应的文件
+func (l *MMapLogger) checkRotated() (bool, error) {
+	current, err := l.file.Stat()
+	if err != nil {
+		return false, nil
+	}
+	info, err := os_Stat(l.filename())
+	if err == nil && os.SameFile(info, current) {
+		return false, nil
+	}
+	if err := l.close(); err != nil {
+		return true, err
+	}
+	return true, l.openExistingOrNew()
+}
+
+// 通过 fstat 检查文件是否被外部截断到映射范围以内。
+// 如果是，则丢弃当前映射并从文件实际末尾继续写入，避免后续访问映射空间时触发 SIGBUS
+func (l *MMapLogger) checkTruncated() {
+	if len(l.mmapSpace) == 0 {
+		return
+	}
+	info, err := l.file.Stat()
+	if err != nil || info.Size() >= l.size {
+		return
+	}
+	l.reportError(fmt.Errorf("%w: size %d, mapped up to %d", ErrExternalTruncate, info.Size(), l.size))
+	l.dropMapping()
+}
+
+// 通过 OnError 上报错误，未设置时打印到标准错误
+func (l *MMapLogger) reportError(err error) {
+	l.counters.errors.Add(1)
+	if l.OnError != nil {
+		l.OnError(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "mmap logger error: %v\n", err)
+}
+
+// 丢弃已失效的映射而不截断文件，使下一次写入重新分配映射空间。
+// 文件被外部截断到写入位置以内时从文件实际末尾继续写入，否则重新映射后两者之间会留下一段 NUL
+func (l *MMapLogger) dropMapping() {
+	if len(l.mmapSpace) > 0 {
+		_ = discardMapping(l.mmapSpace)
+		releaseBudget(int64(len(l.mmapSpace)))
+		l.mmapSpace = nil
+	}
+	if l.file != nil {
+		if info, err := l.file.Stat(); err == nil && info.Size() < l.writeAt {
+			l.writeAt = info.Size()
+		}
+	}
+	l.size = l.writeAt
+}
+
+// 分配内存映射空间，映射至少能容纳从当前写入位置开始的 need 字节
+func (l *MMapLogger) allocateSpace(need int) error {
 	// 先解除当前的内存映射
 	if err := l.unMap(); err != nil {
-		// 如果解除映射失败，则打印错误信息并返回错误
-		fmt.Printf("unMap fail. error: %v", err)
+		// 如果解除映射失败，则返回错误
 		return err
 	}
-	// 计算新的内存映射空间的大小（默认大小乘以兆字节）
-	megaByteSize := defaultMegaByteSize * megabyte
+	// unMap 截断文件时会释放超出写入位置的预留块，重新预留
+	l.reserveFile()
+	// 计算新的内存映射空间的大小
+	megaByteSize := l.chunkSize()
 	// 计算当前写入位置对应的页数
 	pageLen := int64(l.writeAt / int64(pageSize))
 	// 计算新的写入起始位置
 	writeStartAt := int64(pageLen * int64(pageSize))
+	// 映射较小时（如只有一页）扩大到能容纳这条记录
+	megaByteSize = fitChunk(megaByteSize, l.writeAt-writeStartAt, need)
 	// 如果新的写入起始位置加上新的内存映射空间大小超过最大限制，则尝试旋转日志文件
 	if writeStartAt+int64(megaByteSize) > l.max() {
 		if err := l.rotate(); err != nil {
-			// 如果旋转日志文件失败，则打印错误信息并返回错误
-			fmt.Printf("rotate fail. error: %v", err)
+			// 如果旋转日志文件失败，则返回错误
 			return err
 		}
 		// 重置页数和写入起始位置
 		pageLen = 0
 		writeStartAt = 0
+		megaByteSize = fitChunk(l.chunkSize(), l.writeAt, need)
+	}
+	// 超出映射预算时改为缓冲写
+	if !budgetFits(int64(megaByteSize), true) {
+		l.startBuffered()
+		return nil
 	}
 	// 调整文件大小以适应新的内存映射空间
-	if err := syscall.Ftruncate(int(l.file.Fd()), writeStartAt+int64(megaByteSize)); err != nil {
-		// 如果调整文件大小失败，则打印错误信息并返回错误
-		fmt.Printf("syscall Ftruncate fail. error: %v", err)
-		return err
+	if err := growFile(l.file, writeStartAt+int64(megaByteSize), l.Preallocate); err != nil {
+		// 如果调整文件大小失败，则释放预算并返回错误
+		releaseBudget(int64(megaByteSize))
+		return fmt.Errorf("can't grow logfile: %w", err)
 	}
 	// 创建新的内存映射空间
-	mmapSpace, err := syscall.Mmap(int(l.file.Fd()), writeStartAt, int(megaByteSize), syscall.PROT_WRITE, syscall.MAP_SHARED)
+	mmapSpace, err := mmapFile(l.file, writeStartAt, int(megaByteSize))
 	if err != nil {
-		// 如果创建内存映射空间失败，则打印错误信息并返回错误
-		fmt.Printf("syscall mmap fail.  error: %v", err)
-		return err
+		// 如果创建内存映射空间失败，则释放预算并返回错误
+		releaseBudget(int64(megaByteSize))
+		return fmt.Errorf("can't map logfile: %w", err)
+	}
+	if l.Advice != "" {
+		if err := madvise(mmapSpace, l.Advice); err != nil {
+			l.reportError(err)
+		}
 	}
 	// 更新 MMapLogger 的相关字段
 	l.mmapSpace = mmapSpace
 	l.writeStartAt = writeStartAt
 	l.size = writeStartAt + int64(megaByteSize)
+	l.lastSizeCheck = l.now()
+	l.stats.remaps.Add(1)
+	l.stats.mapped.Add(int64(megaByteSize))
 	return nil
 }
@@ -0,0 +1,167 @@
+//go:build nosyscall || !(unix || windows)
+
+// 不使用 syscall 包的实现，供禁止导入 syscall 的受限构建环境通过 -tags nosyscall 选择，
+// 也是既非 Unix 也非 Windows、无法映射文件的平台（如 js/wasm）上的实现，对外接口不变。
+// 映射空间由内存缓冲区模拟：映射时读入文件已有的内容，每次写入后通过 WriteAt 写回文件，对其他读者立即可见，
+// 但每条记录多一次系统调用；Sync 只在 SyncAsync 为 false 时同步到磁盘。进程崩溃时已写入的记录不会丢失，但可能还未落盘；
+// RefuseSymlink 只在打开前检查，不能防止检查之后被替换成链接；不会保留备份文件的属主；Preallocate、PreallocateFile 和 Advice 不生效。
+
+package logger
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 没有不跟随符号链接的可移植标志
+const oNoFollow = 0
+
+// 映射空间是否由缓冲区模拟
+const mmapEmulated = true
+
+// 模拟的映射空间对应的文件区域
+type region struct {
+	file *os.File
+	off  int64
+}
+
+var regions = struct {
+	sync.Mutex
+	m map[*byte]region
+}{m: make(map[*byte]region)}
+
+// 分配 size 字节的缓冲区模拟文件 f 从 off 开始的映射，并读入该范围内已有的内容
+func mmapFile(f *os.File, off int64, size int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := f.ReadAt(b, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	regions.Lock()
+	regions.m[&b[0]] = region{file: f, off: off}
+	regions.Unlock()
+	return b, nil
+}
+
+// 将缓冲区写回文件并释放
+func munmap(b []byte) error {
+	r, ok := releaseRegion(b)
+	if !ok {
+		return errors.New("munmap: not a mapped region")
+	}
+	_, err := r.file.WriteAt(b, r.off)
+	return err
+}
+
+// 丢弃已失效的映射，不写回，避免把外部截断的文件重新写大
+func discardMapping(b []byte) error {
+	releaseRegion(b)
+	return nil
+}
+
+// 将映射空间开头的 b 写回文件，async 为 false 时同步到磁盘
+func msync(b []byte, async bool) error {
+	regions.Lock()
+	r, ok := regions.m[&b[0]]
+	regions.Unlock()
+	if !ok {
+		return errors.New("msync: not a mapped region")
+	}
+	if _, err := r.file.WriteAt(b, r.off); err != nil {
+		return err
+	}
+	if async {
+		return nil
+	}
+	return r.file.Sync()
+}
+
+// 将映射空间 b 中刚写入的 [from, to) 写回文件
+func writeThrough(b []byte, from, to int64) error {
+	if from >= to {
+		return nil
+	}
+	regions.Lock()
+	r, ok := regions.m[&b[0]]
+	regions.Unlock()
+	if !ok {
+		return errors.New("write through: not a mapped region")
+	}
+	_, err := r.file.WriteAt(b[from:to], r.off+from)
+	return err
+}
+
+// 将文件扩大到 size，不支持预先分配磁盘块
+func growFile(f *os.File, size int64, preallocate bool) error {
+	return f.Truncate(size)
+}
+
+// 不支持预留磁盘块
+func reserveFile(f *os.File, size int64) error {
+	return nil
+}
+
+// 缓冲区模拟的映射不需要 madvise
+func madvise(b []byte, advice string) error {
+	return nil
+}
+
+func releaseRegion(b []byte) (region, bool) {
+	regions.Lock()
+	defer regions.Unlock()
+	r, ok := regions.m[&b[0]]
+	delete(regions.m, &b[0])
+	return r, ok
+}
+
+// 判断 err 是否因文件描述符耗尽（EMFILE/ENFILE）而失败，没有 syscall 包时按错误信息判断
+func isFDExhausted(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "too many open files")
+}
+
+// 返回文件的属主和组，通过反射读取 info.Sys() 中的字段
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	u, ok := statField(info, "Uid")
+	if !ok {
+		return 0, 0, false
+	}
+	g, ok := statField(info, "Gid")
+	if !ok {
+		return 0, 0, false
+	}
+	return int(u), int(g), true
+}
+
+// 返回文件实际占用的磁盘空间，无法获取时返回文件大小
+func diskUsage(info os.FileInfo) int64 {
+	if blocks, ok := statField(info, "Blocks"); ok {
+		return blocks * 512
+	}
+	return info.Size()
+}
+
+// 返回文件的设备号和 inode，通过反射读取 info.Sys() 中的字段
+func fileID(info os.FileInfo) (dev, ino uint64) {
+	d, _ := statField(info, "Dev")
+	i, _ := statField(info, "Ino")
+	return uint64(d), uint64(i)
+}
+
+// 读取 info.Sys() 指向的结构体中名为 name 的整数字段
+func statField(info os.FileInfo, name string) (int64, bool) {
+	v := reflect.ValueOf(info.Sys())
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return 0, false
+	}
+	f := v.Elem().FieldByName(name)
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(f.Uint()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,25 @@
+//go:build unix && !linux && !nosyscall
+
+package logger
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var madviseAdvice = map[string]int{
+	"sequential": unix.MADV_SEQUENTIAL,
+	"random":     unix.MADV_RANDOM,
+	"willneed":   unix.MADV_WILLNEED,
+}
+
+// 将文件扩大到 size。只有 Linux 支持 fallocate，其他平台忽略 preallocate
+func growFile(f *os.File, size int64, preallocate bool) error {
+	return f.Truncate(size)
+}
+
+// 只有 Linux 支持 fallocate，其他平台不预留磁盘块
+func reserveFile(f *os.File, size int64) error {
+	return nil
+}
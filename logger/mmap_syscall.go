@@ -0,0 +1,89 @@
+//go:build unix && !nosyscall
+
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// 打开文件时不跟随符号链接的标志
+const oNoFollow = unix.O_NOFOLLOW
+
+// 映射空间是否由缓冲区模拟
+const mmapEmulated = false
+
+// 将文件 f 从 off 开始的 size 字节以共享可写方式映射到内存
+func mmapFile(f *os.File, off int64, size int) ([]byte, error) {
+	return unix.Mmap(int(f.Fd()), off, size, unix.PROT_WRITE, unix.MAP_SHARED)
+}
+
+// 解除映射，映射中的内容由内核写回文件
+func munmap(b []byte) error {
+	return unix.Munmap(b)
+}
+
+// 丢弃已失效的映射，文件已被截断的部分不会再写回
+func discardMapping(b []byte) error {
+	return unix.Munmap(b)
+}
+
+// 同步映射空间 b，async 为 true 时使用 MS_ASYNC 只安排写回，否则使用 MS_SYNC 等待写回完成
+func msync(b []byte, async bool) error {
+	flags := unix.MS_SYNC
+	if async {
+		flags = unix.MS_ASYNC
+	}
+	return unix.Msync(b, flags)
+}
+
+// 共享映射与文件使用同一份页缓存，写入映射即对其他读者可见
+func writeThrough(b []byte, from, to int64) error {
+	return nil
+}
+
+// 按 Advice 对映射空间调用 madvise
+func madvise(b []byte, advice string) error {
+	a, ok := madviseAdvice[advice]
+	if !ok {
+		return fmt.Errorf("unsupported mmap advice %q", advice)
+	}
+	if err := unix.Madvise(b, a); err != nil {
+		return fmt.Errorf("madvise %s: %v", advice, err)
+	}
+	return nil
+}
+
+// 判断 err 是否因文件描述符耗尽（EMFILE/ENFILE）而失败
+func isFDExhausted(err error) bool {
+	return errors.Is(err, unix.EMFILE) || errors.Is(err, unix.ENFILE)
+}
+
+// 返回文件的属主和组。os.FileInfo 中的是 syscall.Stat_t 而不是 unix.Stat_t
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// 返回文件实际占用的磁盘空间，无法获取时返回文件大小
+func diskUsage(info os.FileInfo) int64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Blocks * 512
+	}
+	return info.Size()
+}
+
+// 返回文件的设备号和 inode
+func fileID(info os.FileInfo) (dev, ino uint64) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev), uint64(stat.Ino)
+	}
+	return 0, 0
+}
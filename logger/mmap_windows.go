@@ -0,0 +1,138 @@
+//go:build windows && !nosyscall
+
+// Windows 上通过 CreateFileMapping/MapViewOfFile 实现共享可写映射，对外接口不变。
+// 文件不能被截断到映射范围以内，也没有 madvise、fallocate 和文件属主，Advice、Preallocate、PreallocateFile 不生效，不会保留备份文件的属主。
+
+package logger
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// 没有不跟随符号链接的打开标志，RefuseSymlink 只在打开前检查
+const oNoFollow = 0
+
+// 映射空间是否由缓冲区模拟
+const mmapEmulated = false
+
+// 映射视图的起始偏移必须是分配粒度的整数倍，Windows 上固定为 64KiB
+const allocationGranularity = 64 * 1024
+
+// 映射空间对应的视图
+type view struct {
+	addr uintptr        // 视图起始地址，映射空间从其后 off%allocationGranularity 字节开始
+	file windows.Handle // 被映射的文件，同步时用于刷新文件缓冲
+}
+
+var views = struct {
+	sync.Mutex
+	m map[*byte]view
+}{m: make(map[*byte]view)}
+
+// 将文件 f 从 off 开始的 size 字节以共享可写方式映射到内存。
+// 视图从 off 向下对齐到分配粒度处开始，返回其中对应 off 的部分
+func mmapFile(f *os.File, off int64, size int) ([]byte, error) {
+	file := windows.Handle(f.Fd())
+	end := uint64(off) + uint64(size)
+	mapping, err := windows.CreateFileMapping(file, nil, windows.PAGE_READWRITE, uint32(end>>32), uint32(end), nil)
+	if err != nil {
+		return nil, os.NewSyscallError("CreateFileMapping", err)
+	}
+	// 视图会保持映射对象有效，映射句柄可以立即关闭
+	defer windows.CloseHandle(mapping)
+	base := off - off%allocationGranularity
+	delta := int(off - base)
+	addr, err := windows.MapViewOfFile(mapping, windows.FILE_MAP_WRITE, uint32(uint64(base)>>32), uint32(base), uintptr(delta+size))
+	if err != nil {
+		return nil, os.NewSyscallError("MapViewOfFile", err)
+	}
+	b := unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&addr))), delta+size)[delta:]
+	views.Lock()
+	views.m[&b[0]] = view{addr: addr, file: file}
+	views.Unlock()
+	return b, nil
+}
+
+// 解除映射，映射中的内容由系统写回文件
+func munmap(b []byte) error {
+	v, ok := releaseView(b)
+	if !ok {
+		return errors.New("munmap: not a mapped region")
+	}
+	return os.NewSyscallError("UnmapViewOfFile", windows.UnmapViewOfFile(v.addr))
+}
+
+// 丢弃已失效的映射
+func discardMapping(b []byte) error {
+	return munmap(b)
+}
+
+// 同步映射空间 b，async 为 true 时只安排写回（FlushViewOfFile），否则再通过 FlushFileBuffers 等待写到磁盘
+func msync(b []byte, async bool) error {
+	views.Lock()
+	v, ok := views.m[&b[0]]
+	views.Unlock()
+	if !ok {
+		return errors.New("msync: not a mapped region")
+	}
+	if err := windows.FlushViewOfFile(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b))); err != nil {
+		return os.NewSyscallError("FlushViewOfFile", err)
+	}
+	if async {
+		return nil
+	}
+	return os.NewSyscallError("FlushFileBuffers", windows.FlushFileBuffers(v.file))
+}
+
+// 映射视图与文件共享同一份缓存，写入映射即对其他读者可见
+func writeThrough(b []byte, from, to int64) error {
+	return nil
+}
+
+// 将文件扩大到 size，Windows 上不支持预先分配磁盘块
+func growFile(f *os.File, size int64, preallocate bool) error {
+	return f.Truncate(size)
+}
+
+// Windows 上不支持预留磁盘块
+func reserveFile(f *os.File, size int64) error {
+	return nil
+}
+
+// Windows 上没有 madvise，Advice 不生效
+func madvise(b []byte, advice string) error {
+	return nil
+}
+
+func releaseView(b []byte) (view, bool) {
+	views.Lock()
+	defer views.Unlock()
+	v, ok := views.m[&b[0]]
+	delete(views.m, &b[0])
+	return v, ok
+}
+
+// 判断 err 是否因文件句柄耗尽而失败
+func isFDExhausted(err error) bool {
+	return errors.Is(err, windows.ERROR_TOO_MANY_OPEN_FILES)
+}
+
+// Windows 上的文件没有 uid/gid 形式的属主
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// Windows 上的 os.FileInfo 不带 inode，返回 0 表示未知
+func fileID(info os.FileInfo) (dev, ino uint64) {
+	return 0, 0
+}
+
+// 返回文件实际占用的磁盘空间，Windows 上按文件大小计算
+func diskUsage(info os.FileInfo) int64 {
+	return info.Size()
+}
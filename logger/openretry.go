@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	defaultOpenRetries = 3                     // 打开文件时因文件描述符耗尽默认的重试次数
+	defaultOpenBackoff = 10 * time.Millisecond // 第一次重试前的默认等待时间，之后每次翻倍
+)
+
+// ErrTooManyFiles 表示因进程（EMFILE）或系统（ENFILE）的文件描述符耗尽而无法打开日志文件，
+// 重试后仍然失败时返回的错误包装了它，可以用 errors.Is 判断。之后的写入会再次尝试打开
+var ErrTooManyFiles = errors.New("mmap logger: too many open files")
+
+// 打开日志文件。文件描述符耗尽时先调用 OnFDExhausted 释放空闲的文件，按指数退避重试 OpenRetries 次
+func (l *MMapLogger) openFile(name string) (*os.File, error) {
+	retries := l.OpenRetries
+	if retries == 0 {
+		retries = defaultOpenRetries
+	}
+	backoff := l.OpenBackoff
+	if backoff <= 0 {
+		backoff = defaultOpenBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(name, l.openFlags(), 0664)
+		if err == nil || !isFDExhausted(err) {
+			return f, err
+		}
+		if attempt >= retries {
+			return nil, fmt.Errorf("%w: %v", ErrTooManyFiles, err)
+		}
+		if l.OnFDExhausted != nil {
+			l.OnFDExhausted()
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,87 @@
+//go:build unix && !nosyscall
+
+package logger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// 调低 RLIMIT_NOFILE 并占满文件描述符，返回占用的文件，测试结束后关闭并恢复限制
+func exhaustFDs(t *testing.T) *[]*os.File {
+	t.Helper()
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &limit); err != nil {
+		t.Fatal(err)
+	}
+	lowered := limit
+	lowered.Cur = 256
+	if lowered.Cur > limit.Max {
+		t.Skipf("hard fd limit %d is below %d", limit.Max, lowered.Cur)
+	}
+	held := &[]*os.File{}
+	t.Cleanup(func() {
+		for _, f := range *held {
+			f.Close()
+		}
+		unix.Setrlimit(unix.RLIMIT_NOFILE, &limit)
+	})
+	if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &lowered); err != nil {
+		t.Skip(err)
+	}
+	for {
+		f, err := os.Open(os.DevNull)
+		if err != nil {
+			if !isFDExhausted(err) {
+				t.Fatal(err)
+			}
+			return held
+		}
+		*held = append(*held, f)
+	}
+}
+
+func TestOpenFileFDExhausted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "fd.log")
+	calls := 0
+	l := &MMapLogger{Filename: filename, OpenRetries: 2, OpenBackoff: time.Millisecond, OnFDExhausted: func() { calls++ }}
+	defer l.Close()
+	held := exhaustFDs(t)
+
+	if _, err := l.Write([]byte("dropped\n")); !errors.Is(err, ErrTooManyFiles) {
+		t.Fatalf("Write with no free fd = %v, want ErrTooManyFiles", err)
+	}
+	if calls != 2 {
+		t.Fatalf("OnFDExhausted called %d times, want once per retry", calls)
+	}
+
+	l.OnFDExhausted = func() { // 释放一个空闲的文件
+		calls++
+		if n := len(*held); n > 0 {
+			(*held)[n-1].Close()
+			*held = (*held)[:n-1]
+		}
+	}
+	calls = 0
+	if _, err := l.Write([]byte("kept\n")); err != nil {
+		t.Fatalf("Write after the callback freed an fd = %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("OnFDExhausted called %d times, want 1", calls)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "kept\n" {
+		t.Fatalf("file holds %q, want only the record written after the retry", data)
+	}
+}
@@ -0,0 +1,163 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Option 设置 New 创建的 MMapLogger 的一项配置
+type Option func(*MMapLogger)
+
+// New 返回写入 filename 的 MMapLogger，依次应用 opts 后通过 Validate 检查配置，配置无效时返回错误。
+// 与直接构造结构体相同，文件在第一次写入（或 Warmup）时才打开
+func New(filename string, opts ...Option) (*MMapLogger, error) {
+	l := &MMapLogger{Filename: filename}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// WithMaxSize 设置触发轮换的文件大小（以兆字节为单位），UnlimitedSize 表示不按大小轮换
+func WithMaxSize(megabytes int) Option {
+	return func(l *MMapLogger) { l.MaxSize = megabytes }
+}
+
+// WithChunkSize 设置每次映射的字节数，不能超过 MaxSize 的一半
+func WithChunkSize(bytes int) Option {
+	return func(l *MMapLogger) { l.ChunkSize = bytes }
+}
+
+// WithMaxAge 设置备份文件保留的天数
+func WithMaxAge(days int) Option {
+	return func(l *MMapLogger) { l.MaxAge = days }
+}
+
+// WithMaxBackups 设置保留的备份文件数
+func WithMaxBackups(n int) Option {
+	return func(l *MMapLogger) { l.MaxBackups = n }
+}
+
+// WithCompress 设置是否用 gzip 压缩备份文件
+func WithCompress(compress bool) Option {
+	return func(l *MMapLogger) { l.Compress = compress }
+}
+
+// WithLocalTime 设置备份文件名是否使用本地时间
+func WithLocalTime(local bool) Option {
+	return func(l *MMapLogger) { l.LocalTime = local }
+}
+
+// WithRotateSchedule 设置按 cron 表达式定时轮换
+func WithRotateSchedule(spec string) Option {
+	return func(l *MMapLogger) { l.RotateSchedule = spec }
+}
+
+// WithRotationInterval 设置在 interval 的整数倍时间点轮换
+func WithRotationInterval(interval time.Duration) Option {
+	return func(l *MMapLogger) { l.RotationInterval = interval }
+}
+
+// WithFlushInterval 设置后台 Sync 的间隔
+func WithFlushInterval(interval time.Duration) Option {
+	return func(l *MMapLogger) { l.FlushInterval = interval }
+}
+
+// WithAsync 设置异步写入的缓冲区字节数和缓冲区满时的策略
+func WithAsync(buffer int, overflow string) Option {
+	return func(l *MMapLogger) { l.AsyncBuffer, l.AsyncOverflow = buffer, overflow }
+}
+
+// WithClock 设置备份文件名、清理和定时任务使用的时间来源
+func WithClock(clock Clock) Option {
+	return func(l *MMapLogger) { l.Clock = clock }
+}
+
+// WithOnError 设置不会中断写入的异常的回调
+func WithOnError(onError func(err error)) Option {
+	return func(l *MMapLogger) { l.OnError = onError }
+}
+
+// Validate 检查配置是否有效，返回所有无效项合并后的错误。
+// 直接构造结构体时不会检查配置，可以在第一次写入前调用
+func (l *MMapLogger) Validate() error {
+	var errs []error
+	if l.MaxSize < 0 && l.MaxSize != UnlimitedSize {
+		errs = append(errs, fmt.Errorf("invalid MaxSize %d", l.MaxSize))
+	}
+	if l.ChunkSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid ChunkSize %d", l.ChunkSize))
+	} else if maxSize := l.max(); l.ChunkSize > 0 && l.MaxSize != UnlimitedSize && int64(l.ChunkSize) > maxSize/2 {
+		// chunkSize 会把映射大小限制到 MaxSize 的一半，这里直接报告而不是静默调整
+		errs = append(errs, fmt.Errorf("ChunkSize %d exceeds half of MaxSize (%d bytes)", l.ChunkSize, maxSize))
+	}
+	if l.PreallocateFile && l.max() == math.MaxInt64 {
+		errs = append(errs, errors.New("PreallocateFile needs a MaxSize to reserve"))
+	}
+	if l.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("invalid MaxAge %d", l.MaxAge))
+	}
+	if l.MaxBackups < 0 {
+		errs = append(errs, fmt.Errorf("invalid MaxBackups %d", l.MaxBackups))
+	}
+	if l.MaxRecordSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid MaxRecordSize %d", l.MaxRecordSize))
+	}
+	switch l.RecordPolicy {
+	case "", RecordPolicyError, RecordPolicyTruncate, RecordPolicySplit:
+	default:
+		errs = append(errs, fmt.Errorf("invalid RecordPolicy %q", l.RecordPolicy))
+	}
+	if l.RecompressLevel != 0 && (l.RecompressLevel < gzip.HuffmanOnly || l.RecompressLevel > gzip.BestCompression) {
+		errs = append(errs, fmt.Errorf("invalid RecompressLevel %d", l.RecompressLevel))
+	}
+	if err := checkRecompressFormat(l.RecompressFormat); err != nil {
+		errs = append(errs, err)
+	}
+	for _, spec := range []string{l.RotateSchedule, l.CompressSchedule} {
+		if spec == "" {
+			continue
+		}
+		if _, err := ParseSchedule(spec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if l.RotationInterval < 0 {
+		errs = append(errs, fmt.Errorf("invalid RotationInterval %v", l.RotationInterval))
+	}
+	if l.FlushInterval < 0 {
+		errs = append(errs, fmt.Errorf("invalid FlushInterval %v", l.FlushInterval))
+	}
+	for _, pattern := range l.KeepPatterns {
+		var err error
+		if strings.HasPrefix(pattern, regexpPattern) {
+			_, err = regexp.Compile(pattern[len(regexpPattern):])
+		} else {
+			_, err = filepath.Match(pattern, "")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid keep pattern %q: %v", pattern, err))
+		}
+	}
+	if l.AsyncBuffer < 0 {
+		errs = append(errs, fmt.Errorf("invalid AsyncBuffer %d", l.AsyncBuffer))
+	}
+	switch l.AsyncOverflow {
+	case "", AsyncBlock, AsyncDropOldest, AsyncDropNewest:
+	default:
+		errs = append(errs, fmt.Errorf("invalid AsyncOverflow %q", l.AsyncOverflow))
+	}
+	if l.QuotaSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid QuotaSize %d", l.QuotaSize))
+	}
+	return errors.Join(errs...)
+}
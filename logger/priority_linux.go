@@ -0,0 +1,18 @@
+//go:build linux && !nosyscall
+
+package logger
+
+import "syscall"
+
+const (
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+	ioprioWhoProcess = 1
+)
+
+// 将当前线程的 nice 值设为 19，IO 调度类设为 idle，失败时忽略
+func lowerThreadPriority() {
+	tid := syscall.Gettid()
+	_ = syscall.Setpriority(syscall.PRIO_PROCESS, tid, 19)
+	_, _, _ = syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle<<ioprioClassShift)
+}
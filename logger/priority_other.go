@@ -0,0 +1,6 @@
+//go:build !linux || nosyscall
+
+package logger
+
+// 仅在 Linux 上且未使用 nosyscall 构建标签时支持按线程降低优先级，其他情况不做处理
+func lowerThreadPriority() {}
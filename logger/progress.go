@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"context"
+	"sync"
+)
+
+// millProgress 记录清理任务的请求和完成进度，用于等待已请求的清理和压缩完成
+type millProgress struct {
+	mu        sync.Mutex
+	requested uint64        // 已请求的清理次数
+	completed uint64        // 已完成的清理覆盖到的请求次数
+	err       error         // 最近一次清理的错误
+	done      chan struct{} // 下一次清理完成时关闭
+}
+
+// 记录一次清理请求
+func (p *millProgress) request() {
+	p.mu.Lock()
+	p.requested++
+	p.mu.Unlock()
+}
+
+// 返回开始执行清理时已请求的次数，这次清理会覆盖这些请求
+func (p *millProgress) start() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requested
+}
+
+// 记录覆盖到 gen 次请求的清理已完成
+func (p *millProgress) complete(gen uint64, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if gen > p.completed {
+		p.completed = gen
+	}
+	p.err = err
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+}
+
+// 清理协程退出时放弃尚未执行的请求，使等待它们的 WaitMaintenance 返回 context.Canceled
+func (p *millProgress) abandon() {
+	p.mu.Lock()
+	pending := p.requested > p.completed
+	gen := p.requested
+	p.mu.Unlock()
+	if pending {
+		p.complete(gen, context.Canceled)
+	}
+}
+
+// WaitMaintenance 等待调用前已触发的清理、删除和压缩全部完成，返回最近一次清理的错误。
+// 批处理任务可以在 Close 之前调用，确保最后一次轮换产生的备份已被压缩；Close 会取消正在执行的压缩
+func (l *MMapLogger) WaitMaintenance(ctx context.Context) error {
+	p := &l.progress
+	p.mu.Lock()
+	target := p.requested
+	for p.completed < target {
+		if p.done == nil {
+			p.done = make(chan struct{})
+		}
+		done := p.done
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+		}
+		p.mu.Lock()
+	}
+	err := p.err
+	p.mu.Unlock()
+	return err
+}
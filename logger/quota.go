@@ -0,0 +1,165 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	quotaLockSuffix = ".lock"
+	quotaLockWait   = 5 * time.Second       // 获取配额锁的最长等待时间
+	quotaLockPoll   = 10 * time.Millisecond // 等待配额锁时的轮询间隔
+	quotaLockStale  = 30 * time.Second      // 锁文件超过该时间未释放时视为持有者已崩溃
+	quotaExpiry     = 7 * 24 * time.Hour    // 超过该时间未更新的成员不再计入总量，例如已下线的服务
+)
+
+// ErrQuotaLock 表示在等待时间内没有获取到共享配额文件的锁
+var ErrQuotaLock = errors.New("mmap logger: can't acquire quota lock")
+
+// 共享配额文件的内容，记录每个参与者（以日志文件的绝对路径区分）最近一次统计的磁盘占用
+type quotaState struct {
+	Members map[string]quotaMember `json:"members"`
+}
+
+type quotaMember struct {
+	Bytes   int64 `json:"bytes"`   // 当前日志文件和所有备份占用的磁盘空间
+	Updated int64 `json:"updated"` // 最近一次更新的 Unix 时间（秒）
+}
+
+// 按共享配额清理备份。在锁文件的保护下读取配额文件，计算所有参与者的总占用，超出 QuotaSize 时
+// 从旧到新删除自己的备份，直到总量回到配额以内或没有可删除的备份，然后记录自己的占用。
+// 每个进程只删除自己的备份，被 Pin 或匹配 KeepPatterns 的备份不删除。协议是建议性的，
+// 只约束同样使用该配额文件的进程
+func (l *MMapLogger) enforceQuota() error {
+	if l.QuotaFile == "" || l.QuotaSize <= 0 {
+		return nil
+	}
+	key, err := filepath.Abs(l.filename())
+	if err != nil {
+		return err
+	}
+	unlock, err := lockQuota(l.QuotaFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := readQuota(l.QuotaFile)
+	if err != nil {
+		return err
+	}
+	now := l.now()
+	var others int64
+	for name, m := range state.Members {
+		if name == key {
+			continue
+		}
+		if now.Sub(time.Unix(m.Updated, 0)) > quotaExpiry {
+			delete(state.Members, name)
+			continue
+		}
+		others += m.Bytes
+	}
+
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return err
+	}
+	var usage int64
+	if info, err := os_Stat(l.filename()); err == nil {
+		usage += diskUsage(info)
+	}
+	for _, f := range files {
+		usage += diskUsage(f.FileInfo)
+	}
+	files, _ = l.splitExempt(files)
+	limit := int64(l.QuotaSize) * int64(megabyte)
+	for i := len(files) - 1; i >= 0 && others+usage > limit; i-- { // 备份按从新到旧排列
+		if err := os.Remove(filepath.Join(l.dir(), files[i].Name())); err != nil {
+			l.reportError(fmt.Errorf("remove backup over quota: %v", err))
+			continue
+		}
+		usage -= diskUsage(files[i].FileInfo)
+		l.inventoryRemove(files[i].Name())
+	}
+	if others+usage > limit {
+		l.reportError(fmt.Errorf("shared quota %s exceeded: %d of %d bytes used, no backups left to remove", l.QuotaFile, others+usage, limit))
+	}
+
+	state.Members[key] = quotaMember{Bytes: usage, Updated: now.Unix()}
+	return writeQuota(l.QuotaFile, state)
+}
+
+// 创建锁文件获取配额锁，返回释放锁的函数。锁文件已存在时轮询等待，超过 quotaLockStale 未释放的锁被视为失效并删除
+func lockQuota(name string) (func(), error) {
+	lock := name + quotaLockSuffix
+	if err := os.MkdirAll(filepath.Dir(lock), 0755); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(quotaLockWait)
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			if errClose := f.Close(); err == nil {
+				err = errClose
+			}
+			if err != nil {
+				os.Remove(lock)
+				return nil, err
+			}
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > quotaLockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrQuotaLock, lock)
+		}
+		time.Sleep(quotaLockPoll)
+	}
+}
+
+// 读取配额文件，文件不存在时返回空的状态
+func readQuota(name string) (*quotaState, error) {
+	state := &quotaState{Members: make(map[string]quotaMember)}
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid quota file %s: %v", name, err)
+	}
+	if state.Members == nil {
+		state.Members = make(map[string]quotaMember)
+	}
+	return state, nil
+}
+
+// 写入临时文件后重命名，其他进程读取时不会看到写了一半的内容
+func writeQuota(name string, state *quotaState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
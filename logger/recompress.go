@@ -0,0 +1,191 @@
+package logger
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const manifestSuffix = ".manifest"
+
+// manifest 记录已经重新压缩过的备份，避免重复处理
+type manifest struct {
+	Recompressed []string `json:"recompressed"`
+}
+
+func (l *MMapLogger) manifestName() string {
+	return l.filename() + manifestSuffix
+}
+
+func (l *MMapLogger) readManifest() (*manifest, error) {
+	m := &manifest{}
+	data, err := os.ReadFile(l.manifestName())
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", l.manifestName(), err)
+	}
+	return m, nil
+}
+
+func (l *MMapLogger) writeManifest(m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmp := l.manifestName() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.manifestName())
+}
+
+// 检查重新压缩的格式，目前只能输出 gzip
+func checkRecompressFormat(format string) error {
+	switch format {
+	case "", RecompressGzip:
+		return nil
+	case RecompressZstd:
+		return errors.New("RecompressFormat zstd is not supported, backups can only be recompressed as gzip")
+	default:
+		return fmt.Errorf("invalid RecompressFormat %q", format)
+	}
+}
+
+// 对超过 RecompressAfter 天的压缩备份以 RecompressLevel 重新压缩，已处理的记录在 manifest 中。
+// 直接构造结构体而没有调用 Validate 时，不支持的 RecompressFormat 在有备份到期时报告，备份保持不变
+func (l *MMapLogger) recompressOld(ctx context.Context, files []logInfo) error {
+	m, err := l.readManifest()
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(files))
+	for _, f := range files {
+		existing[f.Name()] = true
+	}
+	done := make(map[string]bool, len(m.Recompressed))
+	var kept []string
+	for _, name := range m.Recompressed {
+		if existing[name] { // 丢弃已被清理的备份
+			done[name] = true
+			kept = append(kept, name)
+		}
+	}
+	changed := len(kept) != len(m.Recompressed)
+	m.Recompressed = kept
+
+	level := l.RecompressLevel
+	if level == 0 {
+		level = gzip.BestCompression
+	}
+	due := l.recompressDue(files, done)
+	if len(due) > 0 {
+		if errFormat := checkRecompressFormat(l.RecompressFormat); errFormat != nil {
+			return errFormat
+		}
+	}
+	for _, f := range due {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+		name := f.Name()
+		if errRecompress := recompressLogFile(ctx, filepath.Join(l.dir(), name), level, l.CompressRateLimit); errRecompress != nil {
+			l.counters.recordCompressFailure(ctx)
+			if err == nil {
+				err = errRecompress
+			}
+			continue
+		}
+		m.Recompressed = append(m.Recompressed, name)
+		changed = true
+	}
+	if changed {
+		if errWrite := l.writeManifest(m); err == nil {
+			err = errWrite
+		}
+	}
+	return err
+}
+
+// 返回 files 中超过 RecompressAfter 天且尚未重新压缩过的压缩备份
+func (l *MMapLogger) recompressDue(files []logInfo, done map[string]bool) []logInfo {
+	var due []logInfo
+	cutoff := l.now().Add(-time.Duration(l.RecompressAfter) * 24 * time.Hour)
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, compressSuffix) && !done[name] && f.timestamp.Before(cutoff) {
+			due = append(due, f)
+		}
+	}
+	return due
+}
+
+// 以指定级别重新压缩 gzip 文件，保留原文件的属主和修改时间
+func recompressLogFile(ctx context.Context, name string, level, rate int) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open compressed log file: %v", err)
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat compressed log file: %v", err)
+	}
+	gr, err := gzip.NewReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to read compressed log file: %v", err)
+	}
+
+	tmp := name + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fi.Mode())
+	if err != nil {
+		return fmt.Errorf("failed to open recompressed log file: %v", err)
+	}
+	defer func() {
+		dst.Close()
+		if err != nil {
+			os.Remove(tmp)
+			err = fmt.Errorf("failed to recompress log file: %v", err)
+		}
+	}()
+	gw, err := gzip.NewWriterLevel(dst, level)
+	if err != nil {
+		return err
+	}
+	gw.Header = gr.Header // 保留原文件名和 CompressedFileID 记录的原文件
+	sum := newChecksum()
+	if _, err := copyThrottled(ctx, gw, io.TeeReader(gr, sum), rate); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := sum.verifyGzip(tmp); err != nil { // 替换原文件前校验
+		return err
+	}
+	if err := chown(tmp, fi); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp, fi.ModTime(), fi.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	pinSuffix     = ".pin"
+	regexpPattern = "regexp:"
+)
+
+// Pin 保留指定的备份文件，使其不会被 MaxAge/MaxBackups 清理。
+// 通过在备份旁边创建 <备份名>.pin 标记文件实现，因此进程重启后依然有效，压缩后的备份同样受保护
+func (l *MMapLogger) Pin(path string) error {
+	name := strings.TrimSuffix(path, compressSuffix)
+	if _, err := os_Stat(path); err != nil {
+		return fmt.Errorf("can't pin log file: %s", err)
+	}
+	f, err := os.OpenFile(name+pinSuffix, os.O_CREATE|os.O_WRONLY, 0664)
+	if err != nil {
+		return fmt.Errorf("can't pin log file: %s", err)
+	}
+	return f.Close()
+}
+
+// Unpin 取消 Pin 对备份文件的保留
+func (l *MMapLogger) Unpin(path string) error {
+	name := strings.TrimSuffix(path, compressSuffix)
+	if err := os.Remove(name + pinSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("can't unpin log file: %s", err)
+	}
+	return nil
+}
+
+// 将备份文件分为参与清理的和被保留的两部分，KeepPatterns 在每次调用时只编译一次
+func (l *MMapLogger) splitExempt(files []logInfo) (remaining, kept []logInfo) {
+	patterns := l.compileKeepPatterns()
+	for _, f := range files {
+		if l.isExempt(f.Name(), patterns) {
+			kept = append(kept, f)
+		} else {
+			remaining = append(remaining, f)
+		}
+	}
+	return remaining, kept
+}
+
+// 编译后的 KeepPatterns
+type keepPatterns struct {
+	globs   []string
+	regexps []*regexp.Regexp
+}
+
+// 编译 KeepPatterns 中的正则，无效的正则报告后忽略
+func (l *MMapLogger) compileKeepPatterns() keepPatterns {
+	var p keepPatterns
+	for _, pattern := range l.KeepPatterns {
+		if !strings.HasPrefix(pattern, regexpPattern) {
+			p.globs = append(p.globs, pattern)
+			continue
+		}
+		re, err := regexp.Compile(pattern[len(regexpPattern):])
+		if err != nil {
+			l.reportError(fmt.Errorf("invalid keep pattern %q: %v", pattern, err))
+			continue
+		}
+		p.regexps = append(p.regexps, re)
+	}
+	return p
+}
+
+// 判断备份文件是否被 Pin 或匹配 KeepPatterns
+func (l *MMapLogger) isExempt(name string, patterns keepPatterns) bool {
+	base := strings.TrimSuffix(name, compressSuffix)
+	if _, err := os_Stat(filepath.Join(l.dir(), base+pinSuffix)); err == nil {
+		return true
+	}
+	for _, re := range patterns.regexps {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	for _, pattern := range patterns.globs {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RetentionPlan 描述一次清理会执行的操作，文件名均为日志目录下的文件名
+type RetentionPlan struct {
+	Remove     []string `json:"remove"`     // 将被删除的备份
+	Compress   []string `json:"compress"`   // 将被压缩的备份
+	Recompress []string `json:"recompress"` // 将以 RecompressLevel 重新压缩的压缩备份
+	Keep       []string `json:"keep"`       // 被 Pin 或 KeepPatterns 保留的备份
+}
+
+// RetentionPlan 返回按当前的 MaxAge、MaxBackups、Compress 等设置执行一次清理时会做的操作，但不修改任何文件，
+// 用于在修改清理设置前确认其效果。设置了 CompressSchedule 时同样按立即压缩计算
+func (l *MMapLogger) RetentionPlan() (*RetentionPlan, error) {
+	plan := &RetentionPlan{}
+	if l.MaxBackups == 0 && l.MaxAge == 0 && !l.Compress {
+		return plan, nil
+	}
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return nil, err
+	}
+	remove, compress, files, kept := l.planRetention(files, true)
+	for _, f := range remove {
+		plan.Remove = append(plan.Remove, f.Name())
+	}
+	for _, f := range compress {
+		plan.Compress = append(plan.Compress, f.Name())
+	}
+	for _, f := range kept {
+		plan.Keep = append(plan.Keep, f.Name())
+	}
+	if l.Compress && l.RecompressAfter > 0 {
+		m, err := l.readManifest()
+		if err != nil {
+			return nil, err
+		}
+		done := make(map[string]bool, len(m.Recompressed))
+		for _, name := range m.Recompressed {
+			done[name] = true
+		}
+		for _, f := range l.recompressDue(append(files, kept...), done) {
+			plan.Recompress = append(plan.Recompress, f.Name())
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,27 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrMappingFault 表示访问映射空间时发生了 SIGBUS/SIGSEGV，通常是文件被外部进程截断
+var ErrMappingFault = errors.New("mmap logger: fault accessing mapped file")
+
+// safeCopy 将 src 复制到映射空间 dst。访问已失效的映射会触发 SIGBUS，
+// 这里借助 debug.SetPanicOnFault 把故障转换为可恢复的 panic 并返回错误，避免进程直接退出。
+func safeCopy(dst, src []byte) (n int, err error) {
+	old := debug.SetPanicOnFault(true)
+	defer func() {
+		debug.SetPanicOnFault(old)
+		if r := recover(); r != nil {
+			if addr, ok := r.(interface{ Addr() uintptr }); ok {
+				err = fmt.Errorf("%w at address %#x", ErrMappingFault, addr.Addr())
+				return
+			}
+			panic(r)
+		}
+	}()
+	return copy(dst, src), nil
+}
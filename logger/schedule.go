@@ -0,0 +1,200 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 注入的 Clock 没有实现 tickerClock 时，定时任务每隔 clockPoll 检查一次 Clock 的时间
+const clockPoll = 50 * time.Millisecond
+
+// 定时任务等待使用的计时器来源。Clock 同时实现了 NewTicker（如 zapcore.Clock 或测试中的模拟时钟）时由它驱动定时任务
+type tickerClock interface {
+	NewTicker(d time.Duration) *time.Ticker
+}
+
+// 按 RotateSchedule、RotationInterval、CompressSchedule 和 FlushInterval 启动定时任务协程，调用方需持有锁
+func (l *MMapLogger) startScheduler() {
+	if l.stopSched != nil || (l.RotateSchedule == "" && l.RotationInterval <= 0 && l.CompressSchedule == "" && l.FlushInterval <= 0) {
+		return
+	}
+	var rotateAt, compressAt *Schedule
+	var err error
+	if l.RotateSchedule != "" {
+		if rotateAt, err = ParseSchedule(l.RotateSchedule); err != nil {
+			l.reportError(err)
+		}
+	}
+	if l.CompressSchedule != "" {
+		if compressAt, err = ParseSchedule(l.CompressSchedule); err != nil {
+			l.reportError(err)
+		}
+	}
+	if rotateAt == nil && l.RotationInterval <= 0 && compressAt == nil && l.FlushInterval <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	l.stopSched, l.schedWG = stop, wg
+	run := func(task func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task()
+		}()
+	}
+	if rotateAt != nil {
+		run(func() {
+			l.runSchedule(rotateAt, stop, func() {
+				if err := l.Rotate(); err != nil {
+					l.reportError(err)
+				}
+			})
+		})
+	}
+	if l.RotationInterval > 0 {
+		next := l.periodStart(l.now()).Add(l.RotationInterval) // 在这里计算，不受协程启动时间影响
+		run(func() { l.runRotation(l.RotationInterval, next, stop) })
+	}
+	if compressAt != nil {
+		run(func() {
+			l.runSchedule(compressAt, stop, func() {
+				err := l.millRunOnce(l.maint.context(), true)
+				l.counters.recordMill(err)
+				if err != nil {
+					l.reportError(err)
+				}
+			})
+		})
+	}
+	if l.FlushInterval > 0 {
+		run(func() { l.runFlush(l.FlushInterval, stop) })
+	}
+}
+
+// 等待 Clock 的时间到达 t，stop 被关闭时返回 false。
+// 注入的 Clock 可能与系统时间不同步（如测试中手动推进的时钟），不能按系统时间一次算出等待时长
+func (l *MMapLogger) waitUntil(t time.Time, stop <-chan struct{}) bool {
+	for {
+		d := t.Sub(l.now())
+		if d <= 0 {
+			return true
+		}
+		var tick <-chan time.Time
+		var release func()
+		if clock, ok := l.Clock.(tickerClock); ok {
+			ticker := clock.NewTicker(d)
+			tick, release = ticker.C, ticker.Stop
+		} else {
+			if l.Clock != nil && d > clockPoll {
+				d = clockPoll
+			}
+			timer := time.NewTimer(d)
+			tick, release = timer.C, func() { timer.Stop() }
+		}
+		select {
+		case <-stop:
+			release()
+			return false
+		case <-tick:
+			release()
+		}
+	}
+}
+
+// 每隔 interval 将映射空间写回文件，直到 stop 被关闭
+func (l *MMapLogger) runFlush(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := l.Sync(); err != nil {
+				l.reportError(fmt.Errorf("periodic flush: %w", err))
+			}
+		}
+	}
+}
+
+// 从 next 开始在 interval 的每个整数倍时间点轮换，直到 stop 被关闭
+func (l *MMapLogger) runRotation(interval time.Duration, next time.Time, stop <-chan struct{}) {
+	for l.waitUntil(next, stop) {
+		if err := l.rotatePeriod(next.Add(-interval)); err != nil {
+			l.reportError(err)
+		}
+		next = l.periodStart(l.now()).Add(interval)
+	}
+}
+
+// 轮换文件，备份文件名使用刚结束的周期的开始时间 start。文件未打开或周期内没有写入记录时不轮换，避免产生空的备份
+func (l *MMapLogger) rotatePeriod(start time.Time) error {
+	l.flushAsync()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil || l.writeAt <= int64(len(l.Header)) {
+		return nil
+	}
+	l.period = start
+	err := l.rotate()
+	l.period = time.Time{}
+	if err != nil {
+		return err
+	}
+	l.flushLifecycle()
+	return nil
+}
+
+// 返回 t 所在的 RotationInterval 周期的开始时间，按 LocalTime 对应的时区对齐
+func (l *MMapLogger) periodStart(t time.Time) time.Time {
+	if !l.LocalTime {
+		t = t.UTC()
+	}
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(l.RotationInterval).Add(-shift)
+}
+
+// 返回备份文件名中的时间。设置 RotationInterval 时使用文件所属周期的开始时间，
+// 同一周期内按大小轮换产生的多个备份由 nextBackupName 依次顺延
+func (l *MMapLogger) backupTime() time.Time {
+	if !l.period.IsZero() {
+		return l.period
+	}
+	if l.RotationInterval > 0 {
+		return l.periodStart(l.now())
+	}
+	return l.now()
+}
+
+// 通知定时任务协程退出，调用方需持有锁
+func (l *MMapLogger) stopScheduler() {
+	if l.stopSched != nil {
+		close(l.stopSched)
+		l.stopSched, l.schedWG = nil, nil
+	}
+}
+
+// 停止定时任务协程并等待它们退出。正在执行的任务（如轮换）需要获取锁，因此调用方不能持有锁
+func (l *MMapLogger) haltScheduler() {
+	l.mu.Lock()
+	wg := l.schedWG
+	l.stopScheduler()
+	l.mu.Unlock()
+	if wg != nil {
+		wg.Wait()
+	}
+}
+
+// 在每个调度时间点执行 job，直到 stop 被关闭
+func (l *MMapLogger) runSchedule(s *Schedule, stop <-chan struct{}, job func()) {
+	for {
+		next := s.Next(l.now())
+		if next.IsZero() || !l.waitUntil(next, stop) {
+			return
+		}
+		job()
+	}
+}
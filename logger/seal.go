@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Seal 关闭日志文件，将其重命名为最后一个备份并返回备份的路径，文件中没有记录时返回空字符串。
+// Compress 为 true 时立即压缩，不受 CompressSchedule 和 CompressRateLimit 限制，返回压缩后的路径。
+// 用于容器退出前让最后一段日志与轮换产生的备份一样被采集或上传，之后的写入会重新打开日志文件
+func (l *MMapLogger) Seal(ctx context.Context) (string, error) {
+	l.haltScheduler()
+	l.haltMill()
+	l.stopAsync()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopScheduler()
+	l.maint.stop()
+	if l.file != nil {
+		l.queueLifecycle(LifecycleEvent{Event: LifecycleClose})
+		l.flushLifecycle()
+	}
+	if err := l.close(); err != nil {
+		return "", err
+	}
+	if err := l.removeCrashMarker(); err != nil {
+		return "", err
+	}
+
+	name := l.filename()
+	info, err := os_Stat(name)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Size() <= int64(len(l.Header)) {
+		return "", nil
+	}
+	backup := l.nextBackupName(name)
+	if err := os.Rename(name, backup); err != nil {
+		return "", err
+	}
+	l.inventoryAdd(filepath.Base(backup))
+	if !l.Compress {
+		return backup, nil
+	}
+	if err := compressLogFile(ctx, backup, backup+compressSuffix, 0); err != nil {
+		return backup, err
+	}
+	l.stats.recordCompress(info.Size(), backup+compressSuffix)
+	l.inventoryRemove(filepath.Base(backup))
+	l.inventoryAdd(filepath.Base(backup) + compressSuffix)
+	return backup + compressSuffix, nil
+}
@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var soak = flag.Duration("soak", 0, "run TestSoak for this long, e.g. -soak=10m")
+
+// 长时间写入的同时随机轮换、重新打开（Close 后新建 MMapLogger）和 Sync。
+// 每次 Sync 后检查 writeAt 与文件实际内容的末尾是否一致，结束时按顺序读取所有文件，
+// 要求每条记录恰好出现一次、内容逐字节一致且顺序不变。默认跳过，通过 -soak=10m 开启
+func TestSoak(t *testing.T) {
+	if *soak <= 0 {
+		t.Skip("soak test disabled, run with -soak=<duration>")
+	}
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	filename := filepath.Join(t.TempDir(), "soak.log")
+	open := func() *MMapLogger {
+		return &MMapLogger{Filename: filename, MaxSize: 1, FlushInterval: 20 * time.Millisecond}
+	}
+	var mu sync.RWMutex // 写入持读锁，重新打开和检查偏移时持写锁暂停写入
+	l := open()
+
+	const writers = 4
+	written := make([]int, writers)
+	deadline := time.Now().Add(*soak)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; time.Now().Before(deadline); i++ {
+				line := soakRecord(w, i)
+				mu.RLock()
+				var err error
+				switch i % 3 {
+				case 0:
+					_, err = l.Write([]byte(line))
+				case 1:
+					_, err = l.WriteBatch([][]byte{[]byte(line)})
+				default:
+					var buf []byte
+					var commit func(int)
+					if buf, commit, err = l.Reserve(len(line)); err == nil {
+						commit(copy(buf, line))
+					}
+				}
+				mu.RUnlock()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				written[w] = i + 1
+			}
+		}(w)
+	}
+
+	var rotates, reloads, checks int
+	for time.Now().Before(deadline) && !t.Failed() {
+		time.Sleep(time.Duration(rng.Intn(5000)) * time.Microsecond)
+		switch n := rng.Intn(10); {
+		case n < 3:
+			rotates++
+			if err := l.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+		case n < 4:
+			reloads++
+			mu.Lock()
+			if err := l.Close(); err != nil {
+				mu.Unlock()
+				t.Fatal(err)
+			}
+			l = open()
+			mu.Unlock()
+		default:
+			checks++
+			mu.Lock()
+			err := checkDrift(l)
+			mu.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	wg.Wait()
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := l.oldLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{filename}
+	for _, f := range files {
+		names = append(names, filepath.Join(filepath.Dir(filename), f.Name()))
+	}
+	next := make([]int, writers)
+	for k := len(names) - 1; k >= 0; k-- { // 从最旧的备份到当前文件
+		data, err := os.ReadFile(names[k])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			t.Fatalf("%s: NUL byte at offset %d of %d", filepath.Base(names[k]), i, len(data))
+		}
+		for _, line := range strings.SplitAfter(string(data), "\n") {
+			if line == "" {
+				continue
+			}
+			var w, i int
+			if _, err := fmt.Sscanf(line, "%d-%d ", &w, &i); err != nil || w < 0 || w >= writers || line != soakRecord(w, i) {
+				t.Fatalf("%s: corrupt record %q", filepath.Base(names[k]), line)
+			}
+			if i != next[w] {
+				t.Fatalf("%s: writer %d record %d follows %d", filepath.Base(names[k]), w, i, next[w]-1)
+			}
+			next[w]++
+		}
+	}
+	total := 0
+	for w := range next {
+		if next[w] != written[w] {
+			t.Fatalf("writer %d: found %d records, wrote %d", w, next[w], written[w])
+		}
+		total += next[w]
+	}
+	t.Logf("%d records in %d files, %d rotations, %d reloads, %d offset checks", total, len(names), rotates, reloads, checks)
+}
+
+// 第 w 个写入协程的第 i 条记录，长度随 i 变化
+func soakRecord(w, i int) string {
+	return fmt.Sprintf("%d-%d %s\n", w, i, strings.Repeat(string(rune('a'+w)), (i*7919+w*31)%700))
+}
+
+// Sync 后比较 writeAt 与文件内容：writeAt 之前应当以完整记录结束，之后只能是映射填充
+func checkDrift(l *MMapLogger) error {
+	if err := l.Sync(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	data, err := os.ReadFile(l.file.Name())
+	if err != nil {
+		return err
+	}
+	end := int64(len(bytes.TrimRight(data, "\x00")))
+	if end != l.writeAt {
+		return fmt.Errorf("writeAt %d drifted from the end of data %d (file size %d)", l.writeAt, end, len(data))
+	}
+	if end > 0 && data[end-1] != '\n' {
+		return fmt.Errorf("data ends with a partial record %q", data[max(0, end-40):end])
+	}
+	return nil
+}
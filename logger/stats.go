@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// Stats 是运行时统计的快照，计数均为自创建以来的累计值
+type Stats struct {
+	BytesWritten     int64  // 写入的记录字节数
+	FileSize         int64  // 当前文件中已写入的字节数，不含映射填充，文件未打开时为 0
+	Rotations        uint64 // 轮换次数
+	Remaps           int64  // 重新映射的次数
+	Fallbacks        int64  // 因映射预算不足改为缓冲写的次数
+	CompressFailures uint64 // 压缩或重新压缩备份失败的次数，不含关闭时取消的压缩
+	MillRuns         uint64 // 清理任务执行的次数
+	MillErrors       uint64 // 清理任务返回错误的次数
+	Errors           uint64 // 报告给 OnError（或打印到标准输出）的异常数
+	DroppedRecords   uint64 // 被主动丢弃的记录数，同 DroppedCount
+	DroppedBytes     uint64 // 异步缓冲区满时丢弃的字节数，同 DroppedBytes
+	FailedWrites     uint64 // 写入失败的次数，同 FailedWrites
+}
+
+type runStats struct {
+	rotations, compressFailures atomic.Uint64
+	millRuns, millErrors        atomic.Uint64
+	errors                      atomic.Uint64
+}
+
+// 记录一次清理任务的结果，关闭时取消的清理不计为错误
+func (s *runStats) recordMill(err error) {
+	s.millRuns.Add(1)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		s.millErrors.Add(1)
+	}
+}
+
+// 记录一次压缩失败，ctx 已取消时是关闭导致的放弃，不计入
+func (s *runStats) recordCompressFailure(ctx context.Context) {
+	if ctx.Err() == nil {
+		s.compressFailures.Add(1)
+	}
+}
+
+// Stats 返回运行时统计的快照，可以在写入的同时调用
+func (l *MMapLogger) Stats() Stats {
+	l.mu.Lock()
+	var size int64
+	if l.file != nil {
+		size = l.writeAt
+	}
+	l.mu.Unlock()
+	return Stats{
+		BytesWritten:     l.stats.logged.Load(),
+		FileSize:         size,
+		Rotations:        l.counters.rotations.Load(),
+		Remaps:           l.stats.remaps.Load(),
+		Fallbacks:        l.stats.fallbacks.Load(),
+		CompressFailures: l.counters.compressFailures.Load(),
+		MillRuns:         l.counters.millRuns.Load(),
+		MillErrors:       l.counters.millErrors.Load(),
+		Errors:           l.counters.errors.Load(),
+		DroppedRecords:   l.dropped.Load(),
+		DroppedBytes:     l.droppedBytes.Load(),
+		FailedWrites:     l.failed.Load(),
+	}
+}
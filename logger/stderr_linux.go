@@ -0,0 +1,34 @@
+//go:build linux && !nosyscall
+
+package logger
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// RedirectStderr 通过 dup3 让进程的标准错误（fd 2）指向文件 f，runtime 的 panic 和第三方 C 库直接写 fd 2 的输出
+// 由内核写入 f，不经过任何协程，进程崩溃时也不会丢失。f 应以 O_APPEND 打开，且不能是映射写入或由其他 fd
+// 按自己的偏移写入的文件，否则双方会覆盖对方的内容。调用后可以关闭 f；f 轮换后用 PointStderr 指向新文件。
+// 返回的 restore 恢复调用前的标准错误
+func RedirectStderr(f *os.File) (restore func() error, err error) {
+	saved, err := unix.Dup(unix.Stderr)
+	if err != nil {
+		return nil, os.NewSyscallError("dup", err)
+	}
+	if err := PointStderr(f); err != nil {
+		unix.Close(saved)
+		return nil, err
+	}
+	return func() error {
+		err := unix.Dup3(saved, unix.Stderr, 0)
+		unix.Close(saved)
+		return os.NewSyscallError("dup3", err)
+	}, nil
+}
+
+// PointStderr 通过 dup3 让标准错误（fd 2）改为指向文件 f，不保存原来的标准错误，用于 RedirectStderr 的文件轮换后重新指向新文件
+func PointStderr(f *os.File) error {
+	return os.NewSyscallError("dup3", unix.Dup3(int(f.Fd()), unix.Stderr, 0))
+}
@@ -0,0 +1,18 @@
+//go:build !linux || nosyscall
+
+package logger
+
+import (
+	"errors"
+	"os"
+)
+
+// RedirectStderr 仅在 Linux 上且未使用 nosyscall 构建标签时支持。
+func RedirectStderr(f *os.File) (restore func() error, err error) {
+	return nil, errors.New("redirect stderr is not supported on this platform")
+}
+
+// PointStderr 仅在 Linux 上且未使用 nosyscall 构建标签时支持。
+func PointStderr(f *os.File) error {
+	return errors.New("redirect stderr is not supported on this platform")
+}
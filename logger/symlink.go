@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrSymlink 表示设置了 RefuseSymlink 时日志路径是一个符号链接
+var ErrSymlink = errors.New("mmap logger: log file is a symlink")
+
+// 解析日志路径中的符号链接，之后的打开、轮换和清理都作用于链接指向的文件，
+// 避免轮换时重命名的是链接本身。设置了 RefuseSymlink 时拒绝符号链接。只在第一次打开时解析，调用方需持有锁
+func (l *MMapLogger) resolveFilename() error {
+	if l.resolved != "" {
+		return nil
+	}
+	name := l.filename()
+	info, err := os.Lstat(name)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		l.resolved = name
+		return nil
+	}
+	if l.RefuseSymlink {
+		return fmt.Errorf("%w: %s", ErrSymlink, name)
+	}
+	target, err := filepath.EvalSymlinks(name)
+	if err != nil { // 链接指向的文件还不存在
+		if target, err = os.Readlink(name); err != nil {
+			return fmt.Errorf("can't resolve log file symlink: %s", err)
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+	}
+	l.resolved = target
+	return nil
+}
+
+// 打开日志文件使用的标志，设置了 RefuseSymlink 时不跟随符号链接，防止检查后被替换成链接
+func (l *MMapLogger) openFlags() int {
+	flags := os.O_RDWR | os.O_CREATE
+	if l.RefuseSymlink {
+		flags |= oNoFollow
+	}
+	return flags
+}
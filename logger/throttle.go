@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// 限速拷贝时每次读取的块大小
+const throttleChunk = 256 * 1024
+
+// 以不超过 rate MB/s 的速度从 src 拷贝到 dst，rate 为 0 时不限速。
+// 每拷贝一块后检查 ctx 是否已取消，并睡眠到按速率应当完成的时间点，避免压缩大文件时长时间占满磁盘带宽
+func copyThrottled(ctx context.Context, dst io.Writer, src io.Reader, rate int) (int64, error) {
+	bytesPerSecond := float64(rate * megabyte)
+	start := time.Now()
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, err := io.CopyN(dst, src, throttleChunk)
+		written += n
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+		if rate <= 0 {
+			continue
+		}
+		due := time.Duration(float64(written) / bytesPerSecond * float64(time.Second))
+		if wait := due - time.Since(start); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return written, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// maintenance 管理清理和压缩任务的 context，Close 时取消正在执行的任务
+type maintenance struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// 返回当前维护任务使用的 context，需要时新建
+func (m *maintenance) context() context.Context {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx == nil {
+		m.ctx, m.cancel = context.WithCancel(context.Background())
+	}
+	return m.ctx
+}
+
+// 取消正在执行的维护任务，之后的任务使用新的 context
+func (m *maintenance) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+		m.ctx, m.cancel = nil, nil
+	}
+}
+
+// 执行压缩任务。设置了 CompressNice 时在一个新的系统线程上以最低的 CPU 和 IO 优先级执行，
+// 协程结束时不解除线程绑定，使 runtime 直接销毁这个被降级的线程而不是复用它
+func (l *MMapLogger) runCompress(fn func() error) error {
+	if !l.CompressNice {
+		return fn()
+	}
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		lowerThreadPriority()
+		done <- fn()
+	}()
+	return <-done
+}
@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// ErrChecksumMismatch 表示写出的副本与源数据不一致，此时不会删除或替换源文件
+var ErrChecksumMismatch = errors.New("mmap logger: copy checksum mismatch")
+
+// checksum 在数据流过时计算 crc32 和长度，用于在删除或替换源文件之前校验副本
+type checksum struct {
+	hash hash.Hash32
+	n    int64
+}
+
+func newChecksum() *checksum {
+	return &checksum{hash: crc32.NewIEEE()}
+}
+
+func (c *checksum) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return c.hash.Write(p)
+}
+
+// 重新读取并解压 name，校验解压后的数据与 c 记录的一致
+func (c *checksum) verifyGzip(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrChecksumMismatch, err)
+	}
+	got := newChecksum()
+	if _, err := io.Copy(got, gr); err != nil {
+		return fmt.Errorf("%w: %v", ErrChecksumMismatch, err)
+	}
+	if got.n != c.n || got.hash.Sum32() != c.hash.Sum32() {
+		return fmt.Errorf("%w: %s holds %d bytes (crc32 %08x), want %d bytes (crc32 %08x)",
+			ErrChecksumMismatch, name, got.n, got.hash.Sum32(), c.n, c.hash.Sum32())
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package log
+
+import "go.uber.org/zap/zapcore"
+
+// MessageTransformer rewrites a record's message before it is encoded, e.g.
+// to map message IDs to localized text or to normalize messages for
+// downstream deduplication.
+type MessageTransformer func(lvl Level, msg string) string
+
+// messageCore applies a MessageTransformer to every record before handing
+// it to the wrapped core, so all sinks see the same message.
+type messageCore struct {
+	zapcore.Core
+	transform MessageTransformer
+}
+
+func (c *messageCore) With(fields []zapcore.Field) zapcore.Core {
+	return &messageCore{Core: c.Core.With(fields), transform: c.transform}
+}
+
+func (c *messageCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *messageCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.transform(fromZapLevel(ent.Level), ent.Message)
+	return c.Core.Write(ent, fields)
+}
+
+// fromZapLevel is the inverse of Level.ZapLevel.
+func fromZapLevel(lvl zapcore.Level) Level {
+	switch lvl {
+	case zapcore.DebugLevel:
+		return LevelDebug
+	case zapcore.InfoLevel:
+		return LevelInfo
+	case zapcore.WarnLevel:
+		return LevelWarn
+	case zapcore.ErrorLevel:
+		return LevelError
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		return LevelPanic
+	case zapcore.FatalLevel:
+		return LevelFatal
+	default:
+		return LevelInfo
+	}
+}
@@ -0,0 +1,70 @@
+package log
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureStdout redirects os.Stdout while fn runs and returns what was
+// written to it.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	return capture(t, &os.Stdout, fn)
+}
+
+// captureStderr returns what fn writes to os.Stderr.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	return capture(t, &os.Stderr, fn)
+}
+
+func capture(t *testing.T, file **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := *file
+	*file = w
+	defer func() { *file = orig }()
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestMessageTransform(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	catalog := map[string]string{"E1001": "disk full"}
+	transform := func(lvl Level, msg string) string {
+		if text, ok := catalog[msg]; ok {
+			return lvl.String() + ": " + text
+		}
+		return msg
+	}
+	level := LevelInfo
+	out := captureStdout(t, func() {
+		l := New(&Config{Output: OutputMmap, Filename: filename, StdoutLevel: &level, MessageTransform: transform})
+		l.Error("E1001", "disk", "/var")
+		l.Info("untouched")
+		l.Close()
+	})
+
+	records := decodeRecords(t, filename)
+	if len(records) != 2 || records[0]["msg"] != "error: disk full" || records[1]["msg"] != "untouched" {
+		t.Fatalf("file records %v, want the transformed message", records)
+	}
+	if records[0]["disk"] != "/var" {
+		t.Errorf("fields lost by the transform: %v", records[0])
+	}
+	if !strings.Contains(out, `"msg":"error: disk full"`) || strings.Contains(out, "E1001") {
+		t.Fatalf("stdout copy %q, want the transformed message as in the file", out)
+	}
+}
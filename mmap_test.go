@@ -1,26 +1,36 @@
 package log
 
 import (
+	"path/filepath"
 	"testing"
+
+	"github.com/Reb1113/mmap_write_syncer/testutil"
 )
 
+const benchMsg = "testsdafougdsaljgdaljgdladgjlsadgjlagdladgljkadgljagdljkladjgadljksgljkasgdjlgjlkagldjljgkd"
+
 // 原来日志打印方式
 func Benchmark_NomalLog(b *testing.B) {
+	filename := filepath.Join(b.TempDir(), "normal.log")
+	log := New(&Config{Output: OutputFile, Filename: filename, MaxBackups: 1 << 20})
 	b.ResetTimer()
-	log := New(&Config{Output: OutputFile, Filename: "./log/normal.log"})
 	for i := 0; i < b.N; i++ {
-		log.Infof("testsdafougdsaljgdaljgdladgjlsadgjlagdladgljkadgljagdljkladjgadljksgljkasgdjlgjlkagldjljgkd")
+		log.Infof(benchMsg)
 	}
 	b.StopTimer()
+	log.Close()
+	testutil.CheckRecords(b, filename, b.N)
 }
 
 // mmap日志打印方式
 func Benchmark_MmapLog(b *testing.B) {
+	filename := filepath.Join(b.TempDir(), "mmap.log")
+	log := New(&Config{Output: OutputMmap, Filename: filename, MaxBackups: 1 << 20})
 	b.ResetTimer()
-	log := New(&Config{Output: OutputMmap, Filename: "./log/mmap.log"})
 	for i := 0; i < b.N; i++ {
-		log.Infof("testsdafougdsaljgdaljgdladgjlsadgjlagdladgljkadgljagdljkladjgadljksgljkasgdjlgjlkagldjljgkd")
+		log.Infof(benchMsg)
 	}
 	b.StopTimer()
-	mmapLogger.StopMmapLogger()
+	log.Close()
+	testutil.CheckRecords(b, filename, b.N)
 }
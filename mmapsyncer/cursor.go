@@ -0,0 +1,134 @@
+package mmapsyncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+)
+
+// ErrCursorLost is returned by Cursor.Resolve when the file the cursor
+// refers to no longer exists, e.g. it was pruned.
+var ErrCursorLost = errors.New("mmapsyncer: cursor file not found")
+
+// Cursor is a consumer's committed position in a file. The file is
+// identified by device and inode as well as by path, so a cursor still
+// finds its file after rotation renamed it. A backup compressed by the
+// logger keeps the identity of the file it was compressed from, see
+// logger.CompressedFileID, and Offset counts its uncompressed bytes.
+type Cursor struct {
+	File   string `json:"file"`   // File is the path of the file when the cursor was taken.
+	Dev    uint64 `json:"dev"`    // Dev is the device of the file.
+	Ino    uint64 `json:"ino"`    // Ino is the inode of the file.
+	Offset int64  `json:"offset"` // Offset is the position up to which the consumer has processed the file.
+}
+
+// CursorAt returns a cursor at offset in the file name.
+func CursorAt(name string, offset int64) (Cursor, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return Cursor{}, err
+	}
+	return NewCursor(name, info, offset), nil
+}
+
+// NewCursor returns a cursor at offset in the file name described by info.
+func NewCursor(name string, info os.FileInfo, offset int64) Cursor {
+	dev, ino := identify(name, info)
+	return Cursor{File: name, Dev: dev, Ino: ino, Offset: offset}
+}
+
+// Same reports whether info describes the file the cursor refers to.
+func (c Cursor) Same(info os.FileInfo) bool {
+	dev, ino := fileID(info)
+	return dev == c.Dev && ino == c.Ino
+}
+
+// Matches reports whether the file name described by info is the file the
+// cursor refers to, also when name is that file compressed.
+func (c Cursor) Matches(name string, info os.FileInfo) bool {
+	dev, ino := identify(name, info)
+	return dev == c.Dev && ino == c.Ino
+}
+
+// identify returns the device and inode of the file name described by info,
+// or those of the file it was compressed from.
+func identify(name string, info os.FileInfo) (dev, ino uint64) {
+	if strings.HasSuffix(name, ".gz") {
+		if dev, ino, ok := logger.CompressedFileID(name); ok {
+			return dev, ino
+		}
+	}
+	return fileID(info)
+}
+
+// Resolve returns the current path of the cursor's file: File itself if it
+// is still the same file, otherwise the file in the same directory it was
+// renamed or compressed to.
+func (c Cursor) Resolve() (string, error) {
+	if info, err := os.Stat(c.File); err == nil && c.Matches(c.File, info) {
+		return c.File, nil
+	}
+	dir := filepath.Dir(c.File)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if name := filepath.Join(dir, e.Name()); c.Matches(name, info) {
+			return name, nil
+		}
+	}
+	return "", ErrCursorLost
+}
+
+// LoadCursor reads the cursor committed to path. It returns the zero Cursor
+// if nothing was committed yet.
+func LoadCursor(path string) (Cursor, error) {
+	var c Cursor
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid cursor %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Commit durably writes the cursor to path, replacing the previous commit
+// atomically so a crash leaves either the old or the new cursor.
+func (c Cursor) Commit(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,16 @@
+//go:build unix && !nosyscall
+
+package mmapsyncer
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode of info.
+func fileID(info os.FileInfo) (dev, ino uint64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), uint64(st.Ino)
+	}
+	return 0, 0
+}
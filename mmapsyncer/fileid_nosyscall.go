@@ -0,0 +1,31 @@
+//go:build nosyscall || !unix
+
+package mmapsyncer
+
+import (
+	"os"
+	"reflect"
+)
+
+// fileID returns the device and inode of info. The syscall package is not
+// available under the nosyscall build tag and has no Stat_t outside Unix,
+// so the fields are read from info.Sys() by reflection. On Windows there
+// are none and both are 0.
+func fileID(info os.FileInfo) (dev, ino uint64) {
+	v := reflect.ValueOf(info.Sys())
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return 0, 0
+	}
+	return uintField(v.Elem(), "Dev"), uintField(v.Elem(), "Ino")
+}
+
+func uintField(v reflect.Value, name string) uint64 {
+	f := v.FieldByName(name)
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(f.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return f.Uint()
+	}
+	return 0
+}
@@ -0,0 +1,196 @@
+package mmapsyncer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+)
+
+// frameHeaderSize is the size of the header preceding every journal entry.
+//
+// The on-disk format does not depend on the byte order of the host, so a
+// journal written on one architecture can be read on any other. Each entry
+// is laid out as
+//
+//	offset 0: payload length, uint32 little endian, never 0
+//	offset 4: CRC-32C (Castagnoli) of the payload, uint32 little endian
+//	offset 8: payload
+//
+// and entries follow each other without alignment. A zero length marks the
+// end of the entries, which is where the zero padding of the mapping starts.
+const frameHeaderSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrCorrupt is returned by ReadAt when an entry fails its checksum or
+	// its length runs past the end of the file.
+	ErrCorrupt = errors.New("mmapsyncer: journal entry corrupt")
+	// ErrEmptyEntry is returned by Append for an empty payload, which could
+	// not be told apart from the padding of the mapping.
+	ErrEmptyEntry = errors.New("mmapsyncer: empty journal entry")
+)
+
+// Journal is an append-only file of checksummed entries written through a
+// memory mapping, a lightweight write-ahead log. Entries are addressed by
+// their offset in the file. It is safe for concurrent use.
+type Journal struct {
+	l *logger.MMapLogger
+
+	mu sync.Mutex // mu guards r
+	r  *os.File
+}
+
+// OpenJournal opens or creates the journal filename. Entries after the last
+// intact one, such as a partial entry or padding left by a crash, are
+// discarded. chunkSize is the number of bytes mapped at a time, 0 means 10MB.
+func OpenJournal(filename string, chunkSize int) (*Journal, error) {
+	// validEnd finds the end of the entries itself, an entry may end in zero bytes
+	j := &Journal{l: &logger.MMapLogger{Filename: filename, ChunkSize: chunkSize, MaxSize: logger.UnlimitedSize, KeepPadding: true}}
+	end, err := validEnd(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.l.Truncate(end); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// validEnd returns the offset just past the last intact entry of filename.
+func validEnd(filename string) (int64, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	var end int64
+	for {
+		payload, err := readFrame(r, info.Size()-end)
+		if err != nil {
+			return end, nil
+		}
+		end += frameHeaderSize + int64(len(payload))
+	}
+}
+
+// readFrame reads one entry from r, which holds at most remaining bytes. It
+// returns io.EOF at the end of the entries, including at zero padding, and
+// ErrCorrupt for a length running past remaining, such as that of a torn
+// header, without allocating it.
+func readFrame(r io.Reader, remaining int64) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(header[:4])
+	if size == 0 {
+		return nil, io.EOF
+	}
+	if int64(size) > remaining-frameHeaderSize {
+		return nil, ErrCorrupt
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, ErrCorrupt
+	}
+	return payload, nil
+}
+
+// Append writes p as a single entry and returns its offset.
+func (j *Journal) Append(p []byte) (offset int64, err error) {
+	if len(p) == 0 {
+		return 0, ErrEmptyEntry
+	}
+	return j.l.Append(encodeFrame(p))
+}
+
+// encodeFrame returns p preceded by its entry header.
+func encodeFrame(p []byte) []byte {
+	frame := make([]byte, frameHeaderSize+len(p))
+	binary.LittleEndian.PutUint32(frame[:4], uint32(len(p)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(p, crcTable))
+	copy(frame[frameHeaderSize:], p)
+	return frame
+}
+
+// ReadAt returns the payload of the entry at offset and the offset of the
+// next entry. It returns io.EOF when no entry has been appended at offset.
+func (j *Journal) ReadAt(offset int64) (payload []byte, next int64, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.r == nil {
+		f, err := os.Open(j.l.Filename)
+		if err != nil {
+			return nil, 0, err
+		}
+		j.r = f
+	}
+	info, err := j.r.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	payload, err = readFrame(io.NewSectionReader(j.r, offset, 1<<62), info.Size()-offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return payload, offset + frameHeaderSize + int64(len(payload)), nil
+}
+
+// Truncate discards the entry at offset and every entry after it. offset
+// must be the offset of an entry or the end of the journal.
+func (j *Journal) Truncate(offset int64) error {
+	if offset < 0 {
+		return fmt.Errorf("mmapsyncer: negative truncate offset %d", offset)
+	}
+	return j.l.Truncate(offset)
+}
+
+// Sync flushes the appended entries to disk.
+func (j *Journal) Sync() error {
+	return j.l.Sync()
+}
+
+// Close syncs and closes the journal.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	if j.r != nil {
+		j.r.Close()
+		j.r = nil
+	}
+	j.mu.Unlock()
+	if err := j.l.Sync(); err != nil {
+		return err
+	}
+	return j.l.Close()
+}
+
+// CursorAt returns a cursor at offset in the journal, for a consumer to
+// commit once it processed the entries before offset.
+func (j *Journal) CursorAt(offset int64) (Cursor, error) {
+	return CursorAt(j.l.Filename, offset)
+}
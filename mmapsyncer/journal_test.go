@@ -0,0 +1,154 @@
+package mmapsyncer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// goldenJournal is a journal holding "hello" and "journal entry 2", as
+// written on any architecture, followed by the zero padding of the mapping.
+const goldenJournal = "05000000" + "4cbb719a" + "68656c6c6f" +
+	"0f000000" + "5cc02769" + "6a6f75726e616c20656e7472792032" +
+	"0000000000000000"
+
+var goldenEntries = []string{"hello", "journal entry 2"}
+
+func TestJournalGoldenEncoding(t *testing.T) {
+	golden, err := hex.DecodeString(goldenJournal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded []byte
+	for _, e := range goldenEntries {
+		encoded = append(encoded, encodeFrame([]byte(e))...)
+	}
+	if want := golden[:len(encoded)]; !bytes.Equal(encoded, want) {
+		t.Fatalf("encoded entries = %x, want %x", encoded, want)
+	}
+}
+
+func TestJournalGoldenDecoding(t *testing.T) {
+	golden, err := hex.DecodeString(goldenJournal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "golden.journal")
+	if err := os.WriteFile(filename, golden, 0644); err != nil {
+		t.Fatal(err)
+	}
+	j, err := OpenJournal(filename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	var offset int64
+	for _, want := range goldenEntries {
+		payload, next, err := j.ReadAt(offset)
+		if err != nil {
+			t.Fatalf("ReadAt(%d): %v", offset, err)
+		}
+		if string(payload) != want {
+			t.Fatalf("ReadAt(%d) = %q, want %q", offset, payload, want)
+		}
+		offset = next
+	}
+	if _, _, err := j.ReadAt(offset); err != io.EOF {
+		t.Fatalf("ReadAt(%d) after the last entry: err = %v, want io.EOF", offset, err)
+	}
+	if off, err := j.Append([]byte("after")); err != nil || off != offset {
+		t.Fatalf("Append = %d, %v, want offset %d", off, err, offset)
+	}
+}
+
+func TestJournalReopenZeroTerminatedEntry(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "zero.journal")
+	entries := []string{"ends in zero\x00", "\x00\x00"}
+	j, err := OpenJournal(filename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if _, err := j.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = OpenJournal(filename, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer j.Close()
+	var offset int64
+	for _, want := range entries {
+		payload, next, err := j.ReadAt(offset)
+		if err != nil {
+			t.Fatalf("ReadAt(%d): %v", offset, err)
+		}
+		if string(payload) != want {
+			t.Fatalf("ReadAt(%d) = %q, want %q", offset, payload, want)
+		}
+		offset = next
+	}
+	if off, err := j.Append([]byte("after")); err != nil || off != offset {
+		t.Fatalf("Append = %d, %v, want offset %d", off, err, offset)
+	}
+}
+
+func TestWriteSyncerKeepsTrailingZeros(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "raw.bin")
+	for _, p := range [][]byte{{1, 0, 0}, {2, 0}} {
+		w := New(filename, Options{})
+		if _, err := w.Write(p); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{1, 0, 0, 2, 0}; !bytes.Equal(data, want) {
+		t.Fatalf("file = %x, want %x", data, want)
+	}
+}
+
+func TestJournalCorruptLength(t *testing.T) {
+	var torn [frameHeaderSize]byte
+	binary.LittleEndian.PutUint32(torn[:4], 0xfffffff0)
+	good := append(encodeFrame([]byte("first")), encodeFrame([]byte("second"))...)
+	filename := filepath.Join(t.TempDir(), "torn.journal")
+	if err := os.WriteFile(filename, append(append(good, torn[:]...), "partial"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	j, err := OpenJournal(filename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+		t.Fatalf("OpenJournal allocated %d bytes for a torn length", alloc)
+	}
+	if off, err := j.Append([]byte("after")); err != nil || off != int64(len(good)) {
+		t.Fatalf("Append = %d, %v, want the torn entry truncated at %d", off, err, len(good))
+	}
+
+	if _, err := readFrame(bytes.NewReader(torn[:]), frameHeaderSize+16); err != ErrCorrupt {
+		t.Fatalf("readFrame of a length past the end = %v, want ErrCorrupt", err)
+	}
+}
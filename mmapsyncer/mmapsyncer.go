@@ -0,0 +1,73 @@
+// Package mmapsyncer exposes the mmap write path as a plain WriteSyncer
+// (Write, Sync and Close) without the log package, so other logging stacks
+// and raw data writers such as metrics spoolers or event recorders can use
+// it without pulling in zap and lumberjack.
+package mmapsyncer
+
+import (
+	"io"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+)
+
+// Options configures a WriteSyncer. The zero value writes a single file
+// that is never rotated.
+type Options struct {
+	MaxSize    int  // MaxSize is the size in megabytes at which the file is rotated, 0 disables rotation.
+	MaxBackups int  // MaxBackups is the maximum number of rotated files to retain, 0 retains all.
+	MaxAge     int  // MaxAge is the maximum number of days to retain rotated files, 0 retains all.
+	Compress   bool // Compress determines if rotated files are compressed using gzip.
+	LocalTime  bool // LocalTime if true -> backup names use local time instead of UTC.
+	ChunkSize  int  // ChunkSize is the number of bytes mapped at a time, 0 means 10MB.
+}
+
+// WriteSyncer writes to a file through a shared memory mapping. It is safe
+// for concurrent use.
+type WriteSyncer struct {
+	l *logger.MMapLogger
+}
+
+var _ io.WriteCloser = (*WriteSyncer)(nil)
+
+// New returns a WriteSyncer appending to filename. The file is opened on the
+// first write. Raw data may end in zero bytes, so unlike the log package it
+// doesn't trim trailing zeros on reopen: padding left by a crash stays in
+// the file and readers have to skip it.
+func New(filename string, opts Options) *WriteSyncer {
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = logger.UnlimitedSize
+	}
+	return &WriteSyncer{l: &logger.MMapLogger{
+		Filename:    filename,
+		MaxSize:     maxSize,
+		MaxBackups:  opts.MaxBackups,
+		MaxAge:      opts.MaxAge,
+		Compress:    opts.Compress,
+		LocalTime:   opts.LocalTime,
+		ChunkSize:   opts.ChunkSize,
+		KeepPadding: true,
+	}}
+}
+
+// Write copies p into the mapping. p is written whole or not at all.
+func (w *WriteSyncer) Write(p []byte) (int, error) {
+	return w.l.Write(p)
+}
+
+// Sync flushes the written part of the mapping to disk.
+func (w *WriteSyncer) Sync() error {
+	return w.l.Sync()
+}
+
+// Rotate closes the current file and starts a new one, even when rotation
+// by size is disabled.
+func (w *WriteSyncer) Rotate() error {
+	return w.l.Rotate()
+}
+
+// Close unmaps and closes the file, trimming the unused part of the last
+// mapping.
+func (w *WriteSyncer) Close() error {
+	return w.l.Close()
+}
@@ -0,0 +1,58 @@
+package mmapsyncer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// backups returns the rotated files of filename.
+func backups(t *testing.T, filename string) []string {
+	t.Helper()
+	ext := filepath.Ext(filename)
+	matches, err := filepath.Glob(filename[:len(filename)-len(ext)] + "-*" + ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestWriteSyncerRotation(t *testing.T) {
+	dir := t.TempDir()
+	record := bytes.Repeat([]byte{7}, 32<<10)
+
+	unrotated := filepath.Join(dir, "events.bin")
+	w := New(unrotated, Options{ChunkSize: 64 << 10})
+	for i := 0; i < 64; i++ { // 2MB through 64KB mappings
+		if _, err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(unrotated); err != nil || info.Size() != 64*int64(len(record)) {
+		t.Fatalf("file without MaxSize: %v, want all %d bytes in one file", err, 64*len(record))
+	}
+	if b := backups(t, unrotated); len(b) != 0 {
+		t.Fatalf("file without MaxSize was rotated: %v", b)
+	}
+
+	rotated := filepath.Join(dir, "metrics.bin")
+	w = New(rotated, Options{MaxSize: 1, ChunkSize: 64 << 10})
+	for i := 0; i < 48; i++ { // 1.5MB with a 1MB MaxSize
+		if _, err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b := backups(t, rotated); len(b) != 2 {
+		t.Fatalf("backups %v, want one rotation by MaxSize and one by Rotate", b)
+	}
+}
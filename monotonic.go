@@ -0,0 +1,38 @@
+package log
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const monotonicKey = "mono_ns"
+
+// processStart carries the monotonic clock reading taken when the package
+// was initialized; durations measured from it are unaffected by wall clock
+// steps.
+var processStart = time.Now()
+
+// monotonicCore adds a "mono_ns" field holding the nanoseconds since
+// process start on the monotonic clock, so records can be ordered even when
+// NTP steps the wall clock between them.
+type monotonicCore struct {
+	zapcore.Core
+}
+
+func (c *monotonicCore) With(fields []zapcore.Field) zapcore.Core {
+	return &monotonicCore{Core: c.Core.With(fields)}
+}
+
+func (c *monotonicCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *monotonicCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	mono := int64(time.Since(processStart))
+	return c.Core.Write(ent, append(fields[:len(fields):len(fields)], zap.Int64(monotonicKey, mono)))
+}
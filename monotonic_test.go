@@ -0,0 +1,40 @@
+package log
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMonotonic(t *testing.T) {
+	dir := t.TempDir()
+	clock := &steppedClock{now: time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)}
+	filename := filepath.Join(dir, "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, Monotonic: true, Clock: clock})
+	l.Info("before the step")
+	clock.add(-time.Hour) // NTP steps the wall clock back
+	time.Sleep(time.Millisecond)
+	l.Info("after the step")
+	l.Close()
+
+	records := decodeRecords(t, filename)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	first, ok1 := records[0][monotonicKey].(float64)
+	second, ok2 := records[1][monotonicKey].(float64)
+	if !ok1 || !ok2 {
+		t.Fatalf("records lack %s: %v", monotonicKey, records)
+	}
+	if second-first < float64(time.Millisecond) {
+		t.Fatalf("%s went from %v to %v across a wall clock step back, want it to keep increasing", monotonicKey, first, second)
+	}
+
+	filename = filepath.Join(dir, "plain.log")
+	l = New(&Config{Output: OutputMmap, Filename: filename})
+	l.Info("plain")
+	l.Close()
+	if rec := decodeRecords(t, filename)[0]; rec[monotonicKey] != nil {
+		t.Fatalf("%s written without Monotonic: %v", monotonicKey, rec)
+	}
+}
@@ -0,0 +1,204 @@
+package log
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Record encodings accepted by Config.Encoding.
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+	EncodingMsgpack = "msgpack"
+)
+
+var msgpackPool = buffer.NewPool()
+
+// encodingOf returns the record encoding used for config.
+func encodingOf(config *Config) string {
+	switch config.Encoding {
+	case EncodingJSON, EncodingConsole, EncodingMsgpack:
+		return config.Encoding
+	}
+	if config.DevMode {
+		return EncodingConsole
+	}
+	return EncodingJSON
+}
+
+// msgpackEncoder encodes every record as a single msgpack map. Records are
+// written back to back without a separator: a map is self-delimiting and
+// never starts with a NUL byte, so ReadMsgpack can tell records from the
+// padding of the mmap output. Timestamps use the msgpack timestamp
+// extension instead of EncodeTime.
+type msgpackEncoder struct {
+	*zapcore.MapObjectEncoder
+	cfg zapcore.EncoderConfig
+}
+
+func newMsgpackEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	return &msgpackEncoder{MapObjectEncoder: zapcore.NewMapObjectEncoder(), cfg: cfg}
+}
+
+func (e *msgpackEncoder) Clone() zapcore.Encoder {
+	clone := zapcore.NewMapObjectEncoder()
+	for k, v := range e.Fields {
+		clone.Fields[k] = copyValue(v)
+	}
+	return &msgpackEncoder{MapObjectEncoder: clone, cfg: e.cfg}
+}
+
+// copyValue deep copies the maps and slices built by a MapObjectEncoder so a
+// clone can be extended without touching its parent.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = copyValue(e)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func (e *msgpackEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	record := e.Clone().(*msgpackEncoder)
+	m := record.Fields
+	if e.cfg.TimeKey != "" {
+		m[e.cfg.TimeKey] = ent.Time
+	}
+	if e.cfg.LevelKey != "" {
+		m[e.cfg.LevelKey] = ent.Level.String()
+	}
+	if e.cfg.NameKey != "" && ent.LoggerName != "" {
+		m[e.cfg.NameKey] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		if e.cfg.CallerKey != "" && e.cfg.EncodeCaller != nil {
+			m[e.cfg.CallerKey] = record.primitive(func(enc zapcore.PrimitiveArrayEncoder) {
+				e.cfg.EncodeCaller(ent.Caller, enc)
+			})
+		}
+		if e.cfg.FunctionKey != "" {
+			m[e.cfg.FunctionKey] = ent.Caller.Function
+		}
+	}
+	if e.cfg.MessageKey != "" {
+		m[e.cfg.MessageKey] = ent.Message
+	}
+	if e.cfg.StacktraceKey != "" && ent.Stack != "" {
+		m[e.cfg.StacktraceKey] = ent.Stack
+	}
+	for _, f := range fields {
+		f.AddTo(record)
+	}
+
+	buf := msgpackPool.Get()
+	enc := msgpack.NewEncoder(buf)
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(m); err != nil {
+		buf.Free()
+		return nil, err
+	}
+	return buf, nil
+}
+
+// primitive returns the value a zap encoder function such as EncodeCaller
+// appends to an array.
+func (e *msgpackEncoder) primitive(fn func(zapcore.PrimitiveArrayEncoder)) interface{} {
+	scratch := zapcore.NewMapObjectEncoder()
+	_ = scratch.AddArray("v", zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+		fn(enc)
+		return nil
+	}))
+	if s, ok := scratch.Fields["v"].([]interface{}); ok && len(s) == 1 {
+		return s[0]
+	}
+	return scratch.Fields["v"]
+}
+
+// ReadMsgpack decodes the msgpack records of r, calling fn for each of them
+// in order. A file header is checked and skipped, as is NUL padding left by
+// the mmap output between or after records.
+func ReadMsgpack(r io.Reader, fn func(record map[string]interface{}) error) error {
+	br := bufio.NewReader(r)
+	h, ok, err := readFileHeader(br)
+	if err != nil {
+		return err
+	}
+	if ok && h.Encoding != EncodingMsgpack {
+		return fmt.Errorf("file header encoding is %v, not %v", h.Encoding, EncodingMsgpack)
+	}
+	dec := msgpack.NewDecoder(br)
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b == 0 {
+			continue
+		}
+		_ = br.UnreadByte()
+		record, err := dec.DecodeMap()
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// ExportJSONL converts the msgpack records of the log file name, which may be
+// a gzip compressed backup, to JSON lines written to w.
+func ExportJSONL(w io.Writer, name string) error {
+	f, err := openLogFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(w)
+	return ReadMsgpack(f, func(record map[string]interface{}) error {
+		return enc.Encode(record)
+	})
+}
+
+// openLogFile opens name, decompressing it when it is a gzip backup.
+func openLogFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
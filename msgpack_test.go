@@ -0,0 +1,139 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// readMsgpackFile returns the msgpack records of filename.
+func readMsgpackFile(t *testing.T, filename string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []map[string]interface{}
+	if err := ReadMsgpack(f, func(record map[string]interface{}) error {
+		records = append(records, record)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestMsgpackEncoding(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, Encoding: EncodingMsgpack, FileHeader: true})
+	child := l.(*zapLogger).Child("component", "db") // With would add the field to l itself
+	child.Info("query", "rows", 3, "tables", []string{"a", "b"})
+	l.Warn("parent")
+	l.Close()
+
+	records := readMsgpackFile(t, filename)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %v", len(records), records)
+	}
+	first, second := records[0], records[1]
+	if first["level"] != "info" || first["msg"] != "query" || first["component"] != "db" {
+		t.Errorf("first record = %v", first)
+	}
+	switch rows := first["rows"].(type) {
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		if fmt.Sprint(rows) != "3" {
+			t.Errorf("rows = %v, want 3", rows)
+		}
+	default:
+		t.Errorf("rows = %#v, want an integer", rows)
+	}
+	if tables, ok := first["tables"].([]interface{}); !ok || len(tables) != 2 || tables[0] != "a" {
+		t.Errorf("tables = %#v, want an array", first["tables"])
+	}
+	if _, ok := first["time"].(time.Time); !ok {
+		t.Errorf("time = %#v, want a msgpack timestamp", first["time"])
+	}
+	if caller, ok := first["caller"].(string); !ok || !strings.Contains(caller, "msgpack_test.go") {
+		t.Errorf("caller = %#v", first["caller"])
+	}
+	if _, ok := second["component"]; ok || second["msg"] != "parent" {
+		t.Errorf("field of a child logger leaked into its parent: %v", second)
+	}
+}
+
+func TestReadMsgpackSkipsPadding(t *testing.T) {
+	var buf bytes.Buffer
+	for _, msg := range []string{"a", "b"} {
+		b, err := msgpack.Marshal(map[string]interface{}{"msg": msg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(b)
+		buf.Write(make([]byte, 16)) // padding of the mmap output
+	}
+	var msgs []string
+	if err := ReadMsgpack(&buf, func(record map[string]interface{}) error {
+		msgs = append(msgs, record["msg"].(string))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(msgs, ",") != "a,b" {
+		t.Fatalf("records %v, want a,b", msgs)
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, Encoding: EncodingMsgpack})
+	l.Info("first", "n", 1)
+	l.Error("second")
+	l.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := filepath.Join(dir, "app-backup.log.gz")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(data)
+	zw.Close()
+	if err := os.WriteFile(compressed, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{filename, compressed} {
+		var out bytes.Buffer
+		if err := ExportJSONL(&out, name); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("%s: exported %d lines, want 2:\n%s", filepath.Base(name), len(lines), out.String())
+		}
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec["msg"] != "first" || rec["n"] != float64(1) || rec["level"] != "info" {
+			t.Fatalf("%s: first line = %v", filepath.Base(name), rec)
+		}
+	}
+}
+
+func TestMsgpackNotTailed(t *testing.T) {
+	if _, err := ShipperConfig(&Config{Output: OutputMmap, Filename: "app.log", Encoding: EncodingMsgpack}, ShipperVector); err == nil || !strings.Contains(err.Error(), "ExportJSONL") {
+		t.Fatalf("ShipperConfig for msgpack records = %v, want an error pointing at ExportJSONL", err)
+	}
+}
@@ -1,21 +1,36 @@
 package log
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math"
+	"os"
 	"strings"
+	"sync"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 type Output int
 
 const (
-	OutputConsole Output = iota
+	OutputConsole Output = iota // OutputConsole writes to stdout, like OutputStdout.
 	OutputFile
 	OutputMmap
+	OutputStdout
+	OutputStderr // OutputStderr keeps stdout free for the data a CLI prints.
 )
 
 var outputMap = map[string]Output{
 	"console": OutputConsole,
 	"file":    OutputFile,
+	"mmap":    OutputMmap,
+	"stdout":  OutputStdout,
+	"stderr":  OutputStderr,
 }
 
 // UnmarshalText Unmarshal the text.
@@ -27,3 +42,176 @@ func (o *Output) UnmarshalText(text []byte) error {
 	*o = output
 	return nil
 }
+
+// String returns the name of the output.
+func (o Output) String() string {
+	for name, out := range outputMap {
+		if out == o {
+			return name
+		}
+	}
+	return fmt.Sprintf("Output(%d)", int(o))
+}
+
+// valid reports whether o is one of the Output constants.
+func (o Output) valid() bool {
+	return o >= OutputConsole && o <= OutputStderr
+}
+
+// writesFiles reports whether o writes to log files rather than to stdout
+// or stderr.
+func (o Output) writesFiles() bool {
+	return o == OutputFile || o == OutputMmap
+}
+
+// outputSyncer is the WriteSyncer behind a logger's core. The underlying
+// output can be replaced at runtime without rebuilding the core.
+type outputSyncer struct {
+	mu     sync.RWMutex
+	ws     zapcore.WriteSyncer
+	closer io.Closer // closer is nil for console output
+	output Output
+}
+
+func newOutputSyncer(config *Config, output Output) *outputSyncer {
+	ws, closer := buildOutput(config, output)
+	return &outputSyncer{ws: ws, closer: closer, output: output}
+}
+
+// buildOutput creates the WriteSyncer for output with the settings of config.
+func buildOutput(config *Config, output Output) (zapcore.WriteSyncer, io.Closer) {
+	switch output {
+	case OutputFile:
+		lumberJackLogger := newFileLogger(config, config.Filename)
+		return zapcore.AddSync(lumberJackLogger), lumberJackLogger
+	case OutputMmap:
+		mmapLogger = newMMapLogger(config, config.Filename)
+		if err := mmapLogger.Validate(); err != nil {
+			reportError(config, fmt.Errorf("mmap output: %w", err))
+		}
+		if !config.LazyOpen {
+			if err := mmapLogger.Warmup(); err != nil {
+				reportError(config, fmt.Errorf("warm up mmap output: %v", err))
+			}
+		}
+		return zapcore.AddSync(mmapLogger), mmapLogger
+	case OutputStderr:
+		return zapcore.AddSync(os.Stderr), nil
+	default: // OutputConsole and OutputStdout, Validate rejects any other value
+		return zapcore.AddSync(os.Stdout), nil
+	}
+}
+
+// newFileLogger returns a lumberjack logger writing to filename with the
+// rotation settings of config.
+func newFileLogger(config *Config, filename string) *lumberjack.Logger {
+	maxSize := config.MaxSize
+	if config.MaxSize == UnlimitedSize { // lumberjack has no unlimited size
+		maxSize = math.MaxInt >> 20
+	}
+	return &lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    maxSize,
+		MaxAge:     config.MaxAge,
+		MaxBackups: config.MaxBackups,
+		LocalTime:  true,
+		Compress:   config.Compress,
+	}
+}
+
+func (o *outputSyncer) Write(p []byte) (int, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.ws.Write(p)
+}
+
+func (o *outputSyncer) Sync() error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.ws.Sync()
+}
+
+// set syncs and closes the current output, then replaces it with a new one
+// of the given kind. Writes wait meanwhile. The old output is closed first
+// because both may write the same file: closing the mmap output trims its
+// padding, which would cut off records the new output appended after it.
+func (o *outputSyncer) set(config *Config, output Output) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	err := o.ws.Sync()
+	if o.closer != nil {
+		err = multierr.Append(err, o.closer.Close())
+	}
+	o.ws, o.closer = buildOutput(config, output)
+	o.output = output
+	return err
+}
+
+// writesFiles reports whether the current output writes to log files.
+func (o *outputSyncer) writesFiles() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.output.writesFiles()
+}
+
+// stdout reports whether the current output writes to stdout.
+func (o *outputSyncer) stdout() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.output == OutputConsole || o.output == OutputStdout
+}
+
+func (o *outputSyncer) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closer == nil {
+		return nil
+	}
+	return o.closer.Close()
+}
+
+// WaitMaintenance waits for the retention runs of the mmap output, if any.
+func (o *outputSyncer) WaitMaintenance(ctx context.Context) error {
+	o.mu.RLock()
+	m, ok := o.closer.(*logger.MMapLogger)
+	o.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return m.WaitMaintenance(ctx)
+}
+
+// seal seals the final segment of the mmap output, if any.
+func (o *outputSyncer) seal(ctx context.Context) ([]string, error) {
+	o.mu.RLock()
+	m, ok := o.closer.(*logger.MMapLogger)
+	o.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	path, err := m.Seal(ctx)
+	if path == "" {
+		return nil, err
+	}
+	return []string{path}, err
+}
+
+// droppedBytes returns the bytes the async buffer of the mmap output, if
+// any, dropped on overflow.
+func (o *outputSyncer) droppedBytes() uint64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if m, ok := o.closer.(*logger.MMapLogger); ok {
+		return m.DroppedBytes()
+	}
+	return 0
+}
+
+func (o *outputSyncer) DroppedCount() uint64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if d, ok := o.closer.(interface{ DroppedCount() uint64 }); ok {
+		return d.DroppedCount()
+	}
+	return 0
+}
@@ -0,0 +1,207 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readRecords returns the records of filename, failing on NUL padding.
+func readRecords(t *testing.T, filename string) string {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		t.Fatalf("%s has a NUL byte at %d of %d", filepath.Base(filename), i, len(data))
+	}
+	return string(data)
+}
+
+func TestSetOutputSameFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename}).(*zapLogger)
+	stop := make(chan struct{})
+	written := make(chan int)
+	go func() { // records written while the output is switched
+		n := 0
+		for ; ; n++ {
+			select {
+			case <-stop:
+				written <- n
+				return
+			default:
+				l.Info("record", "i", n)
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		output := OutputFile
+		if i%2 == 1 {
+			output = OutputMmap
+		}
+		if err := l.SetOutput(output); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	total := <-written
+	l.Close()
+
+	out := readRecords(t, filename)
+	if n := strings.Count(out, `"msg":"record"`); n != total {
+		t.Fatalf("%d of %d records in the file", n, total)
+	}
+}
+
+func TestSetOutputSwitchesRoutes(t *testing.T) {
+	dir := t.TempDir()
+	l := New(&Config{Output: OutputMmap, Filename: filepath.Join(dir, "app.log"), RouteField: "tenant"}).(*zapLogger)
+	l.Info("first", "tenant", "acme")
+	if err := l.SetOutput(OutputFile); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("second", "tenant", "acme")
+	if err := l.SetOutput(OutputStderr); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("third", "tenant", "acme")
+	l.Close()
+
+	out := readRecords(t, filepath.Join(dir, "app-acme.log"))
+	for _, want := range []string{"first", "second"} {
+		if !strings.Contains(out, `"msg":"`+want+`"`) {
+			t.Errorf("%s lost:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "third") {
+		t.Errorf("record written to the routed file while the output is stderr:\n%s", out)
+	}
+}
+
+func TestRawBufferStats(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, RawBufferSize: 16}).(*zapLogger)
+	l.Info("encoded by zap")
+	if err := l.Raw(LevelInfo, []byte(`{"msg":"has its newline"}`+"\n")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := l.Raw(LevelInfo, []byte(`{"msg":"needs a newline"}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := l.BufferStats()
+	l.Close()
+
+	if stats.RawBufferSize != 16 || stats.RawGets != 3 || stats.RawGrown == 0 {
+		t.Fatalf("stats = %+v, want 3 gets of grown 16 byte buffers", stats)
+	}
+	if stats.RawHitRate() < 0 || stats.RawHitRate() > 1 {
+		t.Fatalf("hit rate %v out of range", stats.RawHitRate())
+	}
+	if n := strings.Count(readRecords(t, filename), "\n"); n != 5 {
+		t.Fatalf("%d records, want 5", n)
+	}
+}
+
+func TestNegativeMaxSize(t *testing.T) {
+	tests := map[int]int{
+		0:             defaultMaxSize,
+		-2:            defaultMaxSize, // only UnlimitedSize disables size-based rotation
+		UnlimitedSize: UnlimitedSize,
+		5:             5,
+	}
+	for maxSize, want := range tests {
+		l := New(&Config{Output: OutputConsole, MaxSize: maxSize}).(*zapLogger)
+		got := l.EffectiveConfig().MaxSize
+		l.Close()
+		if got != want {
+			t.Errorf("MaxSize %d: effective %d, want %d", maxSize, got, want)
+		}
+	}
+	if got := newFileLogger(&Config{MaxSize: UnlimitedSize}, "app.log").MaxSize; got != math.MaxInt>>20 {
+		t.Errorf("lumberjack MaxSize for UnlimitedSize = %d", got)
+	}
+}
+
+func TestLogConfigFollowsLevel(t *testing.T) {
+	for _, level := range []Level{LevelInfo, LevelWarn} {
+		filename := filepath.Join(t.TempDir(), "app.log")
+		l := New(&Config{Output: OutputMmap, Filename: filename, Level: level, LogConfig: true})
+		l.Close()
+		logged := strings.Contains(readRecords(t, filename), `"msg":"effective config"`)
+		if logged != (level == LevelInfo) {
+			t.Errorf("level %v: effective config logged = %v", level, logged)
+		}
+	}
+}
+
+func TestWaitMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, MaxSize: 1, Compress: true})
+	record := strings.Repeat("x", 64<<10)
+	for i := 0; i < 20; i++ { // 1.25MB, one rotation
+		l.Info(record)
+	}
+	if err := l.(Maintainer).WaitMaintenance(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	compressed, _ := filepath.Glob(filepath.Join(dir, "app-*.log.gz"))
+	plain, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if len(compressed) != 1 || len(plain) != 0 {
+		t.Fatalf("after WaitMaintenance: compressed %v, uncompressed %v, want the backup compressed", compressed, plain)
+	}
+	l.Close()
+}
+
+func TestConsoleOutputs(t *testing.T) {
+	for _, output := range []Output{OutputConsole, OutputStdout, OutputStderr} {
+		var stderr string
+		stdout := captureStdout(t, func() {
+			stderr = captureStderr(t, func() {
+				l := New(&Config{Output: output, Encoding: EncodingJSON})
+				l.Info("to the console")
+				l.Close()
+			})
+		})
+		got, other := stdout, stderr
+		if output == OutputStderr {
+			got, other = stderr, stdout
+		}
+		if !strings.Contains(got, "to the console") || strings.Contains(other, "to the console") {
+			t.Errorf("%v: stdout %q, stderr %q", output, stdout, stderr)
+		}
+	}
+}
+
+func TestUnknownOutput(t *testing.T) {
+	if err := (&Config{Output: OutputStderr + 1}).Validate(); err == nil || !strings.Contains(err.Error(), "not support output") {
+		t.Fatalf("Validate of an unknown output = %v", err)
+	}
+	var o Output
+	if err := o.UnmarshalText([]byte("syslog")); err == nil {
+		t.Fatal("UnmarshalText accepted syslog")
+	}
+	if err := o.UnmarshalText([]byte("STDERR")); err != nil || o != OutputStderr {
+		t.Fatalf("UnmarshalText(STDERR) = %v, %v", o, err)
+	}
+
+	var errs []error
+	stdout := captureStdout(t, func() {
+		l := New(&Config{Output: Output(42), Encoding: EncodingJSON, OnError: func(err error) { errs = append(errs, err) }})
+		l.Info("falls back to the console")
+		l.Close()
+	})
+	if len(errs) == 0 || !strings.Contains(stdout, "falls back to the console") {
+		t.Fatalf("unknown output: errors %v, stdout %q, want the error reported and the console used", errs, stdout)
+	}
+}
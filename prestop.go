@@ -0,0 +1,63 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// Archiver uploads a sealed log file, e.g. to object storage, before the
+// process is killed.
+type Archiver func(ctx context.Context, path string) error
+
+// PreStopFlush prepares every logger created by New for the process being
+// killed, for Kubernetes preStop hooks and SIGTERM handlers. It waits for
+// pending retention and compression, seals the final segment of the mmap
+// output as a backup, compressed if Compress is set, and hands it to
+// Config.Archiver. It gives up after timeout. Loggers stay usable; records
+// written afterwards go to a new file.
+func PreStopFlush(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	registry.mu.Lock()
+	loggers := append([]Logger(nil), registry.loggers...)
+	registry.mu.Unlock()
+
+	var err error
+	for _, l := range loggers {
+		if p, ok := l.(interface{ preStopFlush(context.Context) error }); ok {
+			err = multierr.Append(err, p.preStopFlush(ctx))
+		}
+	}
+	return err
+}
+
+// sealer is implemented by the sinks writing mmap files.
+type sealer interface {
+	seal(ctx context.Context) ([]string, error)
+}
+
+func (l *zapLogger) preStopFlush(ctx context.Context) error {
+	_ = l.logger.Sync() // syncing a console output fails on pipes; Seal reports errors of the files
+	err := l.WaitMaintenance(ctx)
+	var sealed []string
+	for _, s := range l.sinks {
+		if s, ok := s.(sealer); ok {
+			paths, errSeal := s.seal(ctx)
+			err = multierr.Append(err, errSeal)
+			sealed = append(sealed, paths...)
+		}
+	}
+	if l.config.Archiver == nil {
+		return err
+	}
+	for _, path := range sealed {
+		if errArchive := l.config.Archiver(ctx, path); errArchive != nil {
+			err = multierr.Append(err, fmt.Errorf("archive %s: %w", path, errArchive))
+		}
+	}
+	return err
+}
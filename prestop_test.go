@@ -0,0 +1,69 @@
+package log
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPreStopFlush(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	var mu sync.Mutex
+	var archived []string
+	archiver := func(ctx context.Context, path string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasPrefix(path, dir) {
+			archived = append(archived, path)
+		}
+		return nil
+	}
+	l := New(&Config{Output: OutputMmap, Filename: filename, Compress: true, Archiver: archiver})
+	defer l.Close()
+	l.Info("before the hook")
+
+	if err := PreStopFlush(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 1 || !strings.HasSuffix(archived[0], ".log.gz") {
+		t.Fatalf("archived %v, want the compressed final segment", archived)
+	}
+	if out := readGzipFile(t, archived[0]); !strings.Contains(out, "before the hook") {
+		t.Fatalf("sealed segment lacks the record:\n%s", out)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("live file still present after sealing: %v", err)
+	}
+
+	l.Info("after the hook")
+	l.Close()
+	if out := readRecords(t, filename); !strings.Contains(out, "after the hook") || strings.Contains(out, "before the hook") {
+		t.Fatalf("records after the hook should start a new file:\n%s", out)
+	}
+}
+
+// readGzipFile returns the decompressed content of a gzip file.
+func readGzipFile(t *testing.T, name string) string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,69 @@
+package log
+
+import (
+	"fmt"
+	"os"
+)
+
+// Config profiles supported by Profile.
+const (
+	ProfileDev  = "dev"
+	ProfileProd = "prod"
+	ProfileTest = "test"
+)
+
+var profiles = map[string]func() *Config{
+	// dev prints colourful debug records to the console.
+	ProfileDev: func() *Config {
+		return &Config{
+			Level:   LevelDebug,
+			Output:  OutputConsole,
+			DevMode: true,
+			MaxSize: UnlimitedSize,
+		}
+	},
+	// prod writes JSON records through the mmap output, rotating at 100MB
+	// into compressed backups and sampling repeated messages.
+	ProfileProd: func() *Config {
+		return &Config{
+			Level:            LevelInfo,
+			Output:           OutputMmap,
+			Encoding:         EncodingJSON,
+			MaxSize:          defaultMaxSize,
+			MaxAge:           defaultMaxAge,
+			MaxBackups:       defaultMaxBackups,
+			Compress:         true,
+			CallerTrimPrefix: "auto",
+			CrashMarker:      true,
+			Lifecycle:        true,
+			SampleKey:        SampleByMessage,
+			SampleFirst:      defaultSampleFirst,
+			SampleThereafter: defaultSampleThereafter,
+			SampleTick:       defaultSampleTick,
+		}
+	},
+	// test prints every record as JSON to the console, without stack
+	// traces, so tests can parse what they log.
+	ProfileTest: func() *Config {
+		return &Config{
+			Level:             LevelDebug,
+			Output:            OutputConsole,
+			Encoding:          EncodingJSON,
+			DisableStacktrace: true,
+		}
+	},
+}
+
+// Profile returns a new, fully populated Config for the named profile:
+// "dev", "prod" or "test", e.g. log.New(log.Profile(log.ProfileProd)).
+// The Config can be adjusted before it is passed to New. An unknown name is
+// reported on stderr and yields the default Config.
+func Profile(name string) *Config {
+	profile, ok := profiles[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "not support profile: %v\n", name)
+		c := *defaultConfig
+		return &c
+	}
+	return profile()
+}
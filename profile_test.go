@@ -0,0 +1,59 @@
+package log
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	prod := Profile(ProfileProd)
+	if prod.Output != OutputMmap || prod.Encoding != EncodingJSON || !prod.Compress || prod.MaxSize != defaultMaxSize || prod.SampleKey == nil {
+		t.Errorf("prod profile = %+v, want compressed, sampled JSON through mmap", prod)
+	}
+	prod.Level = LevelError
+	if again := Profile(ProfileProd); again.Level != LevelInfo {
+		t.Fatal("changing a returned profile changed the next one")
+	}
+	if dev := Profile(ProfileDev); dev.Output != OutputConsole || !dev.DevMode || dev.Level != LevelDebug {
+		t.Errorf("dev profile = %+v, want debug records on the console", dev)
+	}
+	if c := Profile("staging"); c.Level != defaultConfig.Level || c == defaultConfig {
+		t.Errorf("unknown profile = %+v, want a copy of the default config", c)
+	}
+}
+
+func TestProdProfileSamples(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	config := Profile(ProfileProd)
+	config.Filename = filename
+	config.SampleFirst = 2
+	config.SampleThereafter = -1
+	l := New(config)
+	for i := 0; i < 5; i++ {
+		l.Info("repeated")
+	}
+	l.Info("distinct")
+	l.Close()
+
+	counts := countBy(decodeRecords(t, filename), "msg")
+	if counts["repeated"] != 2 || counts["distinct"] != 1 {
+		t.Fatalf("records kept per message = %v, want the first 2 of a repeated message", counts)
+	}
+}
+
+func TestTestProfile(t *testing.T) {
+	out := captureStdout(t, func() {
+		l := New(Profile(ProfileTest))
+		l.Debug("parsed by the test", "n", 1)
+		l.Close()
+	})
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &rec); err != nil {
+		t.Fatalf("test profile output is not one JSON record: %v: %q", err, out)
+	}
+	if rec["msg"] != "parsed by the test" || rec["n"] != float64(1) {
+		t.Fatalf("record = %v", rec)
+	}
+}
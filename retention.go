@@ -0,0 +1,45 @@
+package log
+
+import (
+	"errors"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+)
+
+var errNoRetentionPlan = errors.New("retention plan is only supported for mmap output")
+
+// RetentionPlan reports what the retention of the mmap output configured by
+// config would remove, compress and recompress right now, without changing
+// any file. It does not open the log file, so it can be used to validate
+// MaxAge, MaxBackups and KeepPatterns changes before applying them.
+func RetentionPlan(config *Config) (*logger.RetentionPlan, error) {
+	if config.Output != OutputMmap {
+		return nil, errNoRetentionPlan
+	}
+	c := *config
+	if c.Filename == "" {
+		c.Filename = defaultFilename
+	}
+	applyUnits(&c)
+	if c.MaxAge <= 0 {
+		c.MaxAge = defaultMaxAge
+	}
+	if c.MaxBackups <= 0 {
+		c.MaxBackups = defaultMaxBackups
+	}
+	return newMMapLogger(&c, c.Filename).RetentionPlan()
+}
+
+func (l *zapLogger) RetentionPlan() (*logger.RetentionPlan, error) {
+	return l.output.retentionPlan()
+}
+
+func (o *outputSyncer) retentionPlan() (*logger.RetentionPlan, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	m, ok := o.closer.(*logger.MMapLogger)
+	if !ok {
+		return nil, errNoRetentionPlan
+	}
+	return m.RetentionPlan()
+}
@@ -0,0 +1,385 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+)
+
+// router owns the per-value sinks of a routingCore. Sinks are created
+// lazily on the first record carrying a new value. With RouteMaxOpen or
+// RouteIdleTimeout set, least recently used and idle sinks are closed and
+// reopened on their next record. The sinks write through mmap or plain
+// files following SetOutput; while the output is the console, records go
+// to the fallback whatever their value.
+type router struct {
+	config   *Config
+	fallback zapcore.WriteSyncer
+	counters *writeCounters
+
+	mu      sync.RWMutex
+	sinks   map[string]*routedSink
+	dropped uint64 // dropped records of evicted sinks
+	output  Output // output is the kind of the routed sinks
+
+	stop chan struct{} // stop ends the idle eviction loop, nil without RouteIdleTimeout
+}
+
+type routedSink struct {
+	zapcore.WriteSyncer
+	closer io.Closer
+	mmap   *logger.MMapLogger // mmap is nil for a plain file
+
+	mu       sync.RWMutex // mu is held for reading while writing and for writing while evicting
+	closed   bool         // closed is set once the sink has been evicted
+	lastUsed atomic.Int64 // lastUsed is the time of the last write in unix nanoseconds
+}
+
+func newRouter(config *Config, fallback zapcore.WriteSyncer, counters *writeCounters) *router {
+	r := &router{config: config, fallback: fallback, counters: counters, sinks: map[string]*routedSink{}, output: OutputMmap}
+	if config.RouteIdleTimeout > 0 {
+		r.stop = make(chan struct{})
+		go r.evictLoop(config.RouteIdleTimeout, r.stop)
+	}
+	return r
+}
+
+func (r *router) now() time.Time {
+	if r.config.Clock != nil {
+		return r.config.Clock.Now()
+	}
+	return time.Now()
+}
+
+// filename renders the RouteFilename template for value. Path separators
+// in value are replaced so a field value can never escape the directory.
+func (r *router) filename(value string) string {
+	value = strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(value)
+	template := r.config.RouteFilename
+	if template == "" {
+		ext := filepath.Ext(r.config.Filename)
+		template = strings.TrimSuffix(r.config.Filename, ext) + "-{" + r.config.RouteField + "}" + ext
+	}
+	return strings.ReplaceAll(template, "{"+r.config.RouteField+"}", value)
+}
+
+// write writes p to the sink for value, the fallback for records without
+// one, and syncs it if sync is set. A sink evicted between lookup and write
+// is looked up again, which reopens it.
+func (r *router) write(value string, p []byte, sync bool) error {
+	if value == "" || !r.routes() {
+		if _, err := r.fallback.Write(p); err != nil || !sync {
+			return err
+		}
+		return r.fallback.Sync()
+	}
+	for {
+		s := r.sink(value)
+		s.mu.RLock()
+		if s.closed {
+			s.mu.RUnlock()
+			continue
+		}
+		s.lastUsed.Store(r.now().UnixNano())
+		_, err := s.Write(p)
+		if err == nil && sync {
+			err = s.Sync()
+		}
+		s.mu.RUnlock()
+		return err
+	}
+}
+
+// routes reports whether records are routed to per-value files.
+func (r *router) routes() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.output.writesFiles()
+}
+
+// setOutput closes every sink, so the records that follow reopen their
+// files through output.
+func (r *router) setOutput(output Output) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := make([]string, 0, len(r.sinks))
+	for value := range r.sinks {
+		values = append(values, value)
+	}
+	err := r.closeLocked(values)
+	r.output = output
+	return err
+}
+
+// sink returns the routed sink for value, creating it if needed. Creating a
+// sink beyond RouteMaxOpen evicts the least recently used one.
+func (r *router) sink(value string) *routedSink {
+	r.mu.RLock()
+	s, ok := r.sinks[value]
+	r.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	r.mu.Lock()
+	if s, ok = r.sinks[value]; ok {
+		r.mu.Unlock()
+		return s
+	}
+	defer r.mu.Unlock()
+	if max := r.config.RouteMaxOpen; max > 0 && len(r.sinks) >= max {
+		r.evictLocked(r.leastRecentlyUsed(len(r.sinks) - max + 1))
+	}
+	if r.output == OutputFile {
+		f := newFileLogger(r.config, r.filename(value))
+		s = &routedSink{WriteSyncer: &countingSyncer{WriteSyncer: zapcore.AddSync(f), counters: r.counters}, closer: f}
+	} else {
+		m := newMMapLogger(r.config, r.filename(value))
+		s = &routedSink{WriteSyncer: &countingSyncer{WriteSyncer: zapcore.AddSync(m), counters: r.counters}, closer: m, mmap: m}
+		m.OnFDExhausted = func() { r.evictForFD(s) }
+	}
+	s.lastUsed.Store(r.now().UnixNano())
+	r.sinks[value] = s
+	return s
+}
+
+// leastRecentlyUsed returns the values of the n least recently used sinks.
+// The caller must hold r.mu.
+func (r *router) leastRecentlyUsed(n int) []string {
+	values := make([]string, 0, len(r.sinks))
+	for value := range r.sinks {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return r.sinks[values[i]].lastUsed.Load() < r.sinks[values[j]].lastUsed.Load()
+	})
+	if n > len(values) {
+		n = len(values)
+	}
+	return values[:n]
+}
+
+// evictLocked closes the sinks for values once their in-flight writes are
+// done and removes them from the router. r.mu stays held throughout so the
+// file is not reopened before it is closed. Close errors are reported
+// through OnError.
+func (r *router) evictLocked(values []string) {
+	if err := r.closeLocked(values); err != nil {
+		reportError(r.config, fmt.Errorf("close idle route sink: %v", err))
+	}
+}
+
+// closeLocked closes the sinks for values like evictLocked, returning the
+// close errors. The caller must hold r.mu.
+func (r *router) closeLocked(values []string) error {
+	var err error
+	for _, value := range values {
+		s := r.sinks[value]
+		delete(r.sinks, value)
+		s.mu.Lock()
+		s.closed = true
+		err = multierr.Append(err, s.closer.Close())
+		s.mu.Unlock()
+		if s.mmap != nil {
+			atomic.AddUint64(&r.dropped, s.mmap.DroppedCount())
+		}
+	}
+	return err
+}
+
+// evictForFD closes the least recently used sink other than self to free a
+// file descriptor for it. It runs while self is being written to, so sinks
+// that are busy, including self, are skipped rather than waited for.
+func (r *router) evictForFD(self *routedSink) {
+	if !r.mu.TryLock() {
+		return
+	}
+	defer r.mu.Unlock()
+	for _, value := range r.leastRecentlyUsed(len(r.sinks)) {
+		s := r.sinks[value]
+		if s == self || !s.mu.TryLock() {
+			continue
+		}
+		s.mu.Unlock()
+		r.evictLocked([]string{value})
+		return
+	}
+}
+
+// evictLoop closes sinks that have not been written to for idle until the
+// router is closed.
+func (r *router) evictLoop(idle time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(idle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.evictIdle(idle)
+		}
+	}
+}
+
+// evictIdle closes the sinks idle for at least idle.
+func (r *router) evictIdle(idle time.Duration) {
+	cutoff := r.now().Add(-idle).UnixNano()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var values []string
+	for value, s := range r.sinks {
+		if s.lastUsed.Load() <= cutoff {
+			values = append(values, value)
+		}
+	}
+	r.evictLocked(values)
+}
+
+func (r *router) Sync() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var err error
+	for _, s := range r.sinks {
+		err = multierr.Append(err, s.Sync())
+	}
+	return err
+}
+
+// Close closes every routed sink. The fallback is owned by the caller.
+func (r *router) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+	values := make([]string, 0, len(r.sinks))
+	for value := range r.sinks {
+		values = append(values, value)
+	}
+	return r.closeLocked(values)
+}
+
+func (r *router) DroppedCount() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := atomic.LoadUint64(&r.dropped)
+	for _, s := range r.sinks {
+		if s.mmap != nil {
+			n += s.mmap.DroppedCount()
+		}
+	}
+	return n
+}
+
+// WaitMaintenance waits for the retention runs of every routed sink.
+func (r *router) WaitMaintenance(ctx context.Context) error {
+	r.mu.RLock()
+	sinks := make([]*routedSink, 0, len(r.sinks))
+	for _, s := range r.sinks {
+		if s.mmap != nil {
+			sinks = append(sinks, s)
+		}
+	}
+	r.mu.RUnlock()
+	var err error
+	for _, s := range sinks {
+		err = multierr.Append(err, s.mmap.WaitMaintenance(ctx))
+	}
+	return err
+}
+
+// seal seals the final segment of every routed file.
+func (r *router) seal(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	sinks := make([]*routedSink, 0, len(r.sinks))
+	for _, s := range r.sinks {
+		if s.mmap != nil {
+			sinks = append(sinks, s)
+		}
+	}
+	r.mu.RUnlock()
+	var paths []string
+	var err error
+	for _, s := range sinks {
+		path, errSeal := s.mmap.Seal(ctx)
+		err = multierr.Append(err, errSeal)
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, err
+}
+
+var _ io.Closer = (*router)(nil)
+
+// routingCore is a zapcore.Core writing each record to the sink selected by
+// the value of the configured route field, taken from the record's own
+// fields or from fields bound earlier through With.
+type routingCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	router *router
+	value  string
+}
+
+func (c *routingCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &routingCore{LevelEnabler: c.LevelEnabler, enc: c.enc.Clone(), router: c.router, value: c.value}
+	if v, ok := fieldValue(fields, c.router.config.RouteField); ok {
+		clone.value = v
+	}
+	for i := range fields {
+		fields[i].AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *routingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *routingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	value := c.value
+	if v, ok := fieldValue(fields, c.router.config.RouteField); ok {
+		value = v
+	}
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	return c.router.write(value, buf.Bytes(), ent.Level > zapcore.ErrorLevel)
+}
+
+func (c *routingCore) Sync() error {
+	return multierr.Append(c.router.fallback.Sync(), c.router.Sync())
+}
+
+// fieldValue returns the string form of the field named key in fields.
+func fieldValue(fields []zapcore.Field, key string) (string, bool) {
+	for _, f := range fields {
+		if f.Key != key {
+			continue
+		}
+		if f.Type == zapcore.StringType {
+			return f.String, true
+		}
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		return fmt.Sprint(enc.Fields[key]), true
+	}
+	return "", false
+}
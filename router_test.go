@@ -0,0 +1,100 @@
+package log
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// steppedClock is a zapcore.Clock that only moves when told to.
+type steppedClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *steppedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *steppedClock) NewTicker(d time.Duration) *time.Ticker { return time.NewTicker(d) }
+
+func (c *steppedClock) add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// routerOf returns the router of a logger created with RouteField.
+func routerOf(t *testing.T, l *zapLogger) *router {
+	t.Helper()
+	for _, s := range l.sinks {
+		if r, ok := s.(*router); ok {
+			return r
+		}
+	}
+	t.Fatal("logger has no router")
+	return nil
+}
+
+func openRoutes(r *router) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var values []string
+	for value := range r.sinks {
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestRouteMaxOpen(t *testing.T) {
+	dir := t.TempDir()
+	clock := &steppedClock{now: time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)}
+	l := New(&Config{Output: OutputMmap, Filename: filepath.Join(dir, "app.log"), RouteField: "tenant", RouteMaxOpen: 2, Clock: clock}).(*zapLogger)
+	r := routerOf(t, l)
+	for _, tenant := range []string{"a", "b", "a", "c"} {
+		l.Info("first", "tenant", tenant)
+		clock.add(time.Second)
+	}
+	open := openRoutes(r)
+	if len(open) != 2 || strings.Contains(strings.Join(open, ","), "b") {
+		t.Fatalf("open routes = %v, want a and c with b, the least recently used, evicted", open)
+	}
+	l.Info("second", "tenant", "b")
+	l.Close()
+
+	out := readRecords(t, filepath.Join(dir, "app-b.log"))
+	for _, want := range []string{"first", "second"} {
+		if !strings.Contains(out, `"msg":"`+want+`"`) {
+			t.Errorf("%s lost after the sink was reopened:\n%s", want, out)
+		}
+	}
+}
+
+func TestRouteIdleTimeout(t *testing.T) {
+	dir := t.TempDir()
+	clock := &steppedClock{now: time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)}
+	l := New(&Config{Output: OutputMmap, Filename: filepath.Join(dir, "app.log"), RouteField: "tenant", RouteIdleTimeout: time.Hour, Clock: clock}).(*zapLogger)
+	r := routerOf(t, l)
+	l.Info("first", "tenant", "idle")
+	clock.add(40 * time.Minute)
+	l.Info("first", "tenant", "busy")
+	clock.add(30 * time.Minute)
+
+	r.evictIdle(time.Hour)
+	if open := openRoutes(r); len(open) != 1 || open[0] != "busy" {
+		t.Fatalf("open routes = %v, want only busy", open)
+	}
+	l.Info("second", "tenant", "idle")
+	l.Close()
+
+	out := readRecords(t, filepath.Join(dir, "app-idle.log"))
+	for _, want := range []string{"first", "second"} {
+		if !strings.Contains(out, `"msg":"`+want+`"`) {
+			t.Errorf("%s lost after the sink was reopened:\n%s", want, out)
+		}
+	}
+}
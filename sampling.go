@@ -0,0 +1,132 @@
+package log
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultSampleTick       = time.Second
+	defaultSampleFirst      = 100
+	defaultSampleThereafter = 100
+)
+
+// SampleKeyFunc returns the sampling key of a record from its fields, e.g.
+// a user or tenant ID. It is called with the fields of every record and of
+// every With; ok is false when fields don't carry the key.
+type SampleKeyFunc func(ent zapcore.Entry, fields []zapcore.Field) (key string, ok bool)
+
+// SampleByField returns a SampleKeyFunc keying records by the string form
+// of the field named field.
+func SampleByField(field string) SampleKeyFunc {
+	return func(_ zapcore.Entry, fields []zapcore.Field) (string, bool) {
+		return fieldValue(fields, field)
+	}
+}
+
+// SampleByMessage is a SampleKeyFunc keying records by their message, as
+// zap's production sampling does, so a message logged in a hot loop can't
+// crowd out the others.
+func SampleByMessage(ent zapcore.Entry, _ []zapcore.Field) (string, bool) {
+	return ent.Message, ent.Message != ""
+}
+
+// keyedSampler counts the records of each level and key in the current
+// tick. The counts are reset as a whole every tick, which also forgets the
+// keys not seen anymore.
+type keyedSampler struct {
+	tick       time.Duration
+	first      uint64
+	thereafter uint64
+	clock      zapcore.Clock
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[sampleKey]uint64
+}
+
+type sampleKey struct {
+	level zapcore.Level
+	key   string
+}
+
+func newKeyedSampler(config *Config) *keyedSampler {
+	s := &keyedSampler{
+		tick:       config.SampleTick,
+		first:      defaultSampleFirst,
+		thereafter: defaultSampleThereafter,
+		clock:      config.Clock,
+		counts:     make(map[sampleKey]uint64),
+	}
+	if s.tick <= 0 {
+		s.tick = defaultSampleTick
+	}
+	if config.SampleFirst != 0 {
+		s.first = uint64(max(config.SampleFirst, 0))
+	}
+	if config.SampleThereafter != 0 {
+		s.thereafter = uint64(max(config.SampleThereafter, 0))
+	}
+	if s.clock == nil {
+		s.clock = zapcore.DefaultClock
+	}
+	return s
+}
+
+// allow reports whether the record of lvl and key is kept: the first
+// SampleFirst records of each level and key in a tick, then every
+// SampleThereafter-th one.
+func (s *keyedSampler) allow(lvl zapcore.Level, key string) bool {
+	now := s.clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.start) >= s.tick || now.Before(s.start) {
+		s.start = now
+		clear(s.counts)
+	}
+	k := sampleKey{level: lvl, key: key}
+	n := s.counts[k] + 1
+	s.counts[k] = n
+	if n <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
+
+// samplingCore drops records over the sampling budget of their key, so one
+// hot key can't take the budget of all others. The key bound through With
+// applies unless the record carries its own.
+type samplingCore struct {
+	zapcore.Core
+	sampler *keyedSampler
+	keyOf   SampleKeyFunc
+	key     string
+}
+
+func (c *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &samplingCore{Core: c.Core.With(fields), sampler: c.sampler, keyOf: c.keyOf, key: c.key}
+	if k, ok := c.keyOf(zapcore.Entry{}, fields); ok {
+		clone.key = k
+	}
+	return clone
+}
+
+func (c *samplingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *samplingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	key := c.key
+	if k, ok := c.keyOf(ent, fields); ok {
+		key = k
+	}
+	if !c.sampler.allow(ent.Level, key) {
+		return nil
+	}
+	return c.Core.Write(ent, fields)
+}
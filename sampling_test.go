@@ -0,0 +1,66 @@
+package log
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// countBy returns the number of records per value of key.
+func countBy(records []map[string]interface{}, key string) map[interface{}]int {
+	counts := map[interface{}]int{}
+	for _, rec := range records {
+		counts[rec[key]]++
+	}
+	return counts
+}
+
+func TestSampleField(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	clock := &steppedClock{now: time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)}
+	l := New(&Config{Output: OutputMmap, Filename: filename, SampleField: "user", SampleFirst: 2, SampleThereafter: 3, Clock: clock}).(*zapLogger)
+	for i := 0; i < 10; i++ {
+		l.Info("request", "user", "hot")
+	}
+	l.Info("request", "user", "cold")
+	l.Info("request", "user", "cold")
+	bound := l.Child("user", "bound")
+	for i := 0; i < 3; i++ {
+		bound.Info("request")
+	}
+	clock.add(time.Second) // a new tick resets the counts
+	l.Info("request", "user", "hot")
+	l.Close()
+
+	counts := countBy(decodeRecords(t, filename), "user")
+	want := map[interface{}]int{
+		"hot":   5, // 1, 2, 5 and 8 of the first tick, 1 of the next
+		"cold":  2,
+		"bound": 2,
+	}
+	for user, n := range want {
+		if counts[user] != n {
+			t.Errorf("%v: %d records kept, want %d (all: %v)", user, counts[user], n, counts)
+		}
+	}
+}
+
+func TestSampleKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	byMessage := func(ent zapcore.Entry, _ []zapcore.Field) (string, bool) {
+		return ent.Message, ent.Message != ""
+	}
+	l := New(&Config{Output: OutputMmap, Filename: filename, SampleKey: byMessage, SampleFirst: 1, SampleThereafter: -1})
+	for i := 0; i < 5; i++ {
+		l.Info("noisy")
+		l.Info("rare")
+	}
+	l.Close()
+
+	counts := countBy(decodeRecords(t, filename), "msg")
+	if counts["noisy"] != 1 || counts["rare"] != 1 {
+		t.Fatalf("records kept per message = %v, want one each", counts)
+	}
+}
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSequenceAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	var seqs []float64
+	for run := 0; run < 2; run++ {
+		l := New(&Config{Output: OutputMmap, Filename: filename, Sequence: true})
+		l.Info("first")
+		l.Info("second")
+		l.Close()
+	}
+	for _, rec := range decodeRecords(t, filename) {
+		seqs = append(seqs, rec[sequenceKey].(float64))
+	}
+	for i, seq := range seqs {
+		if seq != float64(i) {
+			t.Fatalf("sequence %v, want 0 to 3 without a gap after a clean restart", seqs)
+		}
+	}
+}
+
+func TestSequenceAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log.seq")
+	s, err := newSequencer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := s.take(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// no Close: the process crashed
+	s, err = newSequencer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.take()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != sequenceBlock {
+		t.Fatalf("sequence resumed at %d after a crash, want past the reserved block at %d", n, sequenceBlock)
+	}
+}
@@ -0,0 +1,42 @@
+package shipper
+
+import (
+	"time"
+)
+
+// BatchPolicy tunes the batches a Shipper sends to a Sink, trading
+// throughput for end-to-end latency. The network sinks embed it, so it is
+// set per sink; other Sinks opt in by embedding it as well. A batch is
+// sent once it reaches MaxBatchRecords or MaxBatchBytes, or MaxLinger
+// after its first record was read, whichever comes first.
+type BatchPolicy struct {
+	MaxBatchRecords int           // MaxBatchRecords is the maximum number of records per batch, defaults to Shipper.BatchSize.
+	MaxBatchBytes   int           // MaxBatchBytes caps the uncompressed size of a batch, defaults to 1MiB. A larger record is sent alone.
+	MaxLinger       time.Duration // MaxLinger is how long a batch may wait to fill up, defaults to 0: records are sent as soon as they are read.
+}
+
+// Batching returns p. It lets the Shipper find the policy of a Sink
+// embedding BatchPolicy.
+func (p BatchPolicy) Batching() BatchPolicy {
+	return p
+}
+
+// Batcher is implemented by Sinks embedding BatchPolicy.
+type Batcher interface {
+	Batching() BatchPolicy
+}
+
+// batchPolicy returns the Sink's batch policy with the defaults applied.
+func (s *Shipper) batchPolicy() BatchPolicy {
+	var p BatchPolicy
+	if b, ok := s.Sink.(Batcher); ok {
+		p = b.Batching()
+	}
+	if p.MaxBatchRecords <= 0 {
+		p.MaxBatchRecords = s.batchSize()
+	}
+	if p.MaxBatchBytes <= 0 {
+		p.MaxBatchBytes = 1 << 20
+	}
+	return p
+}
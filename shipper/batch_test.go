@@ -0,0 +1,130 @@
+package shipper
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+)
+
+// countingSink records the size of every batch and stops the shipper once
+// total records arrived.
+type countingSink struct {
+	BatchPolicy
+
+	mu      sync.Mutex
+	batches []int
+	total   int
+	sent    int
+	cancel  context.CancelFunc
+}
+
+func (s *countingSink) Send(ctx context.Context, records [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, len(records))
+	if s.sent += len(records); s.sent >= s.total {
+		s.cancel()
+	}
+	return nil
+}
+
+func writeRecords(tb testing.TB, l *logger.MMapLogger, n, size int) {
+	record := strings.Repeat("x", size-1) + "\n"
+	for i := 0; i < n; i++ {
+		if _, err := l.Write([]byte(record)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestBatchPolicyLimits(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := &logger.MMapLogger{Filename: filename}
+	defer l.Close()
+	writeRecords(t, l, 100, 100)
+
+	tests := []struct {
+		policy    BatchPolicy
+		batches   int
+		maxRecord int
+	}{
+		{BatchPolicy{}, 1, 100},
+		{BatchPolicy{MaxBatchRecords: 30}, 4, 30},
+		{BatchPolicy{MaxBatchBytes: 1000}, 10, 10},
+		{BatchPolicy{MaxBatchBytes: 10}, 100, 1}, // records larger than the limit go alone
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		sink := &countingSink{BatchPolicy: tt.policy, total: 100, cancel: cancel}
+		s := &Shipper{Filename: filename, CursorFile: filepath.Join(t.TempDir(), "cursor"), Sink: sink, PollInterval: time.Millisecond}
+		if err := s.Run(ctx); err != context.Canceled {
+			t.Fatalf("%+v: Run = %v", tt.policy, err)
+		}
+		cancel()
+		if len(sink.batches) != tt.batches {
+			t.Errorf("%+v: %d batches, want %d", tt.policy, len(sink.batches), tt.batches)
+		}
+		for i, n := range sink.batches {
+			if n > tt.maxRecord {
+				t.Errorf("%+v: batch %d has %d records, want at most %d", tt.policy, i, n, tt.maxRecord)
+			}
+		}
+	}
+}
+
+func TestBatchPolicyLinger(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := &logger.MMapLogger{Filename: filename}
+	defer l.Close()
+	writeRecords(t, l, 5, 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sink := &countingSink{BatchPolicy: BatchPolicy{MaxLinger: 200 * time.Millisecond}, total: 10, cancel: cancel}
+	s := &Shipper{Filename: filename, Sink: sink, PollInterval: time.Millisecond}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		writeRecords(t, l, 5, 10)
+	}()
+	if err := s.Run(ctx); err != context.Canceled {
+		t.Fatalf("Run = %v", err)
+	}
+	if len(sink.batches) != 1 {
+		t.Fatalf("batches %v, want the lingering batch to collect all 10 records", sink.batches)
+	}
+}
+
+// BenchmarkShipperBatching ships 10k records of 200 bytes, comparing the
+// throughput of batch sizes.
+func BenchmarkShipperBatching(b *testing.B) {
+	const total, size = 10000, 200
+	filename := filepath.Join(b.TempDir(), "app.log")
+	l := &logger.MMapLogger{Filename: filename}
+	defer l.Close()
+	writeRecords(b, l, total, size)
+
+	for _, policy := range []BatchPolicy{
+		{MaxBatchRecords: 10},
+		{MaxBatchRecords: 100},
+		{},
+		{MaxBatchRecords: 5000, MaxBatchBytes: 4 << 20},
+	} {
+		b.Run(fmt.Sprintf("records=%d/bytes=%d", policy.MaxBatchRecords, policy.MaxBatchBytes), func(b *testing.B) {
+			b.SetBytes(total * size)
+			for i := 0; i < b.N; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				sink := &countingSink{BatchPolicy: policy, total: total, cancel: cancel}
+				s := &Shipper{Filename: filename, CursorFile: filepath.Join(b.TempDir(), "cursor"), Sink: sink}
+				if err := s.Run(ctx); err != context.Canceled {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
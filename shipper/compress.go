@@ -0,0 +1,85 @@
+package shipper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sync/atomic"
+)
+
+// Codec compresses the batches of a network sink, trading CPU for
+// bandwidth. Gzip is built in; snappy and zstd plug in by wrapping their
+// library, e.g. for github.com/klauspost/compress/zstd:
+//
+//	type zstdCodec struct{ enc *zstd.Encoder }
+//
+//	func (zstdCodec) Name() string { return "zstd" }
+//	func (c zstdCodec) Compress(dst, src []byte) ([]byte, error) { return c.enc.EncodeAll(src, dst), nil }
+type Codec interface {
+	// Name is sent as the Content-Encoding of HTTP sinks, e.g. "gzip",
+	// "snappy" or "zstd".
+	Name() string
+	// Compress appends src compressed as a single self-contained frame
+	// to dst. Frames must be concatenable into one stream, as gzip
+	// members, zstd frames and framed snappy chunks are.
+	Compress(dst, src []byte) ([]byte, error)
+}
+
+// GzipCodec compresses with gzip at Level, defaulting to
+// gzip.DefaultCompression.
+type GzipCodec struct {
+	Level int
+}
+
+// Gzip is a GzipCodec at the default level.
+var Gzip Codec = GzipCodec{}
+
+func (GzipCodec) Name() string { return "gzip" }
+
+func (c GzipCodec) Compress(dst, src []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	buf := bytes.NewBuffer(dst)
+	zw, err := gzip.NewWriterLevel(buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(src); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ByteCounter is implemented by Sinks counting the bytes they delivered.
+// The Shipper reports the counts in Stats.
+type ByteCounter interface {
+	// Bytes returns the delivered bytes before and after compression;
+	// they are equal without a Codec.
+	Bytes() (raw, compressed uint64)
+}
+
+// byteCount counts the bytes delivered by a sink.
+type byteCount struct {
+	raw, compressed atomic.Uint64
+}
+
+func (c *byteCount) add(raw, compressed int) {
+	c.raw.Add(uint64(raw))
+	c.compressed.Add(uint64(compressed))
+}
+
+func (c *byteCount) Bytes() (raw, compressed uint64) {
+	return c.raw.Load(), c.compressed.Load()
+}
+
+// compress returns b compressed with codec, or b itself if codec is nil.
+func compress(codec Codec, b []byte) ([]byte, error) {
+	if codec == nil {
+		return b, nil
+	}
+	return codec.Compress(nil, b)
+}
@@ -0,0 +1,91 @@
+package shipper
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTCPSinkGzip(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		zr, err := gzip.NewReader(conn) // the batches form one multi-member stream
+		if err != nil {
+			return
+		}
+		data, _ := io.ReadAll(zr)
+		received <- string(data)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	record := []byte(strings.Repeat("compressible ", 20))
+	sink := &TCPSink{Addr: ln.Addr().String(), Codec: Gzip}
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(ctx, [][]byte{record, record}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw, compressed := sink.Bytes()
+	sink.Close()
+
+	want := strings.Repeat(string(record)+"\n", 4)
+	if got := <-received; got != want {
+		t.Fatalf("server decompressed %d bytes, want the %d of both batches", len(got), len(want))
+	}
+	if raw != uint64(len(want)) || compressed == 0 || compressed >= raw {
+		t.Fatalf("Bytes() = %d raw, %d compressed, want %d raw compressed to less", raw, compressed, len(want))
+	}
+}
+
+func TestLokiSinkGzip(t *testing.T) {
+	pushed := make(chan lokiPush, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "not gzip", http.StatusUnsupportedMediaType)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var push lokiPush
+		if err := json.NewDecoder(zr).Decode(&push); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pushed <- push
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink := &LokiSink{URL: srv.URL, Labels: map[string]string{"job": "app"}, Codec: GzipCodec{Level: gzip.BestCompression}}
+	if err := sink.Send(context.Background(), [][]byte{[]byte("first"), []byte("second")}); err != nil {
+		t.Fatal(err)
+	}
+	push := <-pushed
+	if len(push.Streams) != 1 || len(push.Streams[0].Values) != 2 || push.Streams[0].Values[1][1] != "second" {
+		t.Fatalf("server decoded %+v", push)
+	}
+	if raw, compressed := sink.Bytes(); raw == 0 || compressed == 0 || raw == compressed {
+		t.Fatalf("Bytes() = %d raw, %d compressed, want both counted", raw, compressed)
+	}
+}
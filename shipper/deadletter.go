@@ -0,0 +1,163 @@
+package shipper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// permanentError marks a batch the remote rejected for good.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err, returned by a Sink, as a permanent rejection of the
+// batch, e.g. a 4xx response or a schema error: sending it again cannot
+// succeed. The Shipper writes the batch to its dead-letter file instead of
+// retrying it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked by Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// DeadLetter is a record a Sink rejected permanently, stored as one JSON
+// object per line in the dead-letter file.
+type DeadLetter struct {
+	Time   time.Time `json:"time"`   // Time is when the record was rejected.
+	Reason string    `json:"reason"` // Reason is the error the Sink returned.
+	Key    string    `json:"key"`    // Key is the delivery key of the record, see Record.
+	Record string    `json:"record"`
+}
+
+// appendDeadLetters appends letters to the dead-letter file name and syncs
+// it, so the rejected records survive the cursor moving past them.
+func appendDeadLetters(name string, letters []DeadLetter) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, l := range letters {
+		if err := enc.Encode(l); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// deadLetters returns records as dead letters rejected with reason.
+func deadLetters(records []Record, reason error) []DeadLetter {
+	now := time.Now()
+	letters := make([]DeadLetter, len(records))
+	for i, r := range records {
+		letters[i] = DeadLetter{Time: now, Reason: reason.Error(), Key: r.Key, Record: string(r.Data)}
+	}
+	return letters
+}
+
+// ReadDeadLetters returns the records of the dead-letter file name.
+func ReadDeadLetters(name string) ([]DeadLetter, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var letters []DeadLetter
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var l DeadLetter
+		if err := dec.Decode(&l); err != nil {
+			return letters, fmt.Errorf("shipper: dead-letter file %s: %w", name, err)
+		}
+		letters = append(letters, l)
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters sends the records of the dead-letter file name to sink
+// in batches of batchSize, e.g. after the cause of the rejection was fixed,
+// and returns how many were delivered. Records rejected permanently again
+// are put back with the new reason; after any other error the records not
+// delivered yet are put back and the error is returned. A Shipper may keep
+// appending to name meanwhile: the file is moved to name + ".replay" while
+// it is replayed, and an interrupted replay is resumed from there.
+func ReplayDeadLetters(ctx context.Context, name string, sink Sink, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	replay := name + ".replay"
+	if _, err := os.Stat(replay); os.IsNotExist(err) {
+		if err := os.Rename(name, replay); err != nil {
+			return 0, err
+		}
+	}
+	letters, err := ReadDeadLetters(replay)
+	if err != nil {
+		return 0, err
+	}
+	var kept []DeadLetter
+	var failed error
+	sent := 0
+	for len(letters) > 0 {
+		n := min(batchSize, len(letters))
+		batch := make([]Record, n)
+		for i, l := range letters[:n] {
+			batch[i] = Record{Key: l.Key, Data: []byte(l.Record)}
+		}
+		if rs, ok := sink.(RecordSink); ok {
+			err = rs.SendRecords(ctx, batch)
+		} else {
+			records := make([][]byte, n)
+			for i, r := range batch {
+				records[i] = r.Data
+			}
+			err = sink.Send(ctx, records)
+		}
+		if err != nil && !IsPermanent(err) {
+			failed = err
+			kept = append(kept, letters...)
+			break
+		}
+		if err != nil {
+			kept = append(kept, deadLetters(batch, err)...)
+		} else {
+			sent += n
+		}
+		letters = letters[n:]
+	}
+	if len(kept) > 0 {
+		if err := appendDeadLetters(name, kept); err != nil {
+			return sent, err
+		}
+	}
+	if err := os.Remove(replay); err != nil {
+		return sent, err
+	}
+	return sent, failed
+}
@@ -0,0 +1,92 @@
+package shipper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+)
+
+// rejectingSink rejects every batch containing a record with "bad" for
+// good and stops the shipper once total records were handled.
+type rejectingSink struct {
+	countingSink
+}
+
+func (s *rejectingSink) Send(ctx context.Context, records [][]byte) error {
+	for _, r := range records {
+		if strings.Contains(string(r), "bad") {
+			s.mu.Lock()
+			if s.sent += len(records); s.sent >= s.total {
+				s.cancel()
+			}
+			s.mu.Unlock()
+			return Permanent(errors.New("schema error"))
+		}
+	}
+	return s.countingSink.Send(ctx, records)
+}
+
+func TestDeadLetterAndReplay(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := &logger.MMapLogger{Filename: filename}
+	defer l.Close()
+	for _, r := range []string{"good 1\n", "bad 2\n", "good 3\n"} {
+		if _, err := l.Write([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sink := &rejectingSink{countingSink{total: 3, cancel: cancel}}
+	s := &Shipper{Filename: filename, Sink: sink, PollInterval: time.Millisecond, BatchSize: 1}
+	if err := s.Run(ctx); err != context.Canceled {
+		t.Fatalf("Run = %v", err)
+	}
+	if stats := s.Stats(); stats.DeadLetters != 1 || stats.State != BreakerClosed {
+		t.Fatalf("stats %+v, want 1 dead letter and a closed breaker", stats)
+	}
+	letters, err := ReadDeadLetters(s.DeadLetterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].Record != "bad 2" || letters[0].Reason != "schema error" || letters[0].Key == "" {
+		t.Fatalf("dead letters %+v", letters)
+	}
+
+	replayed := &countingSink{total: 1 << 30, cancel: func() {}}
+	if n, err := ReplayDeadLetters(context.Background(), s.DeadLetterFile, replayed, 0); n != 1 || err != nil {
+		t.Fatalf("ReplayDeadLetters = %d, %v", n, err)
+	}
+	if _, err := os.Stat(s.DeadLetterFile); !os.IsNotExist(err) {
+		t.Fatalf("dead-letter file left after a complete replay: %v", err)
+	}
+}
+
+func TestLokiSinkPermanentErrors(t *testing.T) {
+	for _, tt := range []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusServiceUnavailable, false},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "entry too far behind", tt.status)
+		}))
+		err := (&LokiSink{URL: srv.URL}).Send(context.Background(), [][]byte{[]byte("x")})
+		srv.Close()
+		if err == nil || IsPermanent(err) != tt.permanent {
+			t.Errorf("status %d: err = %v, permanent %t", tt.status, err, IsPermanent(err))
+		}
+	}
+}
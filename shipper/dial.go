@@ -0,0 +1,233 @@
+package shipper
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Dialer dials the connections of the network sinks. *net.Dialer, the
+// dialers of golang.org/x/net/proxy and ProxyDialer implement it.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// ProxyDialer returns a Dialer connecting through the proxy at proxyURL,
+// "socks5://[user:password@]host:port" or "http://[user:password@]host:port"
+// for an HTTP CONNECT proxy, so logs can be shipped through an approved
+// egress path. forward dials the proxy itself, nil means a net.Dialer.
+func ProxyDialer(proxyURL string, forward Dialer) (Dialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("shipper: invalid proxy URL: %w", err)
+	}
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		return &socks5Dialer{proxy: u.Host, user: u.User, forward: forward}, nil
+	case "http":
+		return &connectDialer{proxy: u.Host, user: u.User, forward: forward}, nil
+	}
+	return nil, fmt.Errorf("shipper: unsupported proxy scheme %q", u.Scheme)
+}
+
+// handshakeTimeout bounds a proxy handshake when ctx has no earlier
+// deadline, so a proxy that accepts but never answers can't hang the sink.
+var handshakeTimeout = 30 * time.Second
+
+// handshake runs fn on conn with a deadline of ctx's deadline or
+// handshakeTimeout, whichever comes first, closing conn if it fails.
+// Canceling ctx interrupts fn.
+func handshake(ctx context.Context, conn net.Conn, fn func() error) (net.Conn, error) {
+	deadline := time.Now().Add(handshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	err := fn()
+	if !stop() && err == nil {
+		err = ctx.Err() // canceled just as fn finished, the deadline may be set
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// connectDialer tunnels connections through an HTTP proxy with CONNECT.
+type connectDialer struct {
+	proxy   string
+	user    *url.Userinfo
+	forward Dialer
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.forward.DialContext(ctx, "tcp", d.proxy)
+	if err != nil {
+		return nil, err
+	}
+	var br *bufio.Reader
+	conn, err = handshake(ctx, conn, func() error {
+		req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: make(http.Header)}
+		if d.user != nil {
+			password, _ := d.user.Password()
+			req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(d.user.Username()+":"+password)))
+		}
+		if err := req.Write(conn); err != nil {
+			return err
+		}
+		br = bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("shipper: proxy CONNECT %s: %s", addr, resp.Status)
+		}
+		return nil // the tunnel follows the headers, so the body is never read
+	})
+	if err != nil {
+		return nil, err
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn returns the bytes read ahead while parsing the proxy's
+// response before reading from the connection again.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// socks5Dialer connects through a SOCKS5 proxy (RFC 1928), with optional
+// username/password authentication (RFC 1929). Host names are resolved by
+// the proxy.
+type socks5Dialer struct {
+	proxy   string
+	user    *url.Userinfo
+	forward Dialer
+}
+
+func (d *socks5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("shipper: invalid port in %s", addr)
+	}
+	conn, err := d.forward.DialContext(ctx, "tcp", d.proxy)
+	if err != nil {
+		return nil, err
+	}
+	return handshake(ctx, conn, func() error {
+		if err := d.authenticate(conn); err != nil {
+			return err
+		}
+		req := []byte{5, 1, 0} // version, CONNECT, reserved
+		if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+			req = append(append(req, 1), ip.To4()...)
+		} else if ip != nil {
+			req = append(append(req, 4), ip.To16()...)
+		} else {
+			if len(host) > 255 {
+				return fmt.Errorf("shipper: host name too long: %s", host)
+			}
+			req = append(append(req, 3, byte(len(host))), host...)
+		}
+		req = binary.BigEndian.AppendUint16(req, uint16(port))
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		reply := make([]byte, 4)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return fmt.Errorf("shipper: socks5 connect %s failed with code %d", addr, reply[1])
+		}
+		var skip int
+		switch reply[3] {
+		case 1:
+			skip = net.IPv4len
+		case 4:
+			skip = net.IPv6len
+		case 3:
+			n := make([]byte, 1)
+			if _, err := io.ReadFull(conn, n); err != nil {
+				return err
+			}
+			skip = int(n[0])
+		default:
+			return errors.New("shipper: socks5 reply with unknown address type")
+		}
+		_, err := io.ReadFull(conn, make([]byte, skip+2)) // bound address and port
+		return err
+	})
+}
+
+// authenticate negotiates the authentication method with the proxy.
+func (d *socks5Dialer) authenticate(conn net.Conn) error {
+	methods := []byte{5, 1, 0} // no authentication
+	if d.user != nil {
+		methods = []byte{5, 2, 0, 2} // or username/password
+	}
+	if _, err := conn.Write(methods); err != nil {
+		return err
+	}
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	switch {
+	case resp[0] != 5:
+		return errors.New("shipper: not a socks5 proxy")
+	case resp[1] == 0:
+		return nil
+	case resp[1] != 2 || d.user == nil:
+		return errors.New("shipper: socks5 proxy accepts none of the offered authentication methods")
+	}
+	user := d.user.Username()
+	password, _ := d.user.Password()
+	if len(user) > 255 || len(password) > 255 {
+		return errors.New("shipper: socks5 credentials too long")
+	}
+	req := append([]byte{1, byte(len(user))}, user...)
+	req = append(append(req, byte(len(password))), password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[1] != 0 {
+		return errors.New("shipper: socks5 authentication failed")
+	}
+	return nil
+}
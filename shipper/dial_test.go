@@ -0,0 +1,170 @@
+package shipper
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeProxy accepts connections on a local port and hands each to serve.
+func fakeProxy(t *testing.T, serve func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// roundTrip writes ping through conn and expects the fake target to echo it.
+func roundTrip(t *testing.T, conn net.Conn) {
+	t.Helper()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("read %q, %v through the tunnel, want the echo", buf, err)
+	}
+}
+
+func TestSocks5Dialer(t *testing.T) {
+	targets := make(chan string, 1)
+	proxy := fakeProxy(t, func(conn net.Conn) {
+		buf := make([]byte, 512)
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil { // version, 2 methods, none and username/password
+			return
+		}
+		conn.Write([]byte{5, 2})
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		user := make([]byte, buf[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, buf[:1])
+		password := make([]byte, buf[0])
+		io.ReadFull(conn, password)
+		if string(user) != "shipper" || string(password) != "secret" {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+		if _, err := io.ReadFull(conn, buf[:5]); err != nil { // version, CONNECT, reserved, type, host length
+			return
+		}
+		host := make([]byte, buf[4]+2)
+		io.ReadFull(conn, host)
+		targets <- string(host[:len(host)-2])
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 80})
+		io.Copy(conn, conn) // echo as the target
+	})
+	d, err := ProxyDialer("socks5://shipper:secret@"+proxy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", "logs.example.com:514")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	roundTrip(t, conn)
+	if target := <-targets; target != "logs.example.com" {
+		t.Fatalf("proxy was asked for %q", target)
+	}
+
+	d, _ = ProxyDialer("socks5://shipper:wrong@"+proxy, nil)
+	if _, err := d.DialContext(context.Background(), "tcp", "logs.example.com:514"); err == nil {
+		t.Fatal("dial with wrong credentials succeeded")
+	}
+}
+
+func TestConnectDialer(t *testing.T) {
+	proxy := fakeProxy(t, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		if req.Method != http.MethodConnect || req.Host != "logs.example.com:514" {
+			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			return
+		}
+		if user, password, ok := parseProxyAuth(req); !ok || user != "shipper" || password != "secret" {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		io.Copy(conn, br)
+	})
+	d, err := ProxyDialer("http://shipper:secret@"+proxy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", "logs.example.com:514")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	roundTrip(t, conn)
+
+	d, _ = ProxyDialer("http://"+proxy, nil)
+	if _, err := d.DialContext(context.Background(), "tcp", "logs.example.com:514"); err == nil {
+		t.Fatal("dial without credentials succeeded")
+	}
+}
+
+// parseProxyAuth reads the Basic credentials of Proxy-Authorization.
+func parseProxyAuth(req *http.Request) (user, password string, ok bool) {
+	r := &http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}
+	return r.BasicAuth()
+}
+
+func TestProxyHandshakeTimeout(t *testing.T) {
+	defer func(d time.Duration) { handshakeTimeout = d }(handshakeTimeout)
+	handshakeTimeout = 100 * time.Millisecond
+
+	silent := fakeProxy(t, func(conn net.Conn) { // accepts, then never answers
+		io.Copy(io.Discard, conn)
+	})
+	for _, scheme := range []string{"socks5", "http"} {
+		d, err := ProxyDialer(scheme+"://"+silent, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		_, err = d.DialContext(context.Background(), "tcp", "logs.example.com:514")
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("%s: dial through a silent proxy = %v, want a deadline error", scheme, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("%s: handshake took %v", scheme, elapsed)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		handshakeTimeout = time.Minute
+		if _, err := d.DialContext(ctx, "tcp", "logs.example.com:514"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: canceled dial = %v, want context.Canceled", scheme, err)
+		}
+		handshakeTimeout = 100 * time.Millisecond
+	}
+}
@@ -0,0 +1,119 @@
+package shipper
+
+import (
+	"time"
+)
+
+// BreakerState is the state of the Shipper's circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed means sends go through normally.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen means the remote failed BreakerThreshold sends in a row;
+	// no sends are attempted until BreakerTimeout has passed. Records
+	// keep accumulating in the local files meanwhile.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen means a single trial send decides whether the
+	// breaker closes again or stays open for another BreakerTimeout.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// Stats reports the health of a Shipper.
+type Stats struct {
+	State       BreakerState // State is the circuit breaker state.
+	Failures    int          // Failures is the number of consecutive failed sends.
+	Sent        uint64       // Sent is the number of records delivered.
+	FailedSends uint64       // FailedSends is the total number of failed sends.
+	DeadLetters uint64       // DeadLetters is the number of records the Sink rejected permanently, see Shipper.DeadLetterFile.
+	LastError   string       // LastError is the error of the last failed send.
+	LastSuccess time.Time    // LastSuccess is when a send last succeeded.
+	File        string       // File is the file being shipped.
+	Offset      int64        // Offset is the committed position in File.
+
+	// RawBytes and CompressedBytes are the bytes the Sink delivered before
+	// and after compression, if it is a ByteCounter.
+	RawBytes        uint64
+	CompressedBytes uint64
+}
+
+// Stats returns a snapshot of the Shipper's health.
+func (s *Shipper) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	if stats.State == "" {
+		stats.State = BreakerClosed
+	}
+	if bc, ok := s.Sink.(ByteCounter); ok {
+		stats.RawBytes, stats.CompressedBytes = bc.Bytes()
+	}
+	return stats
+}
+
+// breakerWait returns how long to wait before the next send is allowed,
+// moving an open breaker whose timeout passed to half-open.
+func (s *Shipper) breakerWait() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.State != BreakerOpen {
+		return 0
+	}
+	if wait := time.Until(s.openedAt.Add(s.breakerTimeout())); wait > 0 {
+		return wait
+	}
+	s.stats.State = BreakerHalfOpen
+	return 0
+}
+
+// recordSend updates the stats and the breaker after a send of n records.
+func (s *Shipper) recordSend(n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.stats.State = BreakerClosed
+		s.stats.Failures = 0
+		s.stats.Sent += uint64(n)
+		s.stats.LastSuccess = time.Now()
+		return
+	}
+	s.stats.Failures++
+	s.stats.FailedSends++
+	s.stats.LastError = err.Error()
+	if s.stats.State == BreakerHalfOpen || s.stats.Failures >= s.breakerThreshold() {
+		s.stats.State = BreakerOpen
+		s.openedAt = time.Now()
+	}
+}
+
+// recordDeadLetters counts n records written to the dead-letter file. The
+// remote answered, so the breaker closes as after a successful send.
+func (s *Shipper) recordDeadLetters(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.State = BreakerClosed
+	s.stats.Failures = 0
+	s.stats.DeadLetters += uint64(n)
+}
+
+// recordPosition records the committed position.
+func (s *Shipper) recordPosition(file string, offset int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.File = file
+	s.stats.Offset = offset
+}
+
+func (s *Shipper) breakerThreshold() int {
+	if s.BreakerThreshold > 0 {
+		return s.BreakerThreshold
+	}
+	return 5
+}
+
+func (s *Shipper) breakerTimeout() time.Duration {
+	if s.BreakerTimeout > 0 {
+		return s.BreakerTimeout
+	}
+	return time.Minute
+}
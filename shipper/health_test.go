@@ -0,0 +1,100 @@
+package shipper
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+)
+
+// downSink fails every send while down is set.
+type downSink struct {
+	mu    sync.Mutex
+	down  bool
+	calls int
+}
+
+func (s *downSink) Send(ctx context.Context, records [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.down {
+		return errors.New("remote down")
+	}
+	return nil
+}
+
+func (s *downSink) sends() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// waitStats polls s.Stats until cond holds.
+func waitStats(t *testing.T, s *Shipper, cond func(Stats) bool) Stats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := s.Stats()
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats stuck at %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := &logger.MMapLogger{Filename: filename}
+	defer l.Close()
+	writeRecords(t, l, 10, 10)
+
+	sink := &downSink{down: true}
+	const timeout = 300 * time.Millisecond
+	s := &Shipper{
+		Filename:         filename,
+		Sink:             sink,
+		PollInterval:     time.Millisecond,
+		MinBackoff:       time.Millisecond,
+		MaxBackoff:       time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerTimeout:   timeout,
+		OnError:          func(error) {},
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop(context.Background())
+
+	stats := waitStats(t, s, func(st Stats) bool { return st.State == BreakerOpen })
+	if stats.Failures != 2 || stats.LastError != "remote down" {
+		t.Fatalf("open breaker stats = %+v, want 2 failures and the last error", stats)
+	}
+	opened := sink.sends()
+	time.Sleep(timeout / 3)
+	if calls := sink.sends(); calls != opened {
+		t.Fatalf("%d sends while the breaker was open", calls-opened)
+	}
+	time.Sleep(timeout)
+	if calls := sink.sends(); calls != opened+1 {
+		t.Fatalf("%d sends after the breaker timeout, want a single trial", calls-opened)
+	}
+	if stats := s.Stats(); stats.State != BreakerOpen || stats.Failures != 3 {
+		t.Fatalf("stats after a failed trial = %+v, want the breaker open again", stats)
+	}
+
+	sink.mu.Lock()
+	sink.down = false
+	sink.mu.Unlock()
+	stats = waitStats(t, s, func(st Stats) bool { return st.Sent == 10 })
+	if stats.State != BreakerClosed || stats.Failures != 0 || stats.LastSuccess.IsZero() {
+		t.Fatalf("stats after recovery = %+v, want the breaker closed", stats)
+	}
+}
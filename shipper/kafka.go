@@ -0,0 +1,187 @@
+package shipper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// KeyFunc returns the partition key of a record, or nil to let the
+// producer choose the partition.
+type KeyFunc func(record []byte) []byte
+
+// FieldKey returns a KeyFunc using the value of the top-level field of a
+// JSON record, e.g. "tenant" or "request_id", as the partition key, so
+// related records land on the same partition in order. Strings are used
+// without their quotes, other values as encoded. The record is scanned in
+// place rather than decoded, as this runs for every shipped record.
+func FieldKey(field string) KeyFunc {
+	return func(record []byte) []byte {
+		i := skipSpace(record, 0)
+		if i >= len(record) || record[i] != '{' {
+			return nil
+		}
+		for i = skipSpace(record, i+1); i < len(record) && record[i] == '"'; {
+			keyEnd, ok := scanString(record, i)
+			if !ok {
+				return nil
+			}
+			key := record[i:keyEnd]
+			i = skipSpace(record, keyEnd)
+			if i >= len(record) || record[i] != ':' {
+				return nil
+			}
+			start := skipSpace(record, i+1)
+			end, ok := scanValue(record, start)
+			if !ok {
+				return nil
+			}
+			if keyMatches(key, field) {
+				return keyValue(record[start:end])
+			}
+			i = skipSpace(record, end)
+			if i >= len(record) || record[i] != ',' {
+				return nil
+			}
+			i = skipSpace(record, i+1)
+		}
+		return nil
+	}
+}
+
+// keyMatches reports whether the quoted JSON string key equals field.
+func keyMatches(key []byte, field string) bool {
+	if bytes.IndexByte(key, '\\') < 0 {
+		return string(key[1:len(key)-1]) == field
+	}
+	var s string
+	return json.Unmarshal(key, &s) == nil && s == field
+}
+
+// keyValue returns value as a partition key, unquoting strings.
+func keyValue(value []byte) []byte {
+	if value[0] != '"' {
+		return value
+	}
+	if bytes.IndexByte(value, '\\') < 0 {
+		return value[1 : len(value)-1]
+	}
+	var s string
+	if json.Unmarshal(value, &s) != nil {
+		return nil
+	}
+	return []byte(s)
+}
+
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// scanString returns the end of the JSON string starting at b[i].
+func scanString(b []byte, i int) (int, bool) {
+	for i++; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// scanValue returns the end of the JSON value starting at b[i].
+func scanValue(b []byte, i int) (int, bool) {
+	if i >= len(b) {
+		return 0, false
+	}
+	switch b[i] {
+	case '"':
+		return scanString(b, i)
+	case '{', '[':
+		depth := 0
+		for ; i < len(b); i++ {
+			switch b[i] {
+			case '"':
+				end, ok := scanString(b, i)
+				if !ok {
+					return 0, false
+				}
+				i = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1, true
+				}
+			}
+		}
+		return 0, false
+	default:
+		start := i
+		for i < len(b) && b[i] != ',' && b[i] != '}' && b[i] != ']' && b[i] != ' ' && b[i] != '\n' {
+			i++
+		}
+		return i, i > start
+	}
+}
+
+// Message is a record as published to Kafka.
+type Message struct {
+	Key      []byte // Key selects the partition, nil leaves it to the producer.
+	Value    []byte
+	DedupKey string // DedupKey is the record's delivery key, see Record.
+}
+
+// Producer publishes messages to Kafka, typically a thin adapter around
+// the client library in use. Produce must deliver all messages or return
+// an error, and preserve their order per key.
+type Producer interface {
+	Produce(ctx context.Context, messages []Message) error
+}
+
+// KafkaSink publishes records through a Producer, keying each with Key.
+type KafkaSink struct {
+	Producer Producer
+	Key      KeyFunc // Key extracts the partition key, nil leaves partitioning to the producer.
+	BatchPolicy
+}
+
+func (s *KafkaSink) Send(ctx context.Context, records [][]byte) error {
+	messages := make([]Message, len(records))
+	for i, r := range records {
+		messages[i] = s.message(r)
+	}
+	return s.Producer.Produce(ctx, messages)
+}
+
+// SendRecords is Send with the delivery keys as DedupKey, e.g. for a
+// message header consumers deduplicate by.
+func (s *KafkaSink) SendRecords(ctx context.Context, records []Record) error {
+	messages := make([]Message, len(records))
+	for i, r := range records {
+		messages[i] = s.message(r.Data)
+		messages[i].DedupKey = r.Key
+	}
+	return s.Producer.Produce(ctx, messages)
+}
+
+func (s *KafkaSink) message(record []byte) Message {
+	m := Message{Value: record}
+	if s.Key != nil {
+		m.Key = s.Key(record)
+	}
+	return m
+}
+
+// Close closes the producer if it is an io.Closer.
+func (s *KafkaSink) Close() error {
+	if c, ok := s.Producer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
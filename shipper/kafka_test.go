@@ -0,0 +1,55 @@
+package shipper
+
+import (
+	"context"
+	"testing"
+)
+
+const kafkaRecord = `{"level":"info","time":"2024-03-10T12:00:00.000Z","caller":"api/handler.go:42","msg":"request served","request":{"tenant":"nested"},"tenant":"acme","status":200,"latency":0.0123}`
+
+func TestFieldKey(t *testing.T) {
+	tests := []struct {
+		field, record, want string
+	}{
+		{"tenant", kafkaRecord, "acme"},
+		{"status", kafkaRecord, "200"},
+		{"request", kafkaRecord, `{"tenant":"nested"}`},
+		{"missing", kafkaRecord, ""},
+		{"tenant", "not json", ""},
+		{"tenant", `{ "msg" : "a \"quoted\" {brace}" , "tenant" : "a\u0063me" }`, "acme"},
+		{"ten\"ant", `{"ten\"ant":true}`, "true"},
+		{"tenant", `{"tenant":"acme"`, "acme"},
+		{"tenant", `{"msg":"truncated`, ""},
+	}
+	for _, tt := range tests {
+		if got := string(FieldKey(tt.field)([]byte(tt.record))); got != tt.want {
+			t.Errorf("FieldKey(%q)(%s) = %q, want %q", tt.field, tt.record, got, tt.want)
+		}
+	}
+}
+
+type discardProducer struct{}
+
+func (discardProducer) Produce(context.Context, []Message) error { return nil }
+
+func benchmarkKafkaSink(b *testing.B, sink *KafkaSink) {
+	batch := make([][]byte, 100)
+	for i := range batch {
+		batch[i] = []byte(kafkaRecord)
+	}
+	b.SetBytes(int64(len(kafkaRecord) * len(batch)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := sink.Send(context.Background(), batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkKafkaSinkUnkeyed(b *testing.B) {
+	benchmarkKafkaSink(b, &KafkaSink{Producer: discardProducer{}})
+}
+
+func BenchmarkKafkaSinkFieldKey(b *testing.B) {
+	benchmarkKafkaSink(b, &KafkaSink{Producer: discardProducer{}, Key: FieldKey("tenant")})
+}
@@ -0,0 +1,92 @@
+package shipper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// runner is a Shipper started by Start.
+type runner struct {
+	cancel context.CancelFunc
+	drain  chan struct{} // drain is closed by Stop: ship returns once caught up
+	done   chan struct{} // done is closed when Run returned
+	err    error         // err is what Run returned, set before done is closed
+}
+
+// Name identifies the Shipper by the file it ships, e.g. in the health
+// reports of the logger managing it.
+func (s *Shipper) Name() string {
+	return "shipper " + s.Filename
+}
+
+// Start runs the Shipper in its own goroutine until Stop is called or ctx
+// is done. Together with Stop and Healthy it lets log.Config.Sinks manage
+// the Shipper.
+func (s *Shipper) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != nil && !closed(s.running.done) {
+		return errors.New("shipper: already started")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r := &runner{cancel: cancel, drain: make(chan struct{}), done: make(chan struct{})}
+	s.running = r
+	go func() {
+		defer close(r.done)
+		r.err = s.ship(ctx, r.drain)
+	}()
+	return nil
+}
+
+// Stop ships the records written so far, then stops the Shipper started by
+// Start. If ctx is done first the remaining records are left for the next
+// start and ctx.Err() is returned.
+func (s *Shipper) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	r := s.running
+	if r != nil && !closed(r.drain) {
+		close(r.drain)
+	}
+	s.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+		return ctx.Err()
+	}
+	r.cancel()
+	if r.err != nil && !errors.Is(r.err, context.Canceled) {
+		return r.err
+	}
+	return nil
+}
+
+// Healthy returns nil unless the circuit breaker is not closed or the
+// Shipper started by Start stopped on an error.
+func (s *Shipper) Healthy() error {
+	s.mu.Lock()
+	r := s.running
+	s.mu.Unlock()
+	if r != nil && closed(r.done) && r.err != nil && !errors.Is(r.err, context.Canceled) {
+		return fmt.Errorf("shipper stopped: %w", r.err)
+	}
+	if stats := s.Stats(); stats.State != BreakerClosed {
+		return fmt.Errorf("circuit breaker %s after %d failed sends: %s", stats.State, stats.Failures, stats.LastError)
+	}
+	return nil
+}
+
+// closed reports whether ch is closed; a nil ch never is.
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
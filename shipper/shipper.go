@@ -0,0 +1,359 @@
+// Package shipper tails the files written by the mmap logger and forwards
+// their records to a network Sink such as Loki or a TCP endpoint. It runs
+// in its own goroutine and only reads the files, so a slow or unavailable
+// remote never blocks the application's write path; the local files are
+// the buffer. Progress is committed to a cursor file after every delivered
+// batch, so a restarted Shipper resumes where it stopped, following the
+// files through rotation. Other systems, e.g. Kafka, plug in by
+// implementing Sink. Every Sink gets the same resilience: exponential
+// backoff between retries and a circuit breaker that stops sending to a
+// remote that keeps failing, with the health reported by Stats. While the
+// remote is down records simply stay in the local files and are replayed
+// from the cursor once it recovers. A batch the remote rejects for good,
+// signalled by a Permanent error, goes to a dead-letter file with the
+// reason instead, from where ReplayDeadLetters sends it again.
+//
+// Delivery is at least once: the cursor is committed only after the Sink
+// acknowledged a batch by returning nil, so a crash between the two sends
+// the batch again. Sinks implementing RecordSink receive a key per record,
+// derived from the file's device, inode and the record's offset, which is
+// the same for every delivery of a record and lets the remote drop
+// duplicates.
+//
+// Listed in log.Config.Sinks, a Shipper is started together with the
+// logger and stopped by its Close once the records written until then are
+// delivered; its Healthy state shows up in log.HealthHandler.
+package shipper
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/mmapsyncer"
+)
+
+// Shipper forwards the records of Filename and its backups, compressed or
+// not, to Sink. The zero values of the optional fields select sensible defaults.
+type Shipper struct {
+	Filename   string // Filename is the live log file, as in log.Config.Filename.
+	CursorFile string // CursorFile stores the committed position, defaults to Filename + ".cursor".
+	Sink       Sink
+
+	BatchSize    int           // BatchSize is the maximum number of records per Send unless the Sink's BatchPolicy sets one, defaults to 500.
+	PollInterval time.Duration // PollInterval is how often to look for new records once caught up, defaults to 1s.
+	MinBackoff   time.Duration // MinBackoff is the first retry delay after a failed Send, defaults to 100ms.
+	MaxBackoff   time.Duration // MaxBackoff caps the retry delay, defaults to 30s.
+	OnError      func(error)   // OnError is called with failed sends and lost cursors, defaults to ignoring them.
+
+	BreakerThreshold int           // BreakerThreshold is the number of consecutive failed sends that open the circuit breaker, defaults to 5.
+	BreakerTimeout   time.Duration // BreakerTimeout is how long the breaker stays open before a trial send, defaults to 1m.
+
+	DeadLetterFile string // DeadLetterFile receives the batches the Sink rejects with a Permanent error, defaults to Filename + ".deadletter".
+
+	mu       sync.Mutex // mu guards stats, openedAt and running
+	stats    Stats
+	openedAt time.Time
+	running  *runner
+}
+
+// Run ships records until ctx is done. It returns ctx.Err(), or an error
+// if the cursor cannot be committed.
+func (s *Shipper) Run(ctx context.Context) error {
+	return s.ship(ctx, nil)
+}
+
+// ship is Run, also returning nil once caught up after drain is closed.
+func (s *Shipper) ship(ctx context.Context, drain <-chan struct{}) error {
+	if s.CursorFile == "" {
+		s.CursorFile = s.Filename + ".cursor"
+	}
+	if s.DeadLetterFile == "" {
+		s.DeadLetterFile = s.Filename + ".deadletter"
+	}
+	committed, err := mmapsyncer.LoadCursor(s.CursorFile)
+	if err != nil {
+		return err
+	}
+	pos := s.start(committed)
+	s.recordPosition(pos.File, pos.Offset)
+	policy := s.batchPolicy()
+	var lingerUntil time.Time // lingerUntil is when the partial batch at pos is sent
+	for {
+		records, next, full, info, err := readRecords(pos.File, pos.Offset, policy)
+		if os.IsNotExist(err) && (pos.Dev != 0 || pos.Ino != 0) {
+			// Rotated or compressed away: follow the file to its new name.
+			if renamed, err := pos.Resolve(); err == nil && renamed != pos.File {
+				pos.File = renamed
+				continue
+			}
+		}
+		if err != nil && !os.IsNotExist(err) {
+			s.report(err)
+		}
+		if info != nil {
+			if pos.Dev == 0 && pos.Ino == 0 {
+				pos = mmapsyncer.NewCursor(pos.File, info, pos.Offset)
+			} else if !pos.Matches(pos.File, info) {
+				// The file was rotated away before it was opened again:
+				// finish it under its new name.
+				if renamed, err := pos.Resolve(); err == nil {
+					pos.File = renamed
+				} else {
+					s.report(fmt.Errorf("shipper: follow %s: %w", pos.File, err))
+					pos = mmapsyncer.NewCursor(pos.File, info, 0)
+				}
+				continue
+			}
+		}
+		if len(records) > 0 {
+			// Only the live file grows: let a partial batch read from it
+			// wait for more records until MaxLinger has passed.
+			if !full && policy.MaxLinger > 0 && pos.File == s.Filename && !closed(drain) {
+				if lingerUntil.IsZero() {
+					lingerUntil = time.Now().Add(policy.MaxLinger)
+				}
+				if wait := time.Until(lingerUntil); wait > 0 {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-drain:
+					case <-time.After(min(wait, s.pollInterval())):
+					}
+					continue
+				}
+			}
+			lingerUntil = time.Time{}
+			if err := s.send(ctx, pos, records); err != nil {
+				return err
+			}
+			pos.Offset = next
+			if err := pos.Commit(s.CursorFile); err != nil {
+				return err
+			}
+			s.recordPosition(pos.File, pos.Offset)
+			continue
+		}
+		// Caught up: a backup is complete once renamed, so move on to the
+		// next newer file; the live file is polled for more records.
+		if next := s.nextFile(pos.File); next != "" {
+			pos = mmapsyncer.Cursor{File: next}
+			continue
+		}
+		if closed(drain) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-drain:
+		case <-time.After(s.pollInterval()):
+		}
+	}
+}
+
+// start returns the position to resume from.
+func (s *Shipper) start(committed mmapsyncer.Cursor) mmapsyncer.Cursor {
+	if committed.File != "" {
+		name, err := committed.Resolve()
+		if err == nil {
+			committed.File = name
+			return committed
+		}
+		s.report(fmt.Errorf("shipper: resume from %s: %w", committed.File, err))
+	}
+	if backups := s.backups(); len(backups) > 0 {
+		return mmapsyncer.Cursor{File: backups[0]}
+	}
+	return mmapsyncer.Cursor{File: s.Filename}
+}
+
+// nextFile returns the file to read after name is exhausted, or "" if
+// name is the live file.
+func (s *Shipper) nextFile(name string) string {
+	if name == s.Filename {
+		return ""
+	}
+	for _, b := range s.backups() {
+		if backupKey(b) > backupKey(name) {
+			return b
+		}
+	}
+	return s.Filename
+}
+
+// backups returns the backups of Filename, oldest first. A backup still
+// being compressed is listed uncompressed.
+func (s *Shipper) backups() []string {
+	ext := filepath.Ext(s.Filename)
+	prefix := strings.TrimSuffix(s.Filename, ext)
+	matches, _ := filepath.Glob(prefix + "-*" + ext)
+	compressed, _ := filepath.Glob(prefix + "-*" + ext + compressSuffix)
+	for _, name := range compressed {
+		if _, err := os.Stat(strings.TrimSuffix(name, compressSuffix)); os.IsNotExist(err) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return backupKey(matches[i]) < backupKey(matches[j]) })
+	return matches
+}
+
+// compressSuffix is the suffix the logger gives compressed backups.
+const compressSuffix = ".gz"
+
+// backupKey orders a backup by its name before compression.
+func backupKey(name string) string {
+	return strings.TrimSuffix(filepath.Base(name), compressSuffix)
+}
+
+// send delivers records, retrying with exponential backoff until it
+// succeeds or ctx is done. While the circuit breaker is open it waits for
+// the trial send instead. A batch the Sink rejects permanently is written
+// to the dead-letter file and counts as delivered.
+func (s *Shipper) send(ctx context.Context, pos mmapsyncer.Cursor, records [][]byte) error {
+	backoff := s.MinBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	maxBackoff := s.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	for {
+		if wait := s.breakerWait(); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+		var err error
+		if rs, ok := s.Sink.(RecordSink); ok {
+			err = rs.SendRecords(ctx, keyed(pos, records))
+		} else {
+			err = s.Sink.Send(ctx, records)
+		}
+		if IsPermanent(err) {
+			s.report(fmt.Errorf("shipper: batch rejected, writing %d records to %s: %w", len(records), s.DeadLetterFile, err))
+			if err = appendDeadLetters(s.DeadLetterFile, deadLetters(keyed(pos, records), err)); err == nil {
+				s.recordDeadLetters(len(records))
+				return nil
+			}
+		}
+		s.recordSend(len(records), err)
+		if err == nil {
+			return nil
+		}
+		s.report(fmt.Errorf("shipper: send: %w", err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (s *Shipper) report(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+func (s *Shipper) batchSize() int {
+	if s.BatchSize > 0 {
+		return s.BatchSize
+	}
+	return 500
+}
+
+func (s *Shipper) pollInterval() time.Duration {
+	if s.PollInterval > 0 {
+		return s.PollInterval
+	}
+	return time.Second
+}
+
+// fileHeaderMagic and fileHeaderSize describe the file header the log
+// package writes with Config.FileHeader, see log.FileHeader: the magic,
+// three format bytes and a newline.
+const (
+	fileHeaderMagic = "MWSL"
+	fileHeaderSize  = 8
+)
+
+// isFileHeader reports whether r starts with a file header.
+func isFileHeader(r *bufio.Reader) bool {
+	b, err := r.Peek(fileHeaderSize)
+	return err == nil && string(b[:len(fileHeaderMagic)]) == fileHeaderMagic && b[fileHeaderSize-1] == '\n'
+}
+
+// readRecords reads the complete records of name starting at offset, up to
+// the limits of p, returning the offset after them, whether a limit was
+// reached and the opened file's info. It stops at the NUL padding of the
+// mmap output and leaves a record whose newline has not been written yet
+// for the next call. A file header at the start of the file is skipped.
+// A compressed backup is decompressed, offset counting uncompressed bytes.
+func readRecords(name string, offset int64, p BatchPolicy) (records [][]byte, next int64, full bool, info os.FileInfo, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, offset, false, nil, err
+	}
+	defer f.Close()
+	if info, err = f.Stat(); err != nil {
+		return nil, offset, false, nil, err
+	}
+	var src io.Reader = io.NewSectionReader(f, offset, 1<<62)
+	if strings.HasSuffix(name, compressSuffix) {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, offset, false, info, err
+		}
+		if _, err := io.CopyN(io.Discard, gr, offset); err != nil {
+			return nil, offset, false, info, err
+		}
+		src = gr
+	}
+	r := bufio.NewReader(src)
+	next = offset
+	if offset == 0 && isFileHeader(r) {
+		_, _ = r.Discard(fileHeaderSize)
+		next = fileHeaderSize
+	}
+	size := 0
+	for {
+		if len(records) >= p.MaxBatchRecords {
+			return records, next, true, info, nil
+		}
+		line, err := r.ReadBytes('\n')
+		if i := bytes.IndexByte(line, 0); i >= 0 {
+			break
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return records, next, false, info, err
+		}
+		if len(records) > 0 && size+len(line)-1 > p.MaxBatchBytes {
+			return records, next, true, info, nil
+		}
+		next += int64(len(line))
+		size += len(line) - 1
+		records = append(records, line[:len(line)-1])
+	}
+	return records, next, false, info, nil
+}
@@ -0,0 +1,201 @@
+package shipper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	"github.com/Reb1113/mmap_write_syncer/mmapsyncer"
+)
+
+// flakySink stands in for an unreliable remote: it rejects batches, loses
+// acknowledgements of delivered batches, and crashes the shipper between
+// delivery and cursor commit. It keeps the delivered records by key, as a
+// deduplicating remote would.
+type flakySink struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	got    map[string]string
+	dups   int
+	total  int
+	cancel context.CancelFunc
+}
+
+func (s *flakySink) Send(ctx context.Context, records [][]byte) error {
+	return errors.New("flakySink: keys required")
+}
+
+func (s *flakySink) SendRecords(ctx context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fate := s.rng.Intn(10)
+	if fate < 3 {
+		return errors.New("flakySink: unavailable")
+	}
+	for _, r := range records {
+		if _, ok := s.got[r.Key]; ok {
+			s.dups++
+		}
+		s.got[r.Key] = string(r.Data)
+	}
+	switch {
+	case len(s.got) == s.total:
+		s.cancel()
+		return nil
+	case fate == 3:
+		return errors.New("flakySink: acknowledgement lost")
+	case fate == 4:
+		s.cancel() // crash after delivery, before the cursor is committed
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestAtLeastOnceAcrossCrashes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := &logger.MMapLogger{Filename: filename}
+	const total = 1000
+	for i := 0; i < total; i++ {
+		if _, err := l.Write([]byte(fmt.Sprintf("record %d\n", i))); err != nil {
+			t.Fatal(err)
+		}
+		if i%250 == 249 {
+			if err := l.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	defer l.Close()
+
+	sink := &flakySink{rng: rand.New(rand.NewSource(1)), got: make(map[string]string), total: total}
+	restarts := 0
+	for ; restarts < 1000; restarts++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		sink.cancel = cancel
+		s := &Shipper{
+			Filename:         filename,
+			Sink:             sink,
+			BatchSize:        7,
+			PollInterval:     time.Millisecond,
+			MinBackoff:       time.Microsecond,
+			MaxBackoff:       time.Microsecond,
+			BreakerThreshold: 1 << 20,
+		}
+		err := s.Run(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("shipper stalled after %d restarts with %d of %d records delivered", restarts, len(sink.got), total)
+		}
+		if len(sink.got) == total {
+			break
+		}
+	}
+
+	seen := make(map[string]bool, total)
+	for _, data := range sink.got {
+		seen[data] = true
+	}
+	for i := 0; i < total; i++ {
+		if want := fmt.Sprintf("record %d", i); !seen[want] {
+			t.Fatalf("%q lost after %d restarts", want, restarts)
+		}
+	}
+	if restarts == 0 || sink.dups == 0 {
+		t.Fatalf("no crash exercised: %d restarts, %d redelivered records", restarts, sink.dups)
+	}
+}
+
+func TestStopDeliversWrittenRecords(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := &logger.MMapLogger{Filename: filename}
+	defer l.Close()
+	writeRecords(t, l, 10, 10)
+
+	sink := &countingSink{total: 1 << 30, cancel: func() {}}
+	s := &Shipper{Filename: filename, Sink: sink, PollInterval: time.Hour}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err == nil {
+		t.Fatal("second Start succeeded")
+	}
+	writeRecords(t, l, 10, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sink.sent != 20 {
+		t.Fatalf("Stop returned after %d of 20 records", sink.sent)
+	}
+	if err := s.Healthy(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSkipsFileHeader(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := &logger.MMapLogger{Filename: filename, Header: []byte("MWSL1j0\n")}
+	defer l.Close()
+	writeRecords(t, l, 10, 10)
+
+	sink := &countingSink{total: 1 << 30, cancel: func() {}}
+	s := &Shipper{Filename: filename, Sink: sink, PollInterval: time.Hour}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sink.sent != 10 {
+		t.Fatalf("shipped %d of 10 records after the file header", sink.sent)
+	}
+}
+
+func TestFollowsCompressedBackup(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	l := &logger.MMapLogger{Filename: filename, Compress: true}
+	defer l.Close()
+	writeRecords(t, l, 10, 10)
+	// The shipper delivered 5 records before the remote went down.
+	pos, err := mmapsyncer.CursorAt(filename, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pos.Commit(filename + ".cursor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := l.WaitMaintenance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := filepath.Glob(filepath.Join(dir, "app-*.log")); len(backups) != 0 {
+		t.Fatalf("backups %v were not compressed", backups)
+	}
+	writeRecords(t, l, 3, 10)
+
+	sink := &countingSink{total: 1 << 30, cancel: func() {}}
+	s := &Shipper{Filename: filename, Sink: sink, PollInterval: time.Hour, OnError: func(err error) { t.Error(err) }}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sink.sent != 8 {
+		t.Fatalf("shipped %d records, want the 5 left in the compressed backup and 3 new ones", sink.sent)
+	}
+}
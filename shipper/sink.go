@@ -0,0 +1,243 @@
+package shipper
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/mmapsyncer"
+)
+
+// Sink forwards a batch of records to a remote system. Send must either
+// deliver the whole batch or return an error; the Shipper retries the same
+// batch until it succeeds.
+type Sink interface {
+	Send(ctx context.Context, records [][]byte) error
+}
+
+// Record is a record together with its delivery key.
+type Record struct {
+	Key  string // Key is "<dev>-<ino>-<offset>", unique per record and equal across redeliveries.
+	Data []byte
+}
+
+// RecordSink is implemented by Sinks that deduplicate redelivered records
+// by their key. The Shipper calls SendRecords instead of Send for them.
+type RecordSink interface {
+	Sink
+	SendRecords(ctx context.Context, records []Record) error
+}
+
+// keyed returns records, read from pos, with their delivery keys.
+func keyed(pos mmapsyncer.Cursor, records [][]byte) []Record {
+	out := make([]Record, len(records))
+	offset := pos.Offset
+	for i, r := range records {
+		out[i] = Record{Key: fmt.Sprintf("%d-%d-%d", pos.Dev, pos.Ino, offset), Data: r}
+		offset += int64(len(r)) + 1 // readRecords strips the newline
+	}
+	return out
+}
+
+// TCPSink writes records newline separated to a TCP endpoint, such as a
+// syslog-ng, vector or fluent-bit tcp source. The connection is dialed on
+// first use and redialed after a failure. With a Codec every batch is
+// written as one compressed frame, so the connection carries a single
+// compressed stream, e.g. for a gzip-decoding source.
+type TCPSink struct {
+	Addr        string
+	DialTimeout time.Duration // DialTimeout defaults to 10s.
+	TLS         *TLSConfig    // TLS if set -> the connection uses TLS.
+	Dialer      Dialer        // Dialer if set -> dials the connection instead of a net.Dialer, e.g. a ProxyDialer.
+	Codec       Codec         // Codec if set -> batches are compressed, e.g. Gzip.
+	BatchPolicy
+
+	mu   sync.Mutex
+	conn net.Conn
+	sent byteCount
+}
+
+func (s *TCPSink) Send(ctx context.Context, records [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		timeout := s.DialTimeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		var d Dialer = &net.Dialer{}
+		if s.Dialer != nil {
+			d = s.Dialer
+		}
+		conn, err := d.DialContext(dialCtx, "tcp", s.Addr)
+		if err != nil {
+			return err
+		}
+		if s.TLS != nil {
+			config, err := s.TLS.Build()
+			if err != nil {
+				conn.Close()
+				return err
+			}
+			if config.ServerName == "" {
+				config.ServerName, _, _ = net.SplitHostPort(s.Addr)
+			}
+			tlsConn := tls.Client(conn, config)
+			if err := tlsConn.HandshakeContext(dialCtx); err != nil {
+				conn.Close()
+				return err
+			}
+			conn = tlsConn
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	} else {
+		_ = s.conn.SetWriteDeadline(time.Time{})
+	}
+	var buf bytes.Buffer
+	for _, r := range records {
+		buf.Write(r)
+		buf.WriteByte('\n')
+	}
+	payload, err := compress(s.Codec, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if _, err := s.conn.Write(payload); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	s.sent.add(buf.Len(), len(payload))
+	return nil
+}
+
+// Bytes returns the bytes delivered before and after compression.
+func (s *TCPSink) Bytes() (raw, compressed uint64) {
+	return s.sent.Bytes()
+}
+
+// Close closes the connection, if any.
+func (s *TCPSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// LokiSink pushes records to the Loki push API as a single stream.
+type LokiSink struct {
+	URL    string            // URL is the push endpoint, e.g. "http://loki:3100/loki/api/v1/push".
+	Labels map[string]string // Labels identify the stream, e.g. {"job": "app"}.
+	Client *http.Client      // Client defaults to http.DefaultClient, or to a client using TLS and Dialer if set.
+	TLS    *TLSConfig        // TLS configures the client when Client is nil.
+	Dialer Dialer            // Dialer if set -> dials the connections of the client when Client is nil, e.g. a ProxyDialer.
+	Codec  Codec             // Codec if set -> pushes are compressed and sent with its Content-Encoding, e.g. Gzip.
+	BatchPolicy
+
+	mu        sync.Mutex // mu guards ownClient
+	ownClient *http.Client
+	sent      byteCount
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (s *LokiSink) Send(ctx context.Context, records [][]byte) error {
+	ts := strconv.FormatInt(time.Now().UnixNano(), 10)
+	stream := lokiStream{Stream: s.Labels, Values: make([][2]string, len(records))}
+	for i, r := range records {
+		stream.Values[i] = [2]string{ts, string(r)}
+	}
+	body, err := json.Marshal(lokiPush{Streams: []lokiStream{stream}})
+	if err != nil {
+		return err
+	}
+	payload, err := compress(s.Codec, body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Codec != nil {
+		req.Header.Set("Content-Encoding", s.Codec.Name())
+	}
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("loki push: %s: %s", resp.Status, bytes.TrimSpace(msg))
+		// Loki rejects malformed or too old entries with 4xx; only rate
+		// limiting and timeouts are worth retrying.
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+			return Permanent(err)
+		}
+		return err
+	}
+	s.sent.add(len(body), len(payload))
+	return nil
+}
+
+// Bytes returns the bytes delivered before and after compression.
+func (s *LokiSink) Bytes() (raw, compressed uint64) {
+	return s.sent.Bytes()
+}
+
+func (s *LokiSink) client() (*http.Client, error) {
+	if s.Client != nil {
+		return s.Client, nil
+	}
+	if s.TLS == nil && s.Dialer == nil {
+		return http.DefaultClient, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ownClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if s.TLS != nil {
+			config, err := s.TLS.Build()
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = config
+		}
+		if s.Dialer != nil {
+			transport.Proxy = nil // the dialer decides the egress path
+			transport.DialContext = s.Dialer.DialContext
+		}
+		s.ownClient = &http.Client{Transport: transport}
+	}
+	return s.ownClient, nil
+}
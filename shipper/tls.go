@@ -0,0 +1,47 @@
+package shipper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig configures TLS, and mutual TLS when a client certificate is
+// given, for the network sinks. Files are read when the sink first
+// connects.
+type TLSConfig struct {
+	CAFile             string // CAFile is a PEM bundle of CAs trusted for the server certificate, defaults to the system roots.
+	CertFile           string // CertFile is the PEM client certificate presented for mutual TLS.
+	KeyFile            string // KeyFile is the PEM private key of CertFile.
+	ServerName         string // ServerName overrides the name verified against the server certificate.
+	InsecureSkipVerify bool   // InsecureSkipVerify disables server certificate verification, for testing only.
+}
+
+// Build returns the crypto/tls configuration described by c.
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("shipper: read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("shipper: no certificates in CA file %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("shipper: load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
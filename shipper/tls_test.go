@@ -0,0 +1,182 @@
+package shipper
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPKI is a CA with a server certificate for 127.0.0.1 and a client
+// certificate, written as PEM files.
+type testPKI struct {
+	pool                      *x509.CertPool
+	server                    tls.Certificate
+	caFile, certFile, keyFile string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "127.0.0.1"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+	writePEM := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	p := &testPKI{pool: x509.NewCertPool()}
+	p.pool.AddCert(ca)
+	p.caFile = writePEM("ca.pem", "CERTIFICATE", caDER)
+	serverDER, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	p.server = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+	clientDER, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.certFile = writePEM("client.pem", "CERTIFICATE", clientDER)
+	p.keyFile = writePEM("client-key.pem", "EC PRIVATE KEY", keyDER)
+	return p
+}
+
+// serverConfig requires a client certificate issued by the CA. TLS 1.2
+// makes a rejected client fail in the handshake rather than on a later read.
+func (p *testPKI) serverConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    p.pool,
+		MaxVersion:   tls.VersionTLS12,
+	}
+}
+
+func TestTCPSinkMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", pki.serverConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if line, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+					lines <- line
+				}
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sink := &TCPSink{Addr: ln.Addr().String(), TLS: &TLSConfig{CAFile: pki.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile}}
+	defer sink.Close()
+	if err := sink.Send(ctx, [][]byte{[]byte("over mtls")}); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-lines; line != "over mtls\n" {
+		t.Fatalf("server read %q", line)
+	}
+
+	anonymous := &TCPSink{Addr: ln.Addr().String(), TLS: &TLSConfig{CAFile: pki.caFile}}
+	if err := anonymous.Send(ctx, [][]byte{[]byte("rejected")}); err == nil {
+		t.Fatal("send without a client certificate succeeded")
+	}
+	untrusted := &TCPSink{Addr: ln.Addr().String(), TLS: &TLSConfig{CertFile: pki.certFile, KeyFile: pki.keyFile}}
+	if err := untrusted.Send(ctx, [][]byte{[]byte("rejected")}); err == nil {
+		t.Fatal("send verifying the server against the system roots succeeded")
+	}
+}
+
+func TestLokiSinkMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	pushed := make(chan string, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			pushed <- r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = pki.serverConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	sink := &LokiSink{URL: srv.URL + "/loki/api/v1/push", TLS: &TLSConfig{CAFile: pki.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile}}
+	if err := sink.Send(context.Background(), [][]byte{[]byte("over mtls")}); err != nil {
+		t.Fatal(err)
+	}
+	if cn := <-pushed; cn != "127.0.0.1" {
+		t.Fatalf("server saw client certificate %q", cn)
+	}
+}
+
+func TestTLSConfigBuildErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]*TLSConfig{
+		"missing CA file":  {CAFile: filepath.Join(dir, "missing.pem")},
+		"CA file not PEM":  {CAFile: notPEM},
+		"key without cert": {KeyFile: notPEM},
+	} {
+		if _, err := c.Build(); err == nil {
+			t.Errorf("%s: Build succeeded", name)
+		}
+	}
+}
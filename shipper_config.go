@@ -0,0 +1,125 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Shipper config formats supported by ShipperConfig.
+const (
+	ShipperVector    = "vector"
+	ShipperFluentBit = "fluent-bit"
+	ShipperPromtail  = "promtail"
+)
+
+var shipperTemplates = map[string]*template.Template{
+	ShipperVector: template.Must(template.New(ShipperVector).Parse(`# Generated from the logger config: tail the live file and its
+# uncompressed backups. Rotated files are renamed, so tracking by
+# fingerprint lets vector finish a file after it was rotated away.
+[sources.{{.Name}}]
+type = "file"
+include = ["{{.Live}}", "{{.Backups}}"]
+exclude = ["{{.Compressed}}"]
+read_from = "beginning"
+fingerprint.strategy = "device_and_inode"
+{{- if .JSON}}
+
+[transforms.{{.Name}}_parse]
+type = "remap"
+inputs = ["{{.Name}}"]
+source = '''
+# The mmap output leaves NUL padding at the tail of a file after a crash.
+.message = replace(string!(.message), "\u0000", "")
+. = merge(., parse_json!(.message))
+'''
+{{- end}}
+`)),
+	ShipperFluentBit: template.Must(template.New(ShipperFluentBit).Parse(`# Generated from the logger config: tail the live file and its
+# uncompressed backups.
+[INPUT]
+    Name              tail
+    Tag               {{.Name}}
+    Path              {{.Live}},{{.Backups}}
+    Exclude_Path      {{.Compressed}}
+    Read_from_Head    On
+    Rotate_Wait       30
+{{- if .JSON}}
+    Parser            json
+{{- end}}
+`)),
+	ShipperPromtail: template.Must(template.New(ShipperPromtail).Parse(`# Generated from the logger config: tail the live file and its
+# uncompressed backups.
+scrape_configs:
+  - job_name: {{.Name}}
+    static_configs:
+      - targets: [localhost]
+        labels:
+          job: {{.Name}}
+          __path__: "{{.Glob}}"
+          __path_exclude__: "{{.Compressed}}"
+{{- if .JSON}}
+    pipeline_stages:
+      - replace:
+          expression: "(\\x00+)"
+          replace: ""
+      - json:
+          expressions:
+            level: level
+            time: time
+            msg: msg
+      - labels:
+          level:
+      - timestamp:
+          source: time
+          format: RFC3339Nano
+{{- end}}
+`)),
+}
+
+// ShipperConfig renders a log shipper configuration snippet (vector,
+// fluent-bit or promtail) describing the files produced by config: the
+// live file, the naming pattern of its rotated backups and the record
+// encoding.
+func ShipperConfig(config *Config, format string) (string, error) {
+	tmpl, ok := shipperTemplates[format]
+	if !ok {
+		return "", fmt.Errorf("not support shipper format: %v", format)
+	}
+	if config == nil {
+		config = defaultConfig
+	}
+	if !config.Output.writesFiles() {
+		return "", fmt.Errorf("%v output has no files to ship", config.Output)
+	}
+	if encodingOf(config) == EncodingMsgpack {
+		return "", fmt.Errorf("msgpack records cannot be tailed, convert them with ExportJSONL")
+	}
+	filename := config.Filename
+	if filename == "" {
+		filename = defaultFilename
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	dir := filepath.Dir(filename)
+	base := filepath.Base(filename)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext)
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, struct {
+		Name, Live, Backups, Compressed, Glob string
+		JSON                                  bool
+	}{
+		Name:       strings.NewReplacer("-", "_", ".", "_").Replace(prefix),
+		Live:       filename,
+		Backups:    filepath.Join(dir, prefix+"-*"+ext),
+		Compressed: filepath.Join(dir, prefix+"-*"+ext+".gz"),
+		Glob:       filepath.Join(dir, prefix+"*"+ext),
+		JSON:       encodingOf(config) == EncodingJSON,
+	})
+	return buf.String(), err
+}
@@ -0,0 +1,69 @@
+package log
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+)
+
+func TestShipperConfig(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	m := &logger.MMapLogger{Filename: filename}
+	if _, err := m.Write([]byte("{\"msg\":\"a\"}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := filepath.Glob(filepath.Join(dir, "app-*"))
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups %v, %v, want the rotated file", backups, err)
+	}
+
+	out, err := ShipperConfig(&Config{Output: OutputMmap, Filename: filename}, ShipperVector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	include := regexp.MustCompile(`include = \["([^"]+)", "([^"]+)"\]`).FindStringSubmatch(out)
+	exclude := regexp.MustCompile(`exclude = \["([^"]+)"\]`).FindStringSubmatch(out)
+	if include == nil || exclude == nil {
+		t.Fatalf("vector config lacks include or exclude:\n%s", out)
+	}
+	if include[1] != filename {
+		t.Errorf("live file %q, want %q", include[1], filename)
+	}
+	backup := backups[0]
+	if ok, _ := filepath.Match(include[2], backup); !ok {
+		t.Errorf("backup pattern %q doesn't match the backup %s", include[2], filepath.Base(backup))
+	}
+	if ok, _ := filepath.Match(exclude[1], backup+".gz"); !ok {
+		t.Errorf("exclude pattern %q doesn't match the compressed backup", exclude[1])
+	}
+	if !strings.Contains(out, "parse_json") {
+		t.Errorf("vector config for JSON records doesn't parse them:\n%s", out)
+	}
+
+	for _, format := range []string{ShipperFluentBit, ShipperPromtail} {
+		out, err := ShipperConfig(&Config{Output: OutputMmap, Filename: filename, Encoding: EncodingConsole}, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, filename[:len(filename)-len(".log")]) || strings.Contains(out, "json") {
+			t.Errorf("%s config for console records:\n%s", format, out)
+		}
+	}
+
+	if _, err := ShipperConfig(&Config{Output: OutputMmap, Filename: filename}, "syslog-ng"); err == nil {
+		t.Error("unknown shipper format accepted")
+	}
+	if _, err := ShipperConfig(&Config{Output: OutputStdout}, ShipperVector); err == nil {
+		t.Error("shipper config for stdout output created")
+	}
+}
@@ -0,0 +1,87 @@
+package log
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+var registry struct {
+	mu      sync.Mutex
+	loggers []Logger
+}
+
+// register records l so that it can be closed on shutdown.
+func register(l Logger) {
+	registry.mu.Lock()
+	registry.loggers = append(registry.loggers, l)
+	registry.mu.Unlock()
+}
+
+// unregister removes l, closed by its owner, from the registry.
+func unregister(l Logger) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for i, r := range registry.loggers {
+		if r == l {
+			last := len(registry.loggers) - 1
+			copy(registry.loggers[i:], registry.loggers[i+1:])
+			registry.loggers[last] = nil
+			registry.loggers = registry.loggers[:last]
+			return
+		}
+	}
+}
+
+// CloseAll flushes and closes every logger created by New.
+func CloseAll() {
+	registry.mu.Lock()
+	loggers := registry.loggers
+	registry.loggers = nil
+	registry.mu.Unlock()
+
+	for _, l := range loggers {
+		l.Close()
+	}
+}
+
+// raiseSignal sends sig to the process itself, exit ends it; both are
+// replaced in tests.
+var (
+	raiseSignal = func(sig os.Signal) error {
+		p, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			return err
+		}
+		return p.Signal(sig)
+	}
+	exit = os.Exit
+)
+
+// HandleSignals closes all registered loggers when one of signals is
+// received and then re-raises the signal so the process exits as it would
+// have without the handler. Where re-raising isn't supported, such as
+// os.Interrupt on Windows, the process exits with status 128 plus the
+// signal number instead. SIGINT and SIGTERM are used when no signals are
+// given. The handler is uninstalled once ctx is done.
+func HandleSignals(ctx context.Context, signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = defaultSignals
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	go func() {
+		defer signal.Stop(ch)
+		select {
+		case <-ctx.Done():
+		case sig := <-ch:
+			CloseAll()
+			signal.Stop(ch)
+			if err := raiseSignal(sig); err != nil {
+				exit(signalExitCode(sig))
+			}
+		}
+	}()
+}
@@ -0,0 +1,16 @@
+//go:build nosyscall
+
+package log
+
+import "os"
+
+// defaultSignals are handled by HandleSignals when no signals are given.
+// SIGTERM can't be named without the syscall package, so only os.Interrupt
+// is handled in nosyscall builds.
+var defaultSignals = []os.Signal{os.Interrupt}
+
+// signalExitCode is 1: signal numbers are not known without the syscall
+// package.
+func signalExitCode(sig os.Signal) int {
+	return 1
+}
@@ -0,0 +1,20 @@
+//go:build !nosyscall
+
+package log
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultSignals are handled by HandleSignals when no signals are given.
+var defaultSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// signalExitCode is the exit status of a shell whose child was killed by
+// sig.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
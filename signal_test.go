@@ -0,0 +1,32 @@
+package log
+
+import "testing"
+
+func registered() int {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return len(registry.loggers)
+}
+
+func TestCloseUnregisters(t *testing.T) {
+	before := registered()
+	a := New(&Config{Output: OutputConsole})
+	b := New(&Config{Output: OutputConsole})
+	if n := registered(); n != before+2 {
+		t.Fatalf("%d loggers registered, want %d", n, before+2)
+	}
+	a.Close()
+	if n := registered(); n != before+1 {
+		t.Fatalf("%d loggers registered after Close, want %d", n, before+1)
+	}
+	registry.mu.Lock()
+	kept := registry.loggers[len(registry.loggers)-1]
+	registry.mu.Unlock()
+	if kept != b {
+		t.Fatal("Close unregistered the wrong logger")
+	}
+	b.Close()
+	if n := registered(); n != before {
+		t.Fatalf("%d loggers registered after closing both, want %d", n, before)
+	}
+}
@@ -0,0 +1,65 @@
+//go:build unix && !nosyscall
+
+package log
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// handleInterrupt runs HandleSignals for os.Interrupt with raiseSignal
+// returning raiseErr, sends the process an interrupt and returns the
+// re-raised signal and the exit status, -1 if the process didn't exit.
+func handleInterrupt(t *testing.T, raiseErr error) (raised os.Signal, code int) {
+	t.Helper()
+	raises := make(chan os.Signal, 1)
+	exits := make(chan int, 1)
+	defer func(r func(os.Signal) error, e func(int)) { raiseSignal, exit = r, e }(raiseSignal, exit)
+	raiseSignal = func(sig os.Signal) error {
+		raises <- sig
+		return raiseErr
+	}
+	exit = func(code int) { exits <- code }
+
+	l := New(&Config{Output: OutputConsole})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	HandleSignals(ctx, os.Interrupt)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case raised = <-raises:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the signal was not re-raised")
+	}
+	code = -1
+	select {
+	case code = <-exits:
+	case <-time.After(50 * time.Millisecond):
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, r := range registry.loggers {
+		if r == l {
+			t.Fatal("logger still registered after the signal")
+		}
+	}
+	return raised, code
+}
+
+func TestHandleSignals(t *testing.T) {
+	raised, code := handleInterrupt(t, nil)
+	if raised != os.Interrupt || code != -1 {
+		t.Fatalf("re-raised %v and exited with %d, want the interrupt re-raised and no exit", raised, code)
+	}
+
+	raised, code = handleInterrupt(t, errors.New("not supported by windows"))
+	if raised != os.Interrupt || code != 128+int(syscall.SIGINT) {
+		t.Fatalf("re-raised %v and exited with %d, want an exit with status %d when re-raising fails", raised, code, 128+int(syscall.SIGINT))
+	}
+}
@@ -0,0 +1,76 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Sink is a destination running alongside the logger whose lifecycle the
+// logger manages, e.g. a *shipper.Shipper forwarding the log files to a
+// remote. New starts every Sink of Config.Sinks; Close flushes the output
+// first and then stops them, so the records written until then are
+// delivered.
+type Sink interface {
+	// Name identifies the sink in health reports and errors.
+	Name() string
+	// Start starts the sink; it must not block while the sink runs.
+	Start(ctx context.Context) error
+	// Stop delivers what the sink has pending and stops it, giving up
+	// once ctx is done.
+	Stop(ctx context.Context) error
+	// Healthy returns nil if the sink is working, or what is wrong.
+	Healthy() error
+}
+
+// SinkStatus is the health of a Sink, as reported by SinkHealth.
+type SinkStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+const defaultSinkStopTimeout = 10 * time.Second
+
+// startSinks starts the sinks of config, reporting those that fail. Only
+// the started sinks are returned.
+func startSinks(config *Config) []Sink {
+	started := make([]Sink, 0, len(config.Sinks))
+	for _, s := range config.Sinks {
+		if err := s.Start(context.Background()); err != nil {
+			reportError(config, fmt.Errorf("sink %s disabled: %w", s.Name(), err))
+			continue
+		}
+		started = append(started, s)
+	}
+	return started
+}
+
+// stopSinks stops sinks within config.SinkStopTimeout, reporting those that
+// fail to stop cleanly.
+func stopSinks(config *Config, sinks []Sink) {
+	timeout := config.SinkStopTimeout
+	if timeout <= 0 {
+		timeout = defaultSinkStopTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, s := range sinks {
+		if err := s.Stop(ctx); err != nil {
+			reportError(config, fmt.Errorf("sink %s: stop: %w", s.Name(), err))
+		}
+	}
+}
+
+// SinkHealth reports the health of every started Sink.
+func (l *zapLogger) SinkHealth() []SinkStatus {
+	statuses := make([]SinkStatus, len(l.managed))
+	for i, s := range l.managed {
+		statuses[i] = SinkStatus{Name: s.Name(), Healthy: true}
+		if err := s.Healthy(); err != nil {
+			statuses[i].Healthy = false
+			statuses[i].Error = err.Error()
+		}
+	}
+	return statuses
+}
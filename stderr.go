@@ -0,0 +1,166 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Reb1113/mmap_write_syncer/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+// stderrCheckInterval is how often the size of StderrFile is checked.
+var stderrCheckInterval = 10 * time.Second
+
+// redirectStderr points fd 2 at StderrFile. The kernel appends to the file
+// directly, so nothing written to stderr right before a crash is lost. The
+// file isn't the log itself: the mmap output and lumberjack both write at
+// their own offsets and would overwrite whatever fd 2 appended. restore
+// stops the rotation of the file and points fd 2 back at the original
+// stderr.
+func redirectStderr(config *Config) (restore func() error, err error) {
+	if config.StderrFile == "" {
+		config.StderrFile = config.Filename + ".stderr"
+	}
+	s := &stderrFile{
+		config:     config,
+		path:       config.StderrFile,
+		maxBackups: config.MaxBackups,
+		clock:      zapcore.DefaultClock,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if config.MaxSize != UnlimitedSize {
+		s.maxSize = int64(config.MaxSize) << 20
+	}
+	if config.Clock != nil {
+		s.clock = config.Clock
+	}
+	f, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // fd 2 keeps its own copy of the descriptor
+	if s.restore, err = logger.RedirectStderr(f); err != nil {
+		return nil, err
+	}
+	go s.watch()
+	return s.close, nil
+}
+
+// stderrFile rotates the file fd 2 points at. Nothing sees the writes to
+// fd 2, so its size is checked every stderrCheckInterval: once it reaches
+// MaxSize the file is renamed to a backup such as
+// app.log-2006-01-02T15-04-05.000.stderr, fd 2 is re-duped onto a new file
+// and only the newest MaxBackups backups are kept.
+type stderrFile struct {
+	config     *Config
+	path       string
+	maxSize    int64 // maxSize is 0 for UnlimitedSize
+	maxBackups int
+	clock      zapcore.Clock
+
+	restore func() error
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func (s *stderrFile) open() (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+func (s *stderrFile) watch() {
+	defer close(s.done)
+	ticker := time.NewTicker(stderrCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.rotateIfFull(); err != nil {
+				reportError(s.config, fmt.Errorf("rotate stderr file: %v", err))
+			}
+		}
+	}
+}
+
+// rotateIfFull rotates the file once it reaches maxSize. A file removed
+// from under fd 2 is replaced as well.
+func (s *stderrFile) rotateIfFull() error {
+	info, err := os.Stat(s.path)
+	switch {
+	case os.IsNotExist(err):
+		return s.reopen()
+	case err != nil:
+		return err
+	case s.maxSize == 0 || info.Size() < s.maxSize:
+		return nil
+	}
+	if err := os.Rename(s.path, s.backupName()); err != nil {
+		return err
+	}
+	if err := s.reopen(); err != nil {
+		return err
+	}
+	s.prune()
+	return nil
+}
+
+// reopen points fd 2 at a new file at path.
+func (s *stderrFile) reopen() error {
+	f, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return logger.PointStderr(f)
+}
+
+// backups returns the backups of path, oldest first.
+func (s *stderrFile) backups() []string {
+	ext := filepath.Ext(s.path)
+	matches, _ := filepath.Glob(strings.TrimSuffix(s.path, ext) + "-*" + ext)
+	sort.Strings(matches)
+	return matches
+}
+
+// backupName returns the name of a backup made now, later than any
+// existing one of the same millisecond.
+func (s *stderrFile) backupName() string {
+	ext := filepath.Ext(s.path)
+	prefix := strings.TrimSuffix(s.path, ext) + "-"
+	t := s.clock.Now().Truncate(time.Millisecond)
+	for {
+		name := prefix + t.Format(blobTimeFormat) + ext
+		if _, err := os.Lstat(name); err != nil {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// prune removes the backups beyond maxBackups.
+func (s *stderrFile) prune() {
+	backups := s.backups()
+	if s.maxBackups <= 0 || len(backups) <= s.maxBackups {
+		return
+	}
+	for _, old := range backups[:len(backups)-s.maxBackups] {
+		if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+			reportError(s.config, fmt.Errorf("remove stderr backup: %v", err))
+		}
+	}
+}
+
+func (s *stderrFile) close() error {
+	close(s.stop)
+	<-s.done
+	return s.restore()
+}
@@ -0,0 +1,92 @@
+//go:build linux && !nosyscall
+
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedirectStderr(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename, RedirectStderr: true})
+	l.Info("before")
+	if _, err := os.Stderr.WriteString("written to fd 2\n"); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("after")
+	l.Close()
+
+	data, err := os.ReadFile(filename + ".stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "written to fd 2\n" {
+		t.Fatalf("stderr file holds %q", data)
+	}
+	if out := readRecords(t, filename); strings.Count(out, "\n") != 2 || strings.Contains(out, "fd 2") {
+		t.Fatalf("log file holds %q, want just the two records", out)
+	}
+
+	// Close points fd 2 back at the original stderr
+	info, err := os.Stderr.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirected, err := os.Stat(filename + ".stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(info, redirected) {
+		t.Fatal("fd 2 still points at the stderr file after Close")
+	}
+}
+
+func TestRedirectStderrRotates(t *testing.T) {
+	defer func(d time.Duration) { stderrCheckInterval = d }(stderrCheckInterval)
+	stderrCheckInterval = 5 * time.Millisecond
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	stderrFile := filename + ".stderr"
+	l := New(&Config{Output: OutputMmap, Filename: filename, RedirectStderr: true, MaxSize: 1, MaxBackups: 1})
+	defer l.Close()
+
+	chunk := strings.Repeat("x", 1<<20) + "\n"
+	for i := 0; i < 3; i++ {
+		if _, err := os.Stderr.WriteString(chunk); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if info, err := os.Stat(stderrFile); err == nil && info.Size() == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("stderr file was not rotated after write %d", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if _, err := os.Stderr.WriteString("after rotation\n"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(stderrFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "after rotation\n" {
+		t.Fatalf("fd 2 was not re-duped onto the new file, it holds %d bytes", len(data))
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "app.log-*.stderr"))
+	if len(backups) != 1 {
+		t.Fatalf("backups %v, want MaxBackups of them", backups)
+	}
+	if info, err := os.Stat(backups[0]); err != nil || info.Size() != int64(len(chunk)) {
+		t.Fatalf("backup %s: %v, %v", backups[0], info, err)
+	}
+}
@@ -0,0 +1,91 @@
+package log
+
+import (
+	"os"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newStdoutCore returns the core copying records at or above StdoutLevel to
+// stdout as plain JSON for kubectl logs and cluster log collectors. It is
+// teed in below the cores adding "seq", "mono_ns" and structured errors, so
+// only the file output carries those.
+func newStdoutCore(config *Config, level zap.AtomicLevel) zapcore.Core {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.EncodeCaller = callerEncoder(config.CallerTrimPrefix)
+	min := config.StdoutLevel.ZapLevel()
+	if config.Quiet {
+		min = max(min, zapcore.ErrorLevel)
+	}
+	enabler := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
+		return lvl >= min && level.Enabled(lvl)
+	})
+	var core zapcore.Core = zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.Lock(os.Stdout), enabler)
+	if config.StdoutFields != nil {
+		core = newAllowlistCore(core, config.StdoutFields, nil)
+	}
+	return &stdoutCore{Core: core}
+}
+
+// stdoutCore checks the level again in Write: the wrapping cores write
+// through the tee directly, which hands every record to all of its cores.
+type stdoutCore struct {
+	zapcore.Core
+}
+
+func (c *stdoutCore) With(fields []zapcore.Field) zapcore.Core {
+	return &stdoutCore{Core: c.Core.With(fields)}
+}
+
+func (c *stdoutCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *stdoutCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !c.Enabled(ent.Level) {
+		return nil
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// splitCore writes records at or above Warn to stderr instead of the output
+// while the output writes to stdout, see Config.SplitConsole. Like
+// stdoutCore it routes in Write, which the wrapping cores call directly.
+type splitCore struct {
+	zapcore.Core // Core writes to the output.
+	stderr       zapcore.Core
+	output       *outputSyncer
+}
+
+func (c *splitCore) toStderr(lvl zapcore.Level) bool {
+	return lvl >= zapcore.WarnLevel && c.output.stdout()
+}
+
+func (c *splitCore) With(fields []zapcore.Field) zapcore.Core {
+	return &splitCore{Core: c.Core.With(fields), stderr: c.stderr.With(fields), output: c.output}
+}
+
+func (c *splitCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *splitCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if c.toStderr(ent.Level) {
+		return c.stderr.Write(ent, fields)
+	}
+	return c.Core.Write(ent, fields)
+}
+
+func (c *splitCore) Sync() error {
+	return multierr.Append(c.Core.Sync(), c.stderr.Sync())
+}
@@ -0,0 +1,73 @@
+package log
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStdoutCopy(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	warn := LevelWarn
+	out := captureStdout(t, func() {
+		l := New(&Config{Output: OutputMmap, Filename: filename, StdoutLevel: &warn, StdoutFields: []string{"user"}, Sequence: true})
+		l.Info("file only", "user", "alice")
+		l.Warn("both", "user", "alice", "token", "abc")
+		l.Close()
+	})
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("stdout got %d records, want only the warn one:\n%s", len(lines), out)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("stdout copy is not plain JSON: %v: %s", err, lines[0])
+	}
+	if rec["msg"] != "both" || rec["user"] != "alice" {
+		t.Errorf("stdout record = %v, want the warn record with user", rec)
+	}
+	for _, key := range []string{"token", "seq"} {
+		if _, ok := rec[key]; ok {
+			t.Errorf("stdout record keeps %q: %v", key, rec)
+		}
+	}
+
+	records := decodeRecords(t, filename)
+	if len(records) != 2 {
+		t.Fatalf("file got %d records, want 2", len(records))
+	}
+	if last := records[1]; last["token"] != "abc" || last["seq"] == nil {
+		t.Errorf("file record lost fields: %v", last)
+	}
+}
+
+func TestSplitConsole(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	var stderr string
+	stdout := captureStdout(t, func() {
+		stderr = captureStderr(t, func() {
+			l := New(&Config{Output: OutputStdout, Filename: filename, Encoding: EncodingJSON, SplitConsole: true}).(*zapLogger)
+			l.Info("data")
+			l.Warn("careful")
+			l.Error("failed")
+			_ = l.SetOutput(OutputMmap) // syncing the stdout pipe fails, the switch happens anyway
+			l.Warn("to the file")
+			l.Close()
+		})
+	})
+
+	if !strings.Contains(stdout, `"msg":"data"`) || strings.Contains(stdout, "careful") || strings.Contains(stdout, "failed") {
+		t.Errorf("stdout = %q, want only the info record", stdout)
+	}
+	if !strings.Contains(stderr, "careful") || !strings.Contains(stderr, "failed") || strings.Contains(stderr, `"msg":"data"`) {
+		t.Errorf("stderr = %q, want the warn and error records", stderr)
+	}
+	if strings.Contains(stdout+stderr, "to the file") {
+		t.Errorf("record written to the console while the output is mmap")
+	}
+	if out := readRecords(t, filename); !strings.Contains(out, "to the file") {
+		t.Errorf("warn record missing from the file output:\n%s", out)
+	}
+}
@@ -0,0 +1,35 @@
+package log
+
+import (
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+)
+
+// syncCore syncs the wrapped core after every record at or above level,
+// trading write latency for durability of important records. Only file
+// outputs are synced: stdout and stderr are usually pipes or terminals,
+// which fail to sync with EINVAL.
+type syncCore struct {
+	zapcore.Core
+	level  zapcore.Level
+	output *outputSyncer
+}
+
+func (c *syncCore) With(fields []zapcore.Field) zapcore.Core {
+	return &syncCore{Core: c.Core.With(fields), level: c.level, output: c.output}
+}
+
+func (c *syncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *syncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	err := c.Core.Write(ent, fields)
+	if ent.Level >= c.level && c.output.writesFiles() {
+		err = multierr.Append(err, c.Core.Sync())
+	}
+	return err
+}
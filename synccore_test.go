@@ -0,0 +1,65 @@
+package log
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// syncCounter is a WriteSyncer counting its syncs.
+type syncCounter struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (s *syncCounter) Sync() error {
+	s.syncs++
+	return nil
+}
+
+func TestSyncOnLevel(t *testing.T) {
+	ws := &syncCounter{}
+	inner := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), ws, zapcore.DebugLevel)
+	z := zap.New(&syncCore{Core: inner, level: zapcore.ErrorLevel, output: &outputSyncer{output: OutputMmap}}).With(zap.String("component", "db"))
+	z.Info("fast path")
+	z.Warn("still fast")
+	if ws.syncs != 0 {
+		t.Fatalf("%d syncs for records below SyncOnLevel", ws.syncs)
+	}
+	z.Error("durable")
+	if ws.syncs != 1 {
+		t.Fatalf("%d syncs after an error record, want 1", ws.syncs)
+	}
+	if n := bytes.Count(ws.Bytes(), []byte("\n")); n != 3 {
+		t.Fatalf("%d records written, want 3", n)
+	}
+}
+
+func TestSyncOnLevelConsole(t *testing.T) {
+	errorLevel := LevelError
+	for _, config := range []*Config{
+		{Output: OutputConsole},
+		{Output: OutputStderr},
+		{Output: OutputMmap, Filename: filepath.Join(t.TempDir(), "app.log"), StdoutLevel: new(Level)},
+	} {
+		config.SyncOnLevel = &errorLevel
+		var stderr string
+		stdout := captureStdout(t, func() {
+			stderr = captureStderr(t, func() {
+				l := New(config)
+				l.Error("synced")
+				l.Close()
+			})
+		})
+		if strings.Contains(stderr, "write error") {
+			t.Errorf("%v: syncing the console failed: %s", config.Output, stderr)
+		}
+		if !strings.Contains(stdout+stderr, "synced") {
+			t.Errorf("%v: record lost", config.Output)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package testutil
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata/golden with the current output")
+
+// Golden fails tb unless got matches the golden file testdata/golden/name,
+// relative to the package under test. Run the tests with -update to write
+// got as the new golden file after an intended change of the format, and
+// review the diff before committing it.
+func Golden(tb testing.TB, name string, got []byte) {
+	tb.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			tb.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatalf("read golden file: %v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		tb.Errorf("%s: output changed\ngot:  %q\nwant: %q\n(run with -update if the change is intended)", path, got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	elapsedKey      = "elapsed"
+	spanKey         = "span"
+	spanIDKey       = "span_id"
+	parentSpanIDKey = "parent_span_id"
+)
+
+type spanContextKey struct{}
+
+// SpanID returns the ID of the innermost span started on ctx with
+// StartSpan, or "" if there is none.
+func SpanID(ctx context.Context) string {
+	id, _ := ctx.Value(spanContextKey{}).(string)
+	return id
+}
+
+// beginSpan returns ctx carrying a new span ID and the fields identifying
+// the span in its records.
+func beginSpan(ctx context.Context, name string, keyvals []interface{}) (context.Context, []interface{}) {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+	fields := append(keyvals[:len(keyvals):len(keyvals)], spanKey, name, spanIDKey, id)
+	if parent := SpanID(ctx); parent != "" {
+		fields = append(fields, parentSpanIDKey, parent)
+	}
+	return context.WithValue(ctx, spanContextKey{}, id), fields
+}
+
+// StartTimer returns a function that logs msg with keyvals and the elapsed
+// time at info level when called, e.g. defer log.StartTimer(l, "query")().
+// Loggers with a Timer method of their own get it called instead.
+func StartTimer(l Logger, msg string, keyvals ...interface{}) func() {
+	if t, ok := l.(interface {
+		Timer(msg string, keyvals ...interface{}) func()
+	}); ok {
+		return t.Timer(msg, keyvals...)
+	}
+	start := time.Now()
+	return func() {
+		l.Info(msg, append(keyvals[:len(keyvals):len(keyvals)], elapsedKey, time.Since(start))...)
+	}
+}
+
+// StartSpan logs the start of the named span and returns ctx carrying its
+// ID together with a function logging its end and elapsed time. Loggers
+// with a Span method of their own get it called instead.
+func StartSpan(ctx context.Context, l Logger, name string, keyvals ...interface{}) (context.Context, func()) {
+	if s, ok := l.(interface {
+		Span(ctx context.Context, name string, keyvals ...interface{}) (context.Context, func())
+	}); ok {
+		return s.Span(ctx, name, keyvals...)
+	}
+	ctx, fields := beginSpan(ctx, name, keyvals)
+	start := time.Now()
+	l.Info(name+" started", fields...)
+	return ctx, func() {
+		l.Info(name+" finished", append(fields, elapsedKey, time.Since(start))...)
+	}
+}
+
+// Timer returns a function logging msg with keyvals and the time elapsed
+// since Timer was called, e.g. defer l.Timer("query", "table", t)().
+func (l *zapLogger) Timer(msg string, keyvals ...interface{}) func() {
+	keyvals = l.keyvals(keyvals)
+	start := time.Now()
+	return func() {
+		l.checkLevel()
+		l.logger.Infow(msg, append(keyvals[:len(keyvals):len(keyvals)], elapsedKey, time.Since(start))...)
+	}
+}
+
+// Span logs "<name> started" and returns ctx carrying the span's ID, so
+// spans started on it record it as their parent, and a function logging
+// "<name> finished" with the elapsed time.
+func (l *zapLogger) Span(ctx context.Context, name string, keyvals ...interface{}) (context.Context, func()) {
+	ctx, fields := beginSpan(ctx, name, l.keyvals(keyvals))
+	start := time.Now()
+	l.checkLevel()
+	l.logger.Infow(name+" started", fields...)
+	return ctx, func() {
+		l.checkLevel()
+		l.logger.Infow(name+" finished", append(fields, elapsedKey, time.Since(start))...)
+	}
+}
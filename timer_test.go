@@ -0,0 +1,85 @@
+package log
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// plainLogger hides the Timer and Span methods of the wrapped logger, so
+// StartTimer and StartSpan fall back to Info.
+type plainLogger struct {
+	Logger
+}
+
+func TestTimer(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename})
+	done := StartTimer(l, "query", "table", "users")
+	time.Sleep(5 * time.Millisecond)
+	done()
+	StartTimer(plainLogger{l}, "generic", "table", "orders")()
+	l.Close()
+
+	records := decodeRecords(t, filename)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	rec := records[0]
+	if rec["msg"] != "query" || rec["table"] != "users" {
+		t.Errorf("timer record = %v, want msg and the original fields", rec)
+	}
+	if elapsed, ok := rec[elapsedKey].(float64); !ok || elapsed <= 0 {
+		t.Errorf("timer record %s = %v, want a positive duration", elapsedKey, rec[elapsedKey])
+	}
+	if rec := records[1]; rec["msg"] != "generic" || rec["table"] != "orders" || rec[elapsedKey] == nil {
+		t.Errorf("StartTimer record = %v", rec)
+	}
+}
+
+func TestSpan(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	l := New(&Config{Output: OutputMmap, Filename: filename})
+	ctx, endOuter := StartSpan(context.Background(), l, "request", "path", "/users")
+	outer := SpanID(ctx)
+	if outer == "" {
+		t.Fatal("Span returned a context without a span ID")
+	}
+	inner, endInner := StartSpan(ctx, plainLogger{l}, "query")
+	if SpanID(inner) == outer {
+		t.Fatal("nested span reused the parent's ID")
+	}
+	endInner()
+	endOuter()
+	l.Close()
+
+	records := decodeRecords(t, filename)
+	want := []struct {
+		msg, span, parent string
+		ended             bool
+	}{
+		{"request started", "request", "", false},
+		{"query started", "query", outer, false},
+		{"query finished", "query", outer, true},
+		{"request finished", "request", "", true},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i, w := range want {
+		rec := records[i]
+		if rec["msg"] != w.msg || rec[spanKey] != w.span || rec[spanIDKey] == nil {
+			t.Errorf("record %d = %v, want %s of span %s", i, rec, w.msg, w.span)
+		}
+		if parent, _ := rec[parentSpanIDKey].(string); parent != w.parent {
+			t.Errorf("record %d %s = %q, want %q", i, parentSpanIDKey, parent, w.parent)
+		}
+		if _, ok := rec[elapsedKey]; ok != w.ended {
+			t.Errorf("record %d has %s: %v, want %v", i, elapsedKey, ok, w.ended)
+		}
+	}
+	if records[0][spanIDKey] != outer || records[0]["path"] != "/users" {
+		t.Errorf("start record = %v, want span ID %s and the original fields", records[0], outer)
+	}
+}
@@ -0,0 +1,112 @@
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Size is a size in megabytes. It unmarshals from a plain number of
+// megabytes or from a string with a unit such as "512KB", "250MB" or "1GiB".
+// Units are binary whether or not the "i" is present, matching how MaxSize
+// has always been applied, and sizes are rounded up to whole megabytes.
+// "unlimited" unmarshals to UnlimitedSize.
+type Size int
+
+// UnlimitedSize as MaxSize or MaxSizeText disables size-based rotation, for logs rotated
+// purely by RotateSchedule, RotationInterval or by an external tool. The mmap output keeps
+// extending the single file one mapping at a time.
+const UnlimitedSize = -1
+
+var sizeUnits = map[string]float64{
+	"":  1, // plain numbers are megabytes
+	"b": 1.0 / (1 << 20),
+	"k": 1.0 / (1 << 10), "kb": 1.0 / (1 << 10), "kib": 1.0 / (1 << 10),
+	"m": 1, "mb": 1, "mib": 1,
+	"g": 1 << 10, "gb": 1 << 10, "gib": 1 << 10,
+	"t": 1 << 20, "tb": 1 << 20, "tib": 1 << 20,
+}
+
+// UnmarshalText Unmarshal the text.
+func (s *Size) UnmarshalText(text []byte) error {
+	if strings.EqualFold(strings.TrimSpace(string(text)), "unlimited") {
+		*s = UnlimitedSize
+		return nil
+	}
+	num, unit := splitUnit(string(text))
+	factor, ok := sizeUnits[unit]
+	if !ok {
+		return fmt.Errorf("not support size unit: %v", string(text))
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("not support size: %v", string(text))
+	}
+	mb := v * factor
+	*s = Size(mb)
+	if float64(*s) < mb {
+		*s++
+	}
+	return nil
+}
+
+// Days is a duration in whole days. It unmarshals from a plain number of
+// days or from a string such as "7d", "2w" or "72h"; durations that are not
+// whole days are rounded up so nothing is pruned earlier than asked.
+type Days int
+
+// UnmarshalText Unmarshal the text.
+func (d *Days) UnmarshalText(text []byte) error {
+	num, unit := splitUnit(string(text))
+	var days float64
+	switch unit {
+	case "", "d":
+		v, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return fmt.Errorf("not support duration: %v", string(text))
+		}
+		days = v
+	case "w":
+		v, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return fmt.Errorf("not support duration: %v", string(text))
+		}
+		days = v * 7
+	default:
+		v, err := time.ParseDuration(strings.TrimSpace(string(text)))
+		if err != nil {
+			return fmt.Errorf("not support duration: %v", string(text))
+		}
+		days = v.Hours() / 24
+	}
+	if days < 0 {
+		return fmt.Errorf("not support duration: %v", string(text))
+	}
+	*d = Days(days)
+	if float64(*d) < days {
+		*d++
+	}
+	return nil
+}
+
+// applyUnits lets MaxSizeText and MaxAgeText, when set, override MaxSize and
+// MaxAge.
+func applyUnits(config *Config) {
+	if config.MaxSizeText != 0 {
+		config.MaxSize = int(config.MaxSizeText)
+	}
+	if config.MaxAgeText != 0 {
+		config.MaxAge = int(config.MaxAgeText)
+	}
+}
+
+// splitUnit splits "250MB" into "250" and "mb".
+func splitUnit(s string) (num, unit string) {
+	s = strings.TrimSpace(s)
+	i := len(s)
+	for i > 0 && (s[i-1] < '0' || s[i-1] > '9') && s[i-1] != '.' {
+		i--
+	}
+	return strings.TrimSpace(s[:i]), strings.ToLower(strings.TrimSpace(s[i:]))
+}
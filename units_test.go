@@ -0,0 +1,78 @@
+package log
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSizeUnmarshalText(t *testing.T) {
+	tests := map[string]Size{
+		"100":       100,
+		"250MB":     250,
+		"250 mb":    250,
+		"1GiB":      1024,
+		"1g":        1024,
+		"1.5GB":     1536,
+		"512KB":     1, // rounded up to whole megabytes
+		"1b":        1,
+		"unlimited": UnlimitedSize,
+	}
+	for text, want := range tests {
+		var s Size
+		if err := s.UnmarshalText([]byte(text)); err != nil || s != want {
+			t.Errorf("Size %q = %d, %v, want %d", text, s, err, want)
+		}
+	}
+	for _, text := range []string{"", "MB", "10XB", "-1MB", "ten"} {
+		var s Size
+		if err := s.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("Size %q = %d, want an error", text, s)
+		}
+	}
+}
+
+func TestDaysUnmarshalText(t *testing.T) {
+	tests := map[string]Days{
+		"30":  30,
+		"7d":  7,
+		"2w":  14,
+		"72h": 3,
+		"25h": 2, // rounded up so nothing is pruned early
+		"0":   0,
+	}
+	for text, want := range tests {
+		var d Days
+		if err := d.UnmarshalText([]byte(text)); err != nil || d != want {
+			t.Errorf("Days %q = %d, %v, want %d", text, d, err, want)
+		}
+	}
+	for _, text := range []string{"", "d", "7y", "-1d", "-24h"} {
+		var d Days
+		if err := d.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("Days %q = %d, want an error", text, d)
+		}
+	}
+}
+
+func TestUnitsOverride(t *testing.T) {
+	config := &Config{}
+	data := `{"Output": "console", "MaxSize": 10, "MaxSizeText": "1GiB", "MaxAge": 3, "MaxAgeText": "2w"}`
+	if err := json.Unmarshal([]byte(data), config); err != nil {
+		t.Fatal(err)
+	}
+	l := New(config).(*zapLogger)
+	defer l.Close()
+	if c := l.EffectiveConfig(); c.MaxSize != 1024 || c.MaxAge != 14 {
+		t.Fatalf("MaxSize, MaxAge = %d, %d, want the text fields 1024, 14", c.MaxSize, c.MaxAge)
+	}
+
+	config = &Config{}
+	if err := json.Unmarshal([]byte(`{"Output": "console", "MaxSize": 10, "MaxAge": 3}`), config); err != nil {
+		t.Fatal(err)
+	}
+	l = New(config).(*zapLogger)
+	defer l.Close()
+	if c := l.EffectiveConfig(); c.MaxSize != 10 || c.MaxAge != 3 {
+		t.Fatalf("MaxSize, MaxAge = %d, %d, want the plain fields 10, 3", c.MaxSize, c.MaxAge)
+	}
+}
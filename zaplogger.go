@@ -1,12 +1,18 @@
 package log
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Reb1113/mmap_write_syncer/logger"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var mmapLogger *logger.MMapLogger
@@ -17,21 +23,19 @@ func New(config *Config) Logger {
 		config = defaultConfig
 	}
 
-	var encoder zapcore.Encoder
-	encoderConfig := zap.NewProductionEncoderConfig()
-	encoderConfig.TimeKey = "time"
-	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	if config.DevMode {
-		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-		encoder = zapcore.NewConsoleEncoder(encoderConfig)
-	} else {
-		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	if err := config.Validate(); err != nil {
+		reportError(config, err)
+		if !config.Output.valid() {
+			config.Output = OutputConsole
+		}
 	}
+	encoder := newEncoder(config)
 
 	if config.Filename == "" {
 		config.Filename = defaultFilename
 	}
-	if config.MaxSize <= 0 {
+	applyUnits(config)
+	if config.MaxSize <= 0 && config.MaxSize != UnlimitedSize {
 		config.MaxSize = defaultMaxSize
 	}
 	if config.MaxAge <= 0 {
@@ -40,45 +44,209 @@ func New(config *Config) Logger {
 	if config.MaxBackups <= 0 {
 		config.MaxBackups = defaultMaxBackups
 	}
-	lumberJackLogger := &lumberjack.Logger{
-		Filename:   config.Filename,
-		MaxSize:    config.MaxSize,
-		MaxAge:     config.MaxAge,
-		MaxBackups: config.MaxBackups,
-		LocalTime:  true,
-		Compress:   config.Compress,
-	}
-	mmapLogger = &logger.MMapLogger{
-		Filename:   config.Filename,
-		MaxSize:    config.MaxSize,
-		MaxAge:     config.MaxAge,
-		MaxBackups: config.MaxBackups,
-		LocalTime:  true,
-		Compress:   config.Compress,
-	}
-
-	var writeSyncer zapcore.WriteSyncer
-	switch config.Output {
-	case OutputFile:
-		writeSyncer = zapcore.NewMultiWriteSyncer(zapcore.AddSync(lumberJackLogger))
-	case OutputMmap:
-		writeSyncer = zapcore.NewMultiWriteSyncer(zapcore.AddSync(mmapLogger))
-	default:
-		writeSyncer = zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout))
+	if config.Output.writesFiles() {
+		if err := config.containPaths(); err != nil {
+			reportError(config, fmt.Errorf("log files disabled: %w", err))
+			config.Output = OutputConsole
+		}
 	}
+	if config.Doctor && config.Output.writesFiles() {
+		if err := DoctorFix(config).Err(); err != nil { // New creates the files anyway
+			reportError(config, err)
+		}
+	}
+
+	output := newOutputSyncer(config, config.Output)
+	var writeSyncer zapcore.WriteSyncer = output
+	sinks := []io.Closer{output}
+
+	counters := &writeCounters{}
+	writeSyncer = &countingSyncer{WriteSyncer: writeSyncer, counters: counters}
 
+	var restoreStderr func() error
+	if config.RedirectStderr && config.Output.writesFiles() {
+		restore, err := redirectStderr(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "redirect stderr fail. error: %v\n", err)
+		} else {
+			restoreStderr = restore
+		}
+	}
+
+	applyVerbosity(config)
 	level := zap.NewAtomicLevelAt(config.Level.ZapLevel())
-	core := zapcore.NewCore(encoder, writeSyncer, level)
+	var core zapcore.Core
+	if config.Output == OutputMmap && config.RouteField != "" {
+		r := newRouter(config, writeSyncer, counters)
+		sinks = append(sinks, r)
+		core = &routingCore{LevelEnabler: level, enc: encoder, router: r}
+	} else {
+		core = zapcore.NewCore(encoder, writeSyncer, level)
+		if config.SplitConsole {
+			stderr := &countingSyncer{WriteSyncer: zapcore.Lock(os.Stderr), counters: counters}
+			core = &splitCore{Core: core, stderr: zapcore.NewCore(encoder, stderr, level), output: output}
+		}
+	}
+	if config.Quiet {
+		core = &quietCore{Core: core, output: output}
+	}
 
-	options := []zap.Option{zap.AddCaller(), zap.AddCallerSkip(2)}
+	transform := config.FieldTransform
+	if config.LargeFieldSize > 0 {
+		if config.LargeFieldFile == "" {
+			config.LargeFieldFile = config.Filename + ".blobs"
+		}
+		blobs := newBlobFile(config)
+		sinks = append(sinks, blobs)
+		if transform != nil {
+			transform = chainFieldTransformers(transform, blobs.transform)
+		} else {
+			transform = blobs.transform
+		}
+	}
+	if transform != nil {
+		core = &fieldCore{Core: core, transform: transform}
+	}
+	// below the stdout copy, whose pipe or terminal can't be synced
+	if config.SyncOnLevel != nil {
+		core = &syncCore{Core: core, level: config.SyncOnLevel.ZapLevel(), output: output}
+	}
+	if config.StdoutLevel != nil && config.Output != OutputConsole && config.Output != OutputStdout {
+		core = zapcore.NewTee(core, newStdoutCore(config, level))
+	}
+	// above the stdout copy, so every sink sees the same message
+	if config.MessageTransform != nil {
+		core = &messageCore{Core: core, transform: config.MessageTransform}
+	}
+	if config.StructuredErrors {
+		core = &errorCore{Core: core}
+	}
+	if config.Fingerprint {
+		core = &fingerprintCore{Core: core}
+	}
+	if config.GoroutineFrames > 0 {
+		core = newGoroutineCore(core, config)
+	}
+	if config.Monotonic {
+		core = &monotonicCore{Core: core}
+	}
+	if config.Sequence {
+		if config.SequenceFile == "" {
+			config.SequenceFile = config.Filename + ".seq"
+		}
+		seq, err := newSequencer(config.SequenceFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sequence disabled. error: %v\n", err)
+		} else {
+			core = &sequenceCore{Core: core, seq: seq}
+			sinks = append(sinks, seq)
+		}
+	}
+	if config.FieldAllowlist != nil || len(config.RedactKeys) > 0 {
+		core = newAllowlistCore(core, config.FieldAllowlist, config.RedactKeys)
+	}
+	if keyOf := config.SampleKey; keyOf != nil || config.SampleField != "" {
+		if keyOf == nil {
+			keyOf = SampleByField(config.SampleField)
+		}
+		core = &samplingCore{Core: core, sampler: newKeyedSampler(config), keyOf: keyOf}
+	}
+
+	options := []zap.Option{zap.AddCaller(), zap.AddCallerSkip(1)}
 	if config.DisableStacktrace {
 		options = append(options, zap.AddStacktrace(zap.FatalLevel))
 	} else {
 		options = append(options, zap.AddStacktrace(zap.ErrorLevel))
 	}
+	if config.Clock != nil {
+		options = append(options, zap.WithClock(config.Clock))
+	}
+	if config.StrictKeyvals && config.DevMode {
+		options = append(options, zap.Development())
+	}
 	logger := zap.New(core, options...).Sugar()
 
-	return &zapLogger{config: config, logger: logger, level: level}
+	l := &zapLogger{config: config, logger: logger, level: level, out: writeSyncer, window: newLevelWindow(config.Level), output: output, sinks: sinks, managed: startSinks(config), counters: counters, pool: newBufferPool(config.RawBufferSize), restoreStderr: restoreStderr, effective: &atomic.Pointer[Config]{}}
+	l.publishConfig()
+	if config.LogConfig {
+		l.logEffectiveConfig()
+	}
+	register(l)
+	return l
+}
+
+// newEncoder returns the record encoder selected by config.
+func newEncoder(config *Config) zapcore.Encoder {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.EncodeCaller = callerEncoder(config.CallerTrimPrefix)
+	if config.DevMode {
+		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+	switch encodingOf(config) {
+	case EncodingMsgpack:
+		return newMsgpackEncoder(encoderConfig)
+	case EncodingConsole:
+		return zapcore.NewConsoleEncoder(encoderConfig)
+	default:
+		return zapcore.NewJSONEncoder(encoderConfig)
+	}
+}
+
+// newMMapLogger returns an MMapLogger writing to filename with the rotation
+// settings of config.
+func newMMapLogger(config *Config, filename string) *logger.MMapLogger {
+	var header []byte
+	if fileHeaderEnabled(config) {
+		header, _ = fileHeader(config).MarshalBinary()
+	}
+	var lifecycle func(logger.LifecycleEvent) []byte
+	if config.Lifecycle {
+		lifecycle = newLifecycleRecorder(config).record
+	}
+	return &logger.MMapLogger{
+		Filename:          filename,
+		MaxSize:           config.MaxSize,
+		MaxAge:            config.MaxAge,
+		MaxBackups:        config.MaxBackups,
+		LocalTime:         true,
+		Compress:          config.Compress,
+		MaxRecordSize:     config.MaxRecordSize,
+		RecordPolicy:      config.RecordPolicy,
+		SyncAsync:         config.MmapSyncAsync,
+		SyncFile:          config.MmapSyncFile,
+		FlushInterval:     config.MmapFlushInterval,
+		Preallocate:       config.MmapPreallocate,
+		PreallocateFile:   config.MmapReserveFile,
+		AsyncBuffer:       int(config.MmapAsyncBuffer) * 1024 * 1024,
+		AsyncOverflow:     config.MmapAsyncOverflow,
+		ChunkSize:         int(config.MmapChunkSize) * 1024 * 1024,
+		Advice:            config.MmapAdvice,
+		RecompressAfter:   int(config.RecompressAfter),
+		RecompressLevel:   config.RecompressLevel,
+		RecompressFormat:  config.RecompressFormat,
+		CompressRateLimit: config.CompressRateLimit,
+		CompressNice:      config.CompressNice,
+		DetectRotation:    config.DetectRotation,
+		KeepPatterns:      config.KeepPatterns,
+		QuotaFile:         config.QuotaFile,
+		QuotaSize:         int(config.QuotaSize),
+		RetentionInterval: config.RetentionInterval,
+		RetentionJitter:   config.RetentionJitter,
+		RetentionDebounce: config.RetentionDebounce,
+		InventoryRescan:   config.InventoryRescan,
+		RefuseSymlink:     config.RefuseSymlink,
+		RotateSchedule:    config.RotateSchedule,
+		RotationInterval:  config.RotationInterval,
+		CompressSchedule:  config.CompressSchedule,
+		Header:            header,
+		CrashMarker:       config.CrashMarker,
+		KeepPadding:       encodingOf(config) == EncodingMsgpack, // msgpack records may end in NUL bytes
+		LifecycleRecord:   lifecycle,
+		Clock:             config.Clock,
+		OnError:           config.OnError,
+	}
 }
 
 // ZapLevel return a zap level.
@@ -105,52 +273,179 @@ type zapLogger struct {
 	config *Config
 	logger *zap.SugaredLogger
 	level  zap.AtomicLevel
+	out    zapcore.WriteSyncer
+	window *levelWindow
+	output *outputSyncer
+	sinks  []io.Closer
+
+	managed       []Sink // managed are the started Config.Sinks
+	counters      *writeCounters
+	pool          *bufferPool
+	restoreStderr func() error
+	effective     *atomic.Pointer[Config] // effective is the snapshot returned by EffectiveConfig
 }
 
+// With adds args to the fields of the records l writes from now on and
+// returns l.
 func (l *zapLogger) With(args ...interface{}) Logger {
-	l.logger = l.logger.With(args...)
+	l.logger = l.logger.With(l.keyvals(args)...)
 	return l
 }
 
+// Child returns a logger carrying args in addition to the fields of l,
+// leaving l unchanged, e.g. one logger per tenant routed by RouteField.
+func (l *zapLogger) Child(args ...interface{}) Logger {
+	child := *l
+	child.logger = l.logger.With(l.keyvals(args)...)
+	return &child
+}
+
+// SetOutput switches the logger to output, flushing and closing the
+// previous output once no write is using it anymore.
+func (l *zapLogger) SetOutput(output Output) error {
+	if !output.valid() {
+		return fmt.Errorf("not support output: %v", output)
+	}
+	if output.writesFiles() {
+		if err := l.config.containPaths(); err != nil {
+			return err
+		}
+	}
+	// the switch happens even when closing the old output fails, which is
+	// reported after the new output is in place
+	err := l.output.set(l.config, output)
+	for _, s := range l.sinks {
+		if r, ok := s.(interface{ setOutput(Output) error }); ok { // routed sinks follow the output
+			err = multierr.Append(err, r.setOutput(output))
+		}
+	}
+	l.config.Output = output
+	l.publishConfig()
+	if l.config.LogConfig {
+		l.logEffectiveConfig()
+	}
+	return err
+}
+
+// SetLevel sets the level, ending any window started by SetLevelFor.
 func (l *zapLogger) SetLevel(lvl Level) {
+	l.window.mu.Lock()
+	defer l.window.mu.Unlock()
+	l.window.cancel()
+	l.setLevel(lvl)
+}
+
+// SetLevelFor sets the level for d and then reverts to the level in effect
+// before the window. Calling it again during a window replaces the window
+// but still reverts to the original level.
+func (l *zapLogger) SetLevelFor(lvl Level, d time.Duration) {
+	w := l.window
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	restore := l.GetLevel()
+	if w.timer != nil {
+		restore = w.restore
+	}
+	w.cancel()
+	gen := w.gen
+	w.restore = restore
+	l.setLevel(lvl)
+	w.timer = time.AfterFunc(d, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.gen != gen {
+			return
+		}
+		w.timer = nil
+		l.setLevel(w.restore)
+	})
+}
+
+// GetLevel returns the level in effect, including a window of SetLevelFor.
+func (l *zapLogger) GetLevel() Level {
+	return Level(l.window.level.Load())
+}
+
+// setLevel sets the level in effect. It leaves Config.Level alone, which
+// belongs to the caller of New. The caller must hold l.window.mu.
+func (l *zapLogger) setLevel(lvl Level) {
+	l.window.level.Store(int32(lvl))
 	l.level.SetLevel(lvl.ZapLevel())
-	l.config.Level = lvl
 }
 
+// checkLevel applies a change the caller made to Config.Level since New, as
+// SetLevel would.
 func (l *zapLogger) checkLevel() {
-	if l.config.Level.ZapLevel() != l.level.Level() {
-		l.SetLevel(l.config.Level)
+	lvl := l.config.Level
+	if int32(lvl) == l.window.seen.Load() {
+		return
+	}
+	w := l.window
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seen.Swap(int32(lvl)) != int32(lvl) {
+		w.cancel()
+		l.setLevel(lvl)
 	}
 }
 
+// levelWindow holds the level in effect and tracks a temporary level set by
+// SetLevelFor. It is shared by a logger and its children.
+type levelWindow struct {
+	level atomic.Int32 // level is the Level in effect
+	seen  atomic.Int32 // seen is the last Config.Level applied by checkLevel
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	gen     uint64 // gen is bumped whenever the window is cancelled
+	restore Level
+}
+
+// newLevelWindow returns a window with lvl in effect, as given in Config.Level.
+func newLevelWindow(lvl Level) *levelWindow {
+	w := &levelWindow{}
+	w.level.Store(int32(lvl))
+	w.seen.Store(int32(lvl))
+	return w
+}
+
+// cancel stops the pending revert. The caller must hold w.mu.
+func (w *levelWindow) cancel() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.gen++
+}
+
 func (l *zapLogger) Debug(msg string, keyvals ...interface{}) {
 	l.checkLevel()
-	l.logger.Debugw(msg, keyvals...)
+	l.logger.Debugw(msg, l.keyvals(keyvals)...)
 }
 
 func (l *zapLogger) Info(msg string, keyvals ...interface{}) {
 	l.checkLevel()
-	l.logger.Infow(msg, keyvals...)
+	l.logger.Infow(msg, l.keyvals(keyvals)...)
 }
 
 func (l *zapLogger) Warn(msg string, keyvals ...interface{}) {
 	l.checkLevel()
-	l.logger.Warnw(msg, keyvals...)
+	l.logger.Warnw(msg, l.keyvals(keyvals)...)
 }
 
 func (l *zapLogger) Error(msg string, keyvals ...interface{}) {
 	l.checkLevel()
-	l.logger.Errorw(msg, keyvals...)
+	l.logger.Errorw(msg, l.keyvals(keyvals)...)
 }
 
 func (l *zapLogger) Panic(msg string, keyvals ...interface{}) {
 	l.checkLevel()
-	l.logger.Panicw(msg, keyvals...)
+	l.logger.Panicw(msg, l.keyvals(keyvals)...)
 }
 
 func (l *zapLogger) Fatal(msg string, keyvals ...interface{}) {
 	l.checkLevel()
-	l.logger.Fatalw(msg, keyvals...)
+	l.logger.Fatalw(msg, l.keyvals(keyvals)...)
 }
 
 func (l *zapLogger) Debugf(template string, args ...interface{}) {
@@ -183,6 +478,113 @@ func (l *zapLogger) Fatalf(template string, args ...interface{}) {
 	l.logger.Fatalf(template, args...)
 }
 
+func (l *zapLogger) DroppedCount() uint64 {
+	return droppedCount(l.sinks)
+}
+
+func (l *zapLogger) FailedWrites() uint64 {
+	return l.counters.failed.Load()
+}
+
+func (l *zapLogger) BufferStats() BufferStats {
+	stats := l.pool.stats()
+	stats.Records = l.counters.records.Load()
+	stats.MaxRecordSize = int(l.counters.maxRecord.Load())
+	stats.Oversized = l.counters.oversized.Load()
+	stats.DroppedBytes = l.output.droppedBytes()
+	return stats
+}
+
+// WaitMaintenance waits until the retention, removal and compression of
+// backups triggered so far have finished. Call it before Close, which
+// cancels running compression.
+func (l *zapLogger) WaitMaintenance(ctx context.Context) error {
+	var err error
+	for _, s := range l.sinks {
+		if w, ok := s.(interface {
+			WaitMaintenance(context.Context) error
+		}); ok {
+			err = multierr.Append(err, w.WaitMaintenance(ctx))
+		}
+	}
+	return err
+}
+
+// droppedCount sums the dropped records reported by sinks.
+func droppedCount(sinks []io.Closer) uint64 {
+	var n uint64
+	for _, s := range sinks {
+		if d, ok := s.(interface{ DroppedCount() uint64 }); ok {
+			n += d.DroppedCount()
+		}
+	}
+	return n
+}
+
+// writeCounters are shared by all countingSyncers of one logger.
+type writeCounters struct {
+	failed    atomic.Uint64
+	records   atomic.Uint64
+	oversized atomic.Uint64
+	maxRecord atomic.Int64
+}
+
+// countingSyncer counts the records written to the wrapped WriteSyncer,
+// their sizes and the writes that fail.
+type countingSyncer struct {
+	zapcore.WriteSyncer
+	counters *writeCounters
+}
+
+func (c *countingSyncer) Write(p []byte) (int, error) {
+	c.counters.records.Add(1)
+	size := int64(len(p))
+	if size > zapBufferSize {
+		c.counters.oversized.Add(1)
+	}
+	for max := c.counters.maxRecord.Load(); size > max; max = c.counters.maxRecord.Load() {
+		if c.counters.maxRecord.CompareAndSwap(max, size) {
+			break
+		}
+	}
+	n, err := c.WriteSyncer.Write(p)
+	if err != nil {
+		c.counters.failed.Add(1)
+	}
+	return n, err
+}
+
+func (l *zapLogger) Raw(lvl Level, p []byte) error {
+	l.checkLevel()
+	if !l.level.Enabled(lvl.ZapLevel()) {
+		return nil
+	}
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		_, err := l.out.Write(p)
+		return err
+	}
+	buf := l.pool.get()
+	buf = append(append(buf, p...), '\n')
+	_, err := l.out.Write(buf)
+	l.pool.put(buf)
+	return err
+}
+
+// Sync flushes the records written so far to the output, for the mmap
+// output with msync, so they survive a crash of the machine.
+func (l *zapLogger) Sync() error {
+	return l.logger.Sync()
+}
+
 func (l *zapLogger) Close() {
+	unregister(l)
 	_ = l.logger.Sync()
+	if l.restoreStderr != nil {
+		_ = l.restoreStderr()
+		l.restoreStderr = nil
+	}
+	for _, s := range l.sinks {
+		_ = s.Close()
+	}
+	stopSinks(l.config, l.managed)
 }